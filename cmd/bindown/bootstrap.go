@@ -27,7 +27,7 @@ func (c *bootstrapCmd) Run(ctx *runContext) error {
 		tag = "v" + tag
 	}
 	opts := bootstrapper.BuildOpts{BaseURL: c.BaseURL}
-	content, err := bootstrapper.Build(tag, &opts)
+	content, err := bootstrapper.Build(ctx, tag, &opts)
 	if err != nil {
 		return err
 	}
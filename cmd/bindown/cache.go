@@ -1,15 +1,232 @@
 package main
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/willabides/bindown/v4/internal/bindown"
+)
+
 type cacheCmd struct {
-	Clear cacheClearCmd `kong:"cmd,help='clear the cache'"`
+	Clear  cacheClearCmd  `kong:"cmd,help='clear the cache'"`
+	List   cacheListCmd   `kong:"cmd,help=${cache_list_help}"`
+	Info   cacheInfoCmd   `kong:"cmd,help=${cache_info_help}"`
+	Prune  cachePruneCmd  `kong:"cmd,help=${cache_prune_help}"`
+	Verify cacheVerifyCmd `kong:"cmd,help=${cache_verify_help}"`
 }
 
-type cacheClearCmd struct{}
+type cacheClearCmd struct {
+	All bool `kong:"help=${cache_clear_all_help}"`
+}
 
 func (c *cacheClearCmd) Run(ctx *runContext) error {
 	config, err := loadConfigFile(ctx, false)
 	if err != nil {
 		return err
 	}
+	if c.All && config.UsesSharedCache() {
+		return config.ClearSharedCache()
+	}
 	return config.ClearCache()
 }
+
+type cacheVerifyCmd struct {
+	Repair bool `kong:"help=${cache_verify_repair_help}"`
+}
+
+func (c *cacheVerifyCmd) Run(ctx *runContext) error {
+	config, err := loadConfigFile(ctx, false)
+	if err != nil {
+		return err
+	}
+	results, err := config.VerifyCache(ctx, c.Repair)
+	if err != nil {
+		return err
+	}
+	if ctx.rootCmd.JSONConfig {
+		encoder := json.NewEncoder(ctx.stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(results)
+	} else {
+		w := tabwriter.NewWriter(ctx.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STATUS\tCACHE\tKEY\tDEPENDENCY\tSYSTEM\tDETAILS")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Status, r.Cache, r.Key, r.Dependency, r.System, r.Error)
+		}
+		err = w.Flush()
+	}
+	if err != nil {
+		return err
+	}
+	problems := 0
+	for _, r := range results {
+		if r.Status == bindown.CacheCorrupt {
+			problems++
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("found %d damaged cache entries", problems)
+	}
+	return nil
+}
+
+type cacheListCmd struct{}
+
+func (c *cacheListCmd) Run(ctx *runContext) error {
+	config, err := loadConfigFile(ctx, false)
+	if err != nil {
+		return err
+	}
+	entries, err := config.CacheEntries()
+	if err != nil {
+		return err
+	}
+	if ctx.rootCmd.JSONConfig {
+		encoder := json.NewEncoder(ctx.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+	w := tabwriter.NewWriter(ctx.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CACHE\tKEY\tDEPENDENCY\tSYSTEM\tSIZE\tLAST USED")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Cache, e.Key, e.Dependency, e.System, formatSize(e.Size), formatTime(e.LastUsed))
+	}
+	return w.Flush()
+}
+
+type cacheInfoCmd struct {
+	Key string `kong:"arg,help=${cache_info_key_help}"`
+}
+
+func (c *cacheInfoCmd) Run(ctx *runContext) error {
+	config, err := loadConfigFile(ctx, false)
+	if err != nil {
+		return err
+	}
+	entries, err := config.CacheInfo(c.Key)
+	if err != nil {
+		return err
+	}
+	if ctx.rootCmd.JSONConfig {
+		encoder := json.NewEncoder(ctx.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+	w := tabwriter.NewWriter(ctx.stdout, 0, 0, 1, ' ', 0)
+	for i, e := range entries {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "cache:\t%s\n", e.Cache)
+		fmt.Fprintf(w, "key:\t%s\n", e.Key)
+		fmt.Fprintf(w, "path:\t%s\n", e.Path)
+		fmt.Fprintf(w, "dependency:\t%s\n", e.Dependency)
+		fmt.Fprintf(w, "system:\t%s\n", e.System)
+		fmt.Fprintf(w, "url:\t%s\n", e.URL)
+		fmt.Fprintf(w, "checksum:\t%s\n", e.Checksum)
+		fmt.Fprintf(w, "size:\t%s\n", formatSize(e.Size))
+		fmt.Fprintf(w, "created:\t%s\n", formatTime(e.Created))
+		fmt.Fprintf(w, "last used:\t%s\n", formatTime(e.LastUsed))
+	}
+	return w.Flush()
+}
+
+type cachePruneCmd struct {
+	Unreachable bool   `kong:"help=${cache_prune_unreachable_help}"`
+	UnusedDays  int    `kong:"placeholder=<days>,help=${cache_prune_unused_days_help}"`
+	MaxSize     string `kong:"placeholder=<size>,help=${cache_prune_max_size_help}"`
+	DryRun      bool   `kong:"help=${cache_prune_dry_run_help}"`
+}
+
+func (c *cachePruneCmd) Run(ctx *runContext) error {
+	if c.UnusedDays < 0 {
+		return errors.New("--unused-days must not be negative")
+	}
+	if !c.Unreachable && c.UnusedDays == 0 && c.MaxSize == "" {
+		return errors.New("nothing to prune. use --unreachable, --unused-days or --max-size")
+	}
+	var maxSize int64
+	if c.MaxSize != "" {
+		var err error
+		maxSize, err = parseSize(c.MaxSize)
+		if err != nil {
+			return err
+		}
+		if maxSize <= 0 {
+			return errors.New("--max-size must be greater than zero. use `bindown cache clear` to remove everything")
+		}
+	}
+	config, err := loadConfigFile(ctx, false)
+	if err != nil {
+		return err
+	}
+	removed, err := config.PruneCache(&bindown.ConfigPruneCacheOpts{
+		Unreachable: c.Unreachable,
+		UnusedFor:   time.Duration(c.UnusedDays) * 24 * time.Hour,
+		MaxSize:     maxSize,
+		DryRun:      c.DryRun,
+	})
+	if err != nil {
+		return err
+	}
+	if ctx.rootCmd.JSONConfig {
+		encoder := json.NewEncoder(ctx.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(removed)
+	}
+	var freed int64
+	w := tabwriter.NewWriter(ctx.stdout, 0, 0, 2, ' ', 0)
+	for _, e := range removed {
+		freed += e.Size
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Cache, e.Key, e.Dependency, e.System, formatSize(e.Size))
+	}
+	verb := "removed"
+	if c.DryRun {
+		verb = "would remove"
+	}
+	fmt.Fprintf(w, "%s %d entries, %s\n", verb, len(removed), formatSize(freed))
+	return w.Flush()
+}
+
+// parseSize parses a size like "500M", "2GiB" or "1024". Units are binary.
+func parseSize(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B"), "I")
+	shift := 0
+	if n := len(num); n > 0 {
+		if i := strings.IndexByte("KMGT", num[n-1]); i >= 0 {
+			shift = 10 * (i + 1)
+			num = num[:n-1]
+		}
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(value * float64(int64(1)<<shift)), nil
+}
+
+// formatSize formats a size in bytes with a binary unit like "1.5 MiB".
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(time.DateTime)
+}
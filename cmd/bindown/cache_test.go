@@ -2,11 +2,15 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/bindown/v4/internal/bindown"
 	"github.com/willabides/bindown/v4/internal/testutil"
 )
 
@@ -33,6 +37,41 @@ url_checksums:
 		assert.NoDirExists(t, extractDir)
 	})
 
+	t.Run("removes sealed cache", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("windows doesn't have write permission bits")
+		}
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml(fmt.Sprintf(`
+seal_cache: true
+dependencies:
+  foo:
+    url: %s
+url_checksums:
+  %s: 27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3
+`, depURL, depURL))
+		isSealed := func(filename string) bool {
+			t.Helper()
+			info, err := os.Stat(filename)
+			require.NoError(t, err)
+			return info.Mode()&0o222 == 0
+		}
+		result := runner.run("extract", "foo", "--no-seal-cache")
+		extractDir := result.getExtractDir()
+		assert.False(t, isSealed(filepath.Join(extractDir, "foo")))
+		require.NoError(t, os.RemoveAll(runner.cache))
+
+		t.Setenv("BINDOWN_SEAL_CACHE", "false")
+		result = runner.run("extract", "foo", "--seal-cache")
+		extractDir = result.getExtractDir()
+		assert.True(t, isSealed(filepath.Join(extractDir, "foo")))
+		assert.True(t, isSealed(extractDir))
+
+		result = runner.run("cache", "clear", "--no-seal-cache")
+		result.assertState(resultState{})
+		assert.NoDirExists(t, runner.cache)
+	})
+
 	t.Run("does nothing if cache is empty", func(t *testing.T) {
 		runner := newCmdRunner(t)
 		runner.writeConfigYaml(`{}`)
@@ -53,3 +92,212 @@ url_checksums:
 		})
 	})
 }
+
+func Test_cacheVerifyCmd(t *testing.T) {
+	servePath := testdataPath("downloadables/fooinroot.tar.gz")
+	successServer := testutil.ServeFile(t, servePath, "/foo/fooinroot.tar.gz", "")
+	depURL := successServer.URL + "/foo/fooinroot.tar.gz"
+
+	runner := newCmdRunner(t)
+	runner.writeConfigYaml(fmt.Sprintf(`
+systems: [%s]
+dependencies:
+  foo:
+    url: %s
+url_checksums:
+  %s: 27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3
+`, bindown.CurrentSystem, depURL, depURL))
+	result := runner.run("extract", "foo")
+	extractDir := result.getExtractDir()
+	result = runner.run("cache", "verify")
+	result.assertState(resultState{
+		stdout: `ok +downloads +\S+ +foo +` + regexp.QuoteMeta(string(bindown.CurrentSystem)) + `\s+ok +extracts`,
+	})
+
+	require.NoError(t, os.WriteFile(filepath.Join(extractDir, "foo"), []byte("tampered"), 0o600))
+	result = runner.run("cache", "verify")
+	result.assertState(resultState{
+		stdout: `corrupt +extracts +\S+ +foo .* have changed since they were extracted`,
+		stderr: `cmd: error: found 1 damaged cache entries`,
+		exit:   1,
+	})
+
+	result = runner.run("cache", "verify", "--repair")
+	result.assertState(resultState{
+		stdout: `repaired +extracts`,
+	})
+	result = runner.run("cache", "verify")
+	result.assertState(resultState{
+		stdout: `ok +extracts`,
+	})
+}
+
+func Test_cacheListCmd(t *testing.T) {
+	servePath := testdataPath("downloadables/fooinroot.tar.gz")
+	successServer := testutil.ServeFile(t, servePath, "/foo/fooinroot.tar.gz", "")
+	depURL := successServer.URL + "/foo/fooinroot.tar.gz"
+
+	runner := newCmdRunner(t)
+	runner.writeConfigYaml(fmt.Sprintf(`
+dependencies:
+  foo:
+    url: %s
+url_checksums:
+  %s: 27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3
+`, depURL, depURL))
+	result := runner.run("cache", "list")
+	result.assertState(resultState{
+		stdout: `^CACHE +KEY +DEPENDENCY +SYSTEM +SIZE +LAST USED$`,
+	})
+
+	result = runner.run("extract", "foo")
+	extractDir := result.getExtractDir()
+	key := filepath.Base(extractDir)
+	system := regexp.QuoteMeta(string(bindown.CurrentSystem))
+	result = runner.run("cache", "list")
+	result.assertState(resultState{
+		stdout: `downloads +` + key + ` +foo +` + system + ` +\d+ B +\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\n` +
+			`extracts +` + key + ` +foo +` + system + ` +\d+ B`,
+	})
+
+	result = runner.run("cache", "list", "--json")
+	result.assertState(resultState{
+		stdout: `"cache": "extracts",\s+"path": "` + regexp.QuoteMeta(extractDir) + `",\s+"key": "` + key + `",\s+"dependency": "foo"`,
+	})
+}
+
+func Test_cacheInfoCmd(t *testing.T) {
+	servePath := testdataPath("downloadables/fooinroot.tar.gz")
+	successServer := testutil.ServeFile(t, servePath, "/foo/fooinroot.tar.gz", "")
+	depURL := successServer.URL + "/foo/fooinroot.tar.gz"
+
+	runner := newCmdRunner(t)
+	runner.writeConfigYaml(fmt.Sprintf(`
+dependencies:
+  foo:
+    url: %s
+url_checksums:
+  %s: 27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3
+`, depURL, depURL))
+	result := runner.run("download", "foo")
+	result.assertState(resultState{stdout: "downloaded foo to "})
+
+	result = runner.run("cache", "info", "foo")
+	result.assertState(resultState{
+		stdout: `cache: +downloads\nkey: +\S+\npath: .+\ndependency: +foo\nsystem: .+\nurl: +` +
+			regexp.QuoteMeta(depURL) + `\nchecksum: +27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3\n` +
+			`size: +\d+ B\ncreated: .+\nlast used: .+$`,
+	})
+
+	result = runner.run("cache", "info", "bar")
+	result.assertState(resultState{
+		stderr: `cmd: error: no cache entries for "bar"`,
+		exit:   1,
+	})
+}
+
+func Test_formatSize(t *testing.T) {
+	for size, want := range map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1024:            "1.0 KiB",
+		1536:            "1.5 KiB",
+		5 * 1024 * 1024: "5.0 MiB",
+		3 << 30:         "3.0 GiB",
+		1<<40 + 1<<39:   "1.5 TiB",
+	} {
+		assert.Equal(t, want, formatSize(size), size)
+	}
+}
+
+func Test_cachePruneCmd(t *testing.T) {
+	servePath := testdataPath("downloadables/fooinroot.tar.gz")
+	successServer := testutil.ServeFile(t, servePath, "/foo/fooinroot.tar.gz", "")
+	depURL := successServer.URL + "/foo/fooinroot.tar.gz"
+	config := fmt.Sprintf(`
+dependencies:
+  foo:
+    url: %s
+url_checksums:
+  %s: 27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3
+`, depURL, depURL)
+
+	t.Run("unreachable", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml(config)
+		result := runner.run("extract", "foo")
+		extractDir := result.getExtractDir()
+
+		result = runner.run("cache", "prune", "--unreachable")
+		result.assertState(resultState{stdout: `removed 0 entries, 0 B`})
+
+		runner.writeConfigYaml(`{}`)
+		result = runner.run("cache", "prune", "--unreachable", "--dry-run")
+		result.assertState(resultState{
+			stdout: `downloads +\S+ +foo .+\nextracts +\S+ +foo .+\nwould remove 2 entries, \d+ B`,
+		})
+		assert.DirExists(t, extractDir)
+
+		result = runner.run("cache", "prune", "--unreachable")
+		result.assertState(resultState{stdout: `removed 2 entries`})
+		assert.NoDirExists(t, extractDir)
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml(config)
+		result := runner.run("extract", "foo")
+		extractDir := result.getExtractDir()
+
+		result = runner.run("cache", "prune", "--max-size", "1MiB", "--unused-days", "30")
+		result.assertState(resultState{stdout: `removed 0 entries`})
+		result = runner.run("cache", "prune", "--max-size", "0.1K")
+		result.assertState(resultState{stdout: `removed 1 entries`})
+		assert.NoDirExists(t, filepath.Join(filepath.Dir(filepath.Dir(extractDir)), "downloads", filepath.Base(extractDir)))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml(config)
+		result := runner.run("cache", "prune")
+		result.assertState(resultState{
+			stderr: `cmd: error: nothing to prune`,
+			exit:   1,
+		})
+		result = runner.run("cache", "prune", "--max-size", "lots")
+		result.assertState(resultState{
+			stderr: `cmd: error: invalid size "lots"`,
+			exit:   1,
+		})
+		result = runner.run("cache", "prune", "--max-size", "0")
+		result.assertState(resultState{
+			stderr: `cmd: error: --max-size must be greater than zero`,
+			exit:   1,
+		})
+		result = runner.run("cache", "prune", "--unused-days=-1")
+		result.assertState(resultState{
+			stderr: `cmd: error: --unused-days must not be negative`,
+			exit:   1,
+		})
+	})
+}
+
+func Test_parseSize(t *testing.T) {
+	for s, want := range map[string]int64{
+		"1024":   1024,
+		"100B":   100,
+		"2k":     2048,
+		"1.5KiB": 1536,
+		"500M":   500 << 20,
+		"2GiB":   2 << 30,
+		"1 TB":   1 << 40,
+	} {
+		got, err := parseSize(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"", "B", "-1K", "1X"} {
+		_, err := parseSize(s)
+		assert.Error(t, err, s)
+	}
+}
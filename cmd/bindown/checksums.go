@@ -1,26 +1,37 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
 	"github.com/willabides/bindown/v4/internal/bindown"
 )
 
 type checksumsCmd struct {
-	Add   addChecksumsCmd   `kong:"cmd,help=${add_checksums_help}"`
-	Prune pruneChecksumsCmd `kong:"cmd,help=${prune_checksums_help}"`
-	Sync  syncChecksumsCmd  `kong:"cmd,help=${sync_checksums_help}"`
+	Add    addChecksumsCmd    `kong:"cmd,help=${add_checksums_help}"`
+	Prune  pruneChecksumsCmd  `kong:"cmd,help=${prune_checksums_help}"`
+	Sync   syncChecksumsCmd   `kong:"cmd,help=${sync_checksums_help}"`
+	Verify verifyChecksumsCmd `kong:"cmd,help=${verify_checksums_help}"`
+	Import importChecksumsCmd `kong:"cmd,help=${import_checksums_help}"`
+
+	ToLockfile toLockfileChecksumsCmd `kong:"cmd,help=${to_lockfile_checksums_help}"`
+	ToInline   toInlineChecksumsCmd   `kong:"cmd,help=${to_inline_checksums_help}"`
 }
 
 type addChecksumsCmd struct {
 	Dependency []string         `kong:"help=${checksums_dep_help},predictor=bin"`
 	Systems    []bindown.System `kong:"name=system,help=${systems_help},predictor=allSystems"`
+	Algorithm  string           `kong:"placeholder=<sha256|sha512|blake3>,help=${checksums_algorithm_help}"`
 }
 
 func (d *addChecksumsCmd) Run(ctx *runContext) error {
-	config, err := loadConfigFile(ctx, true)
+	config, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
-	err = config.AddChecksums(d.Dependency, d.Systems)
+	err = config.AddChecksumsWithAlgorithm(ctx, d.Dependency, d.Systems, d.Algorithm)
 	if err != nil {
 		return err
 	}
@@ -30,7 +41,7 @@ func (d *addChecksumsCmd) Run(ctx *runContext) error {
 type pruneChecksumsCmd struct{}
 
 func (d *pruneChecksumsCmd) Run(ctx *runContext) error {
-	config, err := loadConfigFile(ctx, true)
+	config, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
@@ -44,7 +55,7 @@ func (d *pruneChecksumsCmd) Run(ctx *runContext) error {
 type syncChecksumsCmd struct{}
 
 func (d *syncChecksumsCmd) Run(ctx *runContext) error {
-	config, err := loadConfigFile(ctx, true)
+	config, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
@@ -52,9 +63,103 @@ func (d *syncChecksumsCmd) Run(ctx *runContext) error {
 	if err != nil {
 		return err
 	}
-	err = config.AddChecksums(nil, nil)
+	err = config.AddChecksums(ctx, nil, nil)
+	if err != nil {
+		return err
+	}
+	return config.WriteFile(ctx.rootCmd.JSONConfig)
+}
+
+type verifyChecksumsCmd struct {
+	Dependency []string         `kong:"help=${checksums_verify_dep_help},predictor=bin"`
+	Systems    []bindown.System `kong:"name=system,help=${systems_help},predictor=allSystems"`
+}
+
+func (d *verifyChecksumsCmd) Run(ctx *runContext) error {
+	config, err := loadConfigFile(ctx, true)
+	if err != nil {
+		return err
+	}
+	results, err := config.VerifyChecksums(ctx, d.Dependency, d.Systems)
+	if err != nil {
+		return err
+	}
+	if ctx.rootCmd.JSONConfig {
+		encoder := json.NewEncoder(ctx.stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(results)
+	} else {
+		w := tabwriter.NewWriter(ctx.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STATUS\tURL\tDEPENDENCIES\tDETAILS")
+		for _, r := range results {
+			details := r.Error
+			if r.Status == bindown.ChecksumMismatch && details == "" {
+				details = fmt.Sprintf("wanted %s got %s", r.Want, r.Got)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Status, r.URL, strings.Join(r.Dependencies, ","), details)
+		}
+		err = w.Flush()
+	}
+	if err != nil {
+		return err
+	}
+	// missing and unused checksums are reported but only files that changed or disappeared are errors
+	problems := 0
+	for _, r := range results {
+		if r.Status == bindown.ChecksumMismatch || r.Status == bindown.ChecksumUnavailable {
+			problems++
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("found %d problems with checksums", problems)
+	}
+	return nil
+}
+
+type importChecksumsCmd struct {
+	Source     string           `kong:"arg,help=${checksums_import_source_help}"`
+	Dependency []string         `kong:"help=${checksums_dep_help},predictor=bin"`
+	Systems    []bindown.System `kong:"name=system,help=${systems_help},predictor=allSystems"`
+	Algorithm  string           `kong:"placeholder=<sha256|sha512|blake3>,help=${checksums_import_algorithm_help}"`
+}
+
+func (d *importChecksumsCmd) Run(ctx *runContext) error {
+	config, err := loadConfigFileForUpdate(ctx, true)
+	if err != nil {
+		return err
+	}
+	missing, err := config.ImportChecksums(ctx, d.Source, d.Algorithm, d.Dependency, d.Systems)
+	if err != nil {
+		return err
+	}
+	err = config.WriteFile(ctx.rootCmd.JSONConfig)
+	if err != nil {
+		return err
+	}
+	for _, m := range missing {
+		fmt.Fprintf(ctx.stdout, "no checksum for %s on %s: %s\n", m.Dependency, m.System, m.URL)
+	}
+	return nil
+}
+
+type toLockfileChecksumsCmd struct{}
+
+func (d *toLockfileChecksumsCmd) Run(ctx *runContext) error {
+	config, err := loadConfigFileForUpdate(ctx, true)
+	if err != nil {
+		return err
+	}
+	config.UseLockfile()
+	return config.WriteFile(ctx.rootCmd.JSONConfig)
+}
+
+type toInlineChecksumsCmd struct{}
+
+func (d *toInlineChecksumsCmd) Run(ctx *runContext) error {
+	config, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
+	config.InlineChecksums()
 	return config.WriteFile(ctx.rootCmd.JSONConfig)
 }
@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -66,6 +69,31 @@ dependencies:
 		})
 	})
 
+	t.Run("algorithm", func(t *testing.T) {
+		server := testutil.ServeFile(t, testdataPath("downloadables/foo.tar.gz"), "/foo/foo.tar.gz", "")
+		dlURL := server.URL + "/foo/foo.tar.gz"
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml(fmt.Sprintf(`
+dependencies:
+  d1:
+    url: %q
+url_checksums:
+  %q: %s
+`, dlURL, dlURL, fooChecksum))
+		result := runner.run("checksums", "add", "--system", "darwin/amd64", "--algorithm", "blake3")
+		result.assertState(resultState{})
+		want := map[string]string{
+			dlURL: "blake3:ddd84d8ebeefd4de0cc06be24d049c205aaefb1586f1b6373c63cd1612efece8",
+		}
+		require.Equal(t, want, runner.getConfigFile().URLChecksums)
+
+		result = runner.run("checksums", "add", "--system", "darwin/amd64", "--algorithm", "md5")
+		result.assertState(resultState{
+			stderr: `cmd: error: unknown checksum algorithm "md5". must be one of sha256, sha512, blake3`,
+			exit:   1,
+		})
+	})
+
 	t.Run("dependency does not exist", func(t *testing.T) {
 		runner := newCmdRunner(t)
 		runner.writeConfigYaml(`
@@ -100,3 +128,162 @@ dependencies:
 		require.Equal(t, want, runner.getConfigFile().URLChecksums)
 	})
 }
+
+func Test_verifyChecksumsCmd(t *testing.T) {
+	ts := testutil.ServeFile(t, testdataPath("downloadables/foo.tar.gz"), "/foo/foo.tar.gz", "")
+	fooURL := ts.URL + "/foo/foo.tar.gz"
+	badSum := "0000000000000000000000000000000000000000000000000000000000000000"
+	runner := newCmdRunner(t)
+	runner.writeConfigYaml(fmt.Sprintf(`
+systems: [linux/amd64]
+dependencies:
+  d1:
+    url: %q
+url_checksums:
+  %q: %s
+`, fooURL, fooURL, fooChecksum))
+	result := runner.run("checksums", "verify")
+	result.assertState(resultState{
+		stdout: `STATUS +URL +DEPENDENCIES +DETAILS\nok +` + regexp.QuoteMeta(fooURL) + ` +d1`,
+	})
+
+	runner.writeConfigYaml(fmt.Sprintf(`
+systems: [linux/amd64]
+dependencies:
+  d1:
+    url: %q
+url_checksums:
+  %q: %q
+  unused: %q
+`, fooURL, fooURL, badSum, badSum))
+	result = runner.run("checksums", "verify")
+	result.assertState(resultState{
+		stdout: `mismatch +` + regexp.QuoteMeta(fooURL) + ` +d1 +wanted 0+ got ` + fooChecksum + `\nunused +unused`,
+		stderr: `cmd: error: found 1 problems with checksums`,
+		exit:   1,
+	})
+	require.Equal(t, badSum, runner.getConfigFile().URLChecksums[fooURL])
+
+	result = runner.run("--json", "checksums", "verify", "--dependency", "d1")
+	result.assertState(resultState{
+		stdout: `"status": "mismatch"`,
+		stderr: `cmd: error: found 1 problems with checksums`,
+		exit:   1,
+	})
+
+	runner.writeConfigYaml(fmt.Sprintf(`
+systems: [linux/amd64]
+dependencies:
+  d1:
+    url: %q
+url_checksums:
+  %q: %s
+  unused: %q
+`, fooURL, fooURL, fooChecksum, badSum))
+	result = runner.run("checksums", "verify")
+	result.assertState(resultState{
+		stdout: `ok +` + regexp.QuoteMeta(fooURL) + ` +d1 *\nunused +unused`,
+	})
+}
+
+func Test_importChecksumsCmd(t *testing.T) {
+	runner := newCmdRunner(t)
+	runner.cache = ""
+	runner.writeConfigYaml(`
+systems: [darwin/amd64, linux/amd64]
+dependencies:
+  d1:
+    url: https://example.com/d1_{{.os}}_{{.arch}}.tar.gz
+`)
+	manifest := filepath.Join(runner.tmpDir, "SHA256SUMS")
+	require.NoError(t, os.WriteFile(manifest, []byte(fooChecksum+"  d1_darwin_amd64.tar.gz\n"), 0o600))
+	result := runner.run("checksums", "import", manifest, "--dependency", "d1")
+	result.assertState(resultState{
+		stdout: `no checksum for d1 on linux/amd64: https://example.com/d1_linux_amd64.tar.gz`,
+	})
+	runner.assertConfigYaml(fmt.Sprintf(`
+systems: [darwin/amd64, linux/amd64]
+dependencies:
+  d1:
+    url: https://example.com/d1_{{.os}}_{{.arch}}.tar.gz
+url_checksums:
+  https://example.com/d1_darwin_amd64.tar.gz: %s
+`, fooChecksum))
+}
+
+func Test_importChecksumsCmd_goreleaser(t *testing.T) {
+	runner := newCmdRunner(t)
+	runner.cache = ""
+	runner.writeConfigYaml(`
+systems: [darwin/amd64, linux/amd64]
+dependencies:
+  d1:
+    url: https://example.com/d1_{{.version}}_{{.os}}_{{.arch}}.tar.gz
+    vars:
+      version: 1.2.3
+`)
+	result := runner.run("checksums", "import", testdataPath("checksums/checksums.txt"), "--dependency", "d1")
+	result.assertState(resultState{})
+	runner.assertConfigYaml(fmt.Sprintf(`
+systems: [darwin/amd64, linux/amd64]
+dependencies:
+  d1:
+    url: https://example.com/d1_{{.version}}_{{.os}}_{{.arch}}.tar.gz
+    vars:
+      version: 1.2.3
+url_checksums:
+  https://example.com/d1_1.2.3_darwin_amd64.tar.gz: %s
+  https://example.com/d1_1.2.3_linux_amd64.tar.gz: 27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3
+`, fooChecksum))
+}
+
+func Test_toLockfileChecksumsCmd(t *testing.T) {
+	ts := testutil.ServeFile(t, testdataPath("downloadables/foo.tar.gz"), "/foo/foo.tar.gz", "")
+	fooURL := ts.URL + "/foo/foo.tar.gz"
+	runner := newCmdRunner(t)
+	runner.cache = ""
+	runner.writeConfigYaml(fmt.Sprintf(`
+dependencies:
+  d1:
+    url: %q
+url_checksums:
+  foo: bar
+`, fooURL))
+	lockfile := filepath.Join(runner.tmpDir, "bindown.lock")
+
+	result := runner.run("checksums", "to-lockfile")
+	result.assertState(resultState{})
+	runner.assertConfigYaml(fmt.Sprintf(`
+dependencies:
+  d1:
+    url: %q
+`, fooURL))
+	lock, err := os.ReadFile(lockfile)
+	require.NoError(t, err)
+	require.Equal(t, `# This file is generated by bindown. Do not edit it by hand.
+url_checksums:
+  foo: bar
+`, string(lock))
+
+	result = runner.run("checksums", "prune")
+	result.assertState(resultState{})
+	result = runner.run("checksums", "add", "--system", "linux/amd64")
+	result.assertState(resultState{})
+	require.Equal(t, map[string]string{fooURL: fooChecksum}, runner.getConfigFile().URLChecksums)
+	runner.assertConfigYaml(fmt.Sprintf(`
+dependencies:
+  d1:
+    url: %q
+`, fooURL))
+
+	result = runner.run("checksums", "to-inline")
+	result.assertState(resultState{})
+	require.NoFileExists(t, lockfile)
+	runner.assertConfigYaml(fmt.Sprintf(`
+dependencies:
+  d1:
+    url: %q
+url_checksums:
+  %s: %s
+`, fooURL, fooURL, fooChecksum))
+}
@@ -2,21 +2,27 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/willabides/bindown/v4/internal/bindown"
+	"github.com/willabides/bindown/v4/internal/httpclient"
 	"github.com/willabides/kongplete"
 )
 
 var kongVars = kong.Vars{
-	"configfile_help":                 `file with bindown config. default is the first one of bindown.yml, bindown.yaml, bindown.json, .bindown.yml, .bindown.yaml or .bindown.json`,
+	"configfile_help":                 `file with bindown config. default is the first one of bindown.yml, bindown.yaml, bindown.json, bindown.toml, .bindown.yml, .bindown.yaml, .bindown.json or .bindown.toml in the current directory or its parents up to the repository root`,
 	"cache_help":                      `directory downloads will be cached`,
+	"shared_cache_help":               `use the cache shared by all projects in the user cache directory instead of the project's cache. --cache takes precedence`,
+	"shared_cache_dir_help":           `directory for the shared cache. implies --shared-cache. default is bindown/cache in the user cache directory`,
+	"seal_cache_help":                 `remove write permission from cached files so tools can't change them. overrides seal_cache in the config`,
 	"install_help":                    `download, extract and install a dependency`,
 	"wrap_help":                       `create a wrapper script for a dependency`,
 	"system_default":                  string(bindown.CurrentSystem),
@@ -25,8 +31,33 @@ var kongVars = kong.Vars{
 	"add_checksums_help":              `add checksums to the config file`,
 	"prune_checksums_help":            `remove unnecessary checksums from the config file`,
 	"sync_checksums_help":             `add checksums to the config file and remove unnecessary checksums`,
+	"import_checksums_help":           `add checksums from a checksums file like SHA256SUMS or checksums.txt`,
+	"checksums_import_source_help":    `checksums file or http(s) url to import from`,
+	"checksums_import_algorithm_help": `algorithm of the checksums in the checksums file. defaults to the algorithm in the file's name like SHA256SUMS or checksums.sha512, then to sha256 or sha512 by length`,
+	"verify_checksums_help":           `download files and report checksums that don't match, can't be downloaded or aren't used. exits with an error when any don't match or can't be downloaded`,
+	"to_lockfile_checksums_help":      `move checksums from the config file to bindown.lock`,
+	"cache_verify_help":               `check cached downloads, extracts and installs for changes or damage`,
+	"cache_list_help":                 `list cache entries with the dependency each was created for`,
+	"cache_clear_all_help":            `clear the shared cache even though other projects use it`,
+	"cache_info_help":                 `show everything recorded about cache entries`,
+	"cache_info_key_help":             `cache key or dependency name`,
+	"cache_prune_help":                `remove cache entries that are no longer needed`,
+	"cache_prune_unreachable_help":    `remove entries that no dependency in the config uses`,
+	"cache_prune_unused_days_help":    `remove entries that haven't been used in this many days. 0 doesn't remove anything by age`,
+	"cache_prune_max_size_help":       `remove the least recently used entries until the cache is no bigger than this. units are binary so 500M is 500 MiB. must be greater than zero`,
+	"cache_prune_dry_run_help":        `show what would be removed without removing anything`,
+	"cache_verify_repair_help":        `remove damaged entries and download, extract or install them again`,
+	"to_inline_checksums_help":        `move checksums from bindown.lock to the config file`,
 	"config_format_help":              `formats the config file`,
 	"config_validate_help":            `validate that installs work`,
+	"config_show_help":                `show the config`,
+	"config_show_effective_help":      `show the effective config after merging imports and the local overlay, including the file each value came from`,
+	"config_migrate_help":             `upgrade the config file to the latest config version`,
+	"config_migrate_dry_run_help":     `show a diff of the changes instead of writing them`,
+	"config_convert_help":             `convert the config file and its local overlay to another format`,
+	"config_convert_to_help":          `the format to convert to`,
+	"config_lint_help":                `check the config for problems like unused templates and vars, overrides that can't match and missing required vars`,
+	"config_lint_fail_on_help":        `exit with an error when there are problems with this severity or higher`,
 	"config_install_completions_help": `install shell completions`,
 	"config_extract_path_help":        `output path to directory where the downloaded archive is extracted`,
 	"install_force_help":              `force install even if it already exists`,
@@ -36,18 +67,38 @@ var kongVars = kong.Vars{
 	"download_help":                   `download a dependency but don't extract or install it`,
 	"extract_help":                    `download and extract a dependency but don't install it`,
 	"checksums_dep_help":              `name of the dependency to update`,
+	"checksums_verify_dep_help":       `name of the dependency to verify. unused checksums are only reported when no dependencies or systems are given`,
+	"checksums_algorithm_help":        `checksum algorithm for new checksums. existing checksums with a different algorithm are verified and replaced. defaults to keeping existing checksums and using sha256 for new ones`,
 	"all_deps_help":                   `select all dependencies`,
 	"dependency_help":                 `name of dependency`,
 	"install_to_cache_help":           `install to cache instead of install dir`,
 	"install_wrapper_help":            `install a wrapper script instead of the binary`,
 	"install_bindown_help":            `path to bindown executable to use in wrapper`,
+	"connect_timeout_help":            `how long to wait to connect to a server`,
+	"read_timeout_help":               `how long to wait for a server to respond or send more of a download`,
+	"retries_help":                    `how many times to retry downloads that fail with a connection error or a 5xx or 429 status`,
+	"ca_file_help":                    `file with PEM encoded certificates to trust in addition to the system's`,
+	"url_rewrite_help":                `rewrite download urls to a mirror that is tried before the original url. either <prefix>=<replacement> or regex:<regex>=<replacement>. BINDOWN_URL_REWRITES separates rules with spaces`,
+	"proxy_help":                      `proxy url for all requests. default is from HTTP_PROXY, HTTPS_PROXY and NO_PROXY`,
+	"offline_help":                    `don't make any network requests. fail when a download isn't in the cache`,
 }
 
 type rootCmd struct {
-	JSONConfig bool   `kong:"name=json,help='treat config file as json instead of yaml'"`
-	Configfile string `kong:"type=path,help=${configfile_help},env='BINDOWN_CONFIG_FILE'"`
-	CacheDir   string `kong:"name=cache,type=path,help=${cache_help},env='BINDOWN_CACHE'"`
-	Quiet      bool   `kong:"short='q',help='suppress output to stdout'"`
+	JSONConfig     bool   `kong:"name=json,help='treat config file as json instead of yaml'"`
+	Configfile     string `kong:"type=path,help=${configfile_help},env='BINDOWN_CONFIG_FILE'"`
+	CacheDir       string `kong:"name=cache,type=path,help=${cache_help},env='BINDOWN_CACHE'"`
+	SharedCache    bool   `kong:"help=${shared_cache_help},env='BINDOWN_SHARED_CACHE'"`
+	SharedCacheDir string `kong:"type=path,help=${shared_cache_dir_help},env='BINDOWN_SHARED_CACHE_DIR'"`
+	SealCache      *bool  `kong:"negatable,help=${seal_cache_help},env='BINDOWN_SEAL_CACHE'"`
+	Quiet          bool   `kong:"short='q',help='suppress output to stdout'"`
+
+	ConnectTimeout time.Duration `kong:"default=30s,help=${connect_timeout_help},env='BINDOWN_CONNECT_TIMEOUT'"`
+	ReadTimeout    time.Duration `kong:"default=60s,help=${read_timeout_help},env='BINDOWN_READ_TIMEOUT'"`
+	Retries        int           `kong:"default=3,help=${retries_help},env='BINDOWN_RETRIES'"`
+	CAFile         string        `kong:"name=ca-file,type=path,help=${ca_file_help},env='BINDOWN_CA_FILE'"`
+	Proxy          string        `kong:"help=${proxy_help},env='BINDOWN_PROXY'"`
+	URLRewrites    []string      `kong:"name=url-rewrite,sep=' ',placeholder=<prefix>=<replacement>,help=${url_rewrite_help},env='BINDOWN_URL_REWRITES'"`
+	Offline        bool          `kong:"help=${offline_help},env='BINDOWN_OFFLINE'"`
 
 	Download        downloadCmd        `kong:"cmd,help=${download_help}"`
 	Extract         extractCmd         `kong:"cmd,help=${extract_help}"`
@@ -60,6 +111,7 @@ type rootCmd struct {
 	SupportedSystem supportedSystemCmd `kong:"cmd,help='manage supported systems'"`
 	Checksums       checksumsCmd       `kong:"cmd,help='manage checksums'"`
 	Init            initCmd            `kong:"cmd,help='create an empty config file'"`
+	Config          configCmd          `kong:"cmd,help='manage the config file'"`
 	Cache           cacheCmd           `kong:"cmd,help='manage the cache'"`
 	Bootstrap       bootstrapCmd       `kong:"cmd,help='create bootstrap script for bindown'"`
 
@@ -84,36 +136,168 @@ func (r *rootCmd) BeforeApply(k *kong.Context) error {
 	return nil
 }
 
+// clearCacheFlags stops the cache flags from changing the cache in the config. It is for commands that write the
+// config file.
+func (r *rootCmd) clearCacheFlags() {
+	r.CacheDir = ""
+	r.SharedCache = false
+	r.SharedCacheDir = ""
+}
+
+// httpClient returns the client for downloads configured by r's flags.
+func (r *rootCmd) httpClient() (*httpclient.Client, error) {
+	userAgent := "bindown"
+	if version := getVersion(); version != "" {
+		userAgent += "/" + version
+	}
+	return httpclient.New(httpclient.Options{
+		ConnectTimeout: r.ConnectTimeout,
+		ReadTimeout:    r.ReadTimeout,
+		RootCAFile:     r.CAFile,
+		Proxy:          r.Proxy,
+		UserAgent:      userAgent,
+		Retries:        r.Retries,
+		Offline:        r.Offline,
+	})
+}
+
 var defaultConfigFilenames = []string{
 	"bindown.yml",
 	"bindown.yaml",
 	"bindown.json",
+	"bindown.toml",
 	".bindown.yml",
 	".bindown.yaml",
 	".bindown.json",
+	".bindown.toml",
 }
 
 func loadConfigFile(ctx *runContext, noDefaultDirs bool) (*bindown.Config, error) {
-	filename := ctx.rootCmd.Configfile
+	filename, err := configFilename(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return loadConfigFilename(ctx, filename, noDefaultDirs)
+}
+
+// loadConfigFileForUpdate is loadConfigFile for commands that write the config. It holds the locks for every local
+// file the config may write until the command finishes, so concurrent updates are serialized. The files aren't known
+// until the config is loaded, so it is loaded again after locking and the locks are retried if the files changed.
+// extraFiles are locked too.
+func loadConfigFileForUpdate(ctx *runContext, noDefaultDirs bool, extraFiles ...string) (*bindown.Config, error) {
+	filename, err := configFilename(ctx)
+	if err != nil {
+		return nil, err
+	}
 	if filename == "" {
-		for _, configFilename := range defaultConfigFilenames {
-			info, err := os.Stat(configFilename)
-			if err == nil && !info.IsDir() {
-				filename = configFilename
-				break
-			}
+		return loadConfigFilename(ctx, filename, noDefaultDirs)
+	}
+	files := append([]string{filename}, extraFiles...)
+	for {
+		lock, err := bindown.LockConfigFiles(files...)
+		if err != nil {
+			return nil, err
+		}
+		config, err := loadConfigFilename(ctx, filename, noDefaultDirs)
+		if err != nil {
+			return nil, errors.Join(err, lock.Close())
+		}
+		want := append(config.LocalFiles(), extraFiles...)
+		if slices.Equal(files, want) {
+			ctx.closers = append(ctx.closers, lock)
+			return config, nil
 		}
+		files = want
+		err = lock.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func configFilename(ctx *runContext) (string, error) {
+	if ctx.rootCmd.Configfile != "" {
+		return ctx.rootCmd.Configfile, nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
 	}
+	return findConfigFile(wd), nil
+}
+
+func loadConfigFilename(ctx *runContext, filename string, noDefaultDirs bool) (*bindown.Config, error) {
 	configFile, err := bindown.NewConfig(ctx, filename, noDefaultDirs)
 	if err != nil {
 		return nil, err
 	}
-	if ctx.rootCmd.CacheDir != "" {
+	err = loadOverlay(ctx, configFile, filename)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case ctx.rootCmd.CacheDir != "":
 		configFile.Cache = ctx.rootCmd.CacheDir
+	case noDefaultDirs:
+		// noDefaultDirs is for commands that don't use the cache, so they don't need the shared cache
+	case ctx.rootCmd.SharedCacheDir != "":
+		configFile.UseSharedCache(ctx.rootCmd.SharedCacheDir)
+	case ctx.rootCmd.SharedCache:
+		err = configFile.UseDefaultSharedCache()
+		if err != nil {
+			return nil, err
+		}
+	}
+	// noDefaultDirs is for commands that don't use the cache, and some of them write the config
+	if ctx.rootCmd.SealCache != nil && !noDefaultDirs {
+		configFile.SealCache = ctx.rootCmd.SealCache
 	}
+	rewrites := make([]bindown.URLRewrite, 0, len(ctx.rootCmd.URLRewrites))
+	for _, s := range ctx.rootCmd.URLRewrites {
+		rewrite, err := bindown.ParseURLRewrite(s)
+		if err != nil {
+			return nil, err
+		}
+		rewrites = append(rewrites, rewrite)
+	}
+	configFile.AddURLRewrites(rewrites...)
 	return configFile, nil
 }
 
+// findConfigFile searches dir and its parents for one of defaultConfigFilenames the way git finds .git. The search
+// stops after the root of the git repository containing dir or at the filesystem root. Returns "" when no config file
+// is found.
+func findConfigFile(dir string) string {
+	for {
+		for _, configFilename := range defaultConfigFilenames {
+			filename := filepath.Join(dir, configFilename)
+			info, err := os.Stat(filename)
+			if err == nil && !info.IsDir() {
+				return filename
+			}
+		}
+		_, err := os.Stat(filepath.Join(dir, ".git"))
+		if err == nil {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadOverlay applies the local overlay for filename to cfg if the overlay file exists.
+func loadOverlay(ctx context.Context, cfg *bindown.Config, filename string) error {
+	overlayFile := bindown.OverlayFilename(filename)
+	info, err := os.Stat(overlayFile)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+	return cfg.LoadOverlay(ctx, overlayFile)
+}
+
 // fileWriter covers terminal.FileWriter. Needed for survey
 type fileWriter interface {
 	io.Writer
@@ -140,6 +324,8 @@ type runContext struct {
 	stdout  fileWriter
 	stderr  fileWriter
 	rootCmd *rootCmd
+	// closers are closed after the command runs
+	closers []io.Closer
 }
 
 func newRunContext(ctx context.Context) *runContext {
@@ -216,7 +402,16 @@ func Run(ctx context.Context, args []string, opts *runOpts) {
 		runCtx.stdout = SimpleFileWriter{io.Discard}
 		kongCtx.Stdout = io.Discard
 	}
+	client, err := root.httpClient()
+	if err != nil {
+		kongCtx.FatalIfErrorf(err)
+		return
+	}
+	runCtx.parent = httpclient.NewContext(runCtx.parent, client)
 	err = kongCtx.Run()
+	for _, closer := range runCtx.closers {
+		err = errors.Join(err, closer.Close())
+	}
 	kongCtx.FatalIfErrorf(err)
 }
 
@@ -258,6 +453,7 @@ func (c *initCmd) Run(ctx *runContext) error {
 	}
 	cfg := &bindown.Config{
 		Filename: file.Name(),
+		Version:  bindown.CurrentConfigVersion,
 	}
 	return cfg.WriteFile(ctx.rootCmd.JSONConfig)
 }
@@ -265,11 +461,12 @@ func (c *initCmd) Run(ctx *runContext) error {
 type fmtCmd struct{}
 
 func (c fmtCmd) Run(ctx *runContext, cli *rootCmd) error {
-	ctx.rootCmd.CacheDir = ""
-	config, err := loadConfigFile(ctx, true)
+	ctx.rootCmd.clearCacheFlags()
+	config, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
+	config.DiscardFormatting()
 	return config.WriteFile(ctx.rootCmd.JSONConfig)
 }
 
@@ -310,7 +507,7 @@ func (d *installCmd) Run(ctx *runContext) error {
 		return err
 	}
 
-	return config.InstallDependencies(d.Dependency, d.System, &bindown.ConfigInstallDependenciesOpts{
+	return config.InstallDependencies(ctx, d.Dependency, d.System, &bindown.ConfigInstallDependenciesOpts{
 		Output:               d.Output,
 		Force:                d.Force,
 		AllowMissingChecksum: d.AllowMissingChecksum,
@@ -342,7 +539,7 @@ func (d *wrapCmd) Run(ctx *runContext) error {
 	if err != nil {
 		return err
 	}
-	return config.WrapDependencies(d.Dependency, &bindown.ConfigWrapDependenciesOpts{
+	return config.WrapDependencies(ctx, d.Dependency, &bindown.ConfigWrapDependenciesOpts{
 		Output:               d.Output,
 		AllowMissingChecksum: d.AllowMissingChecksum,
 		BindownExec:          d.BindownExec,
@@ -367,7 +564,7 @@ func (d *downloadCmd) Run(ctx *runContext) error {
 	if err != nil {
 		return err
 	}
-	return config.DownloadDependencies(d.Dependency, d.System, &bindown.ConfigDownloadDependenciesOpts{
+	return config.DownloadDependencies(ctx, d.Dependency, d.System, &bindown.ConfigDownloadDependenciesOpts{
 		Force:                d.Force,
 		AllowMissingChecksum: d.AllowMissingChecksum,
 		AllDeps:              d.All,
@@ -387,7 +584,7 @@ func (d *extractCmd) Run(ctx *runContext) error {
 	if err != nil {
 		return err
 	}
-	return config.ExtractDependencies(d.Dependency, d.System, &bindown.ConfigExtractDependenciesOpts{
+	return config.ExtractDependencies(ctx, d.Dependency, d.System, &bindown.ConfigExtractDependenciesOpts{
 		AllowMissingChecksum: d.AllowMissingChecksum,
 		AllDeps:              d.All,
 		Stdout:               ctx.stdout,
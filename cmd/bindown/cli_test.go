@@ -2,11 +2,15 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,7 +37,7 @@ func Test_fmtCmd(t *testing.T) {
 		runner.writeConfigYaml(`{"systems": [ "darwin/amd64", "linux/386" ]`)
 		result := runner.run("format")
 		result.assertState(resultState{
-			stderr: "cmd: error: config is not valid yaml (or json)",
+			stderr: `cmd: error: .+\.bindown\.yaml:1: config is not valid yaml \(or json\)`,
 			exit:   1,
 		})
 	})
@@ -55,6 +59,53 @@ func Test_fmtCmd(t *testing.T) {
 	})
 }
 
+func Test_findConfigFile(t *testing.T) {
+	t.Run("current directory", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".bindown.yaml"), nil, 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "bindown.yml"), nil, 0o600))
+		require.Equal(t, filepath.Join(dir, "bindown.yml"), findConfigFile(dir))
+	})
+
+	t.Run("toml", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".bindown.toml"), nil, 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "bindown.toml"), nil, 0o600))
+		require.Equal(t, filepath.Join(dir, "bindown.toml"), findConfigFile(dir))
+	})
+
+	t.Run("parent directory", func(t *testing.T) {
+		dir := t.TempDir()
+		subDir := filepath.Join(dir, "foo", "bar")
+		require.NoError(t, os.MkdirAll(subDir, 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "bindown.yml"), nil, 0o600))
+		require.Equal(t, filepath.Join(dir, "bindown.yml"), findConfigFile(subDir))
+	})
+
+	t.Run("stops at repository root", func(t *testing.T) {
+		dir := t.TempDir()
+		repoDir := filepath.Join(dir, "repo")
+		subDir := filepath.Join(repoDir, "foo")
+		require.NoError(t, os.MkdirAll(subDir, 0o750))
+		require.NoError(t, os.Mkdir(filepath.Join(repoDir, ".git"), 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "bindown.yml"), nil, 0o600))
+		require.Equal(t, "", findConfigFile(subDir))
+	})
+
+	t.Run("run from subdirectory", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml(`systems: ["darwin/amd64", "linux/amd64"]`)
+		subDir := filepath.Join(runner.tmpDir, "foo")
+		require.NoError(t, os.Mkdir(subDir, 0o750))
+		runner.configFile = ""
+		testInDir(t, subDir)
+		result := runner.run("supported-system", "list")
+		result.assertState(resultState{
+			stdout: "darwin/amd64\nlinux/amd64",
+		})
+	})
+}
+
 func Test_initCmd(t *testing.T) {
 	t.Run("default file", func(t *testing.T) {
 		runner := newCmdRunner(t)
@@ -65,7 +116,7 @@ func Test_initCmd(t *testing.T) {
 		result.assertState(resultState{})
 		content, err := os.ReadFile(".bindown.yaml")
 		require.NoError(t, err)
-		require.Equal(t, "{}\n", string(content))
+		require.Equal(t, "version: 1\n", string(content))
 	})
 
 	t.Run("default file already exists", func(t *testing.T) {
@@ -105,7 +156,7 @@ func Test_initCmd(t *testing.T) {
 		result.assertState(resultState{})
 		content, err := os.ReadFile("foo.yaml")
 		require.NoError(t, err)
-		require.Equal(t, "{}\n", string(content))
+		require.Equal(t, "version: 1\n", string(content))
 	})
 
 	t.Run("custom file in sub directory", func(t *testing.T) {
@@ -119,7 +170,7 @@ func Test_initCmd(t *testing.T) {
 		result.assertState(resultState{})
 		content, err := os.ReadFile("foo/bar.yaml")
 		require.NoError(t, err)
-		require.Equal(t, "{}\n", string(content))
+		require.Equal(t, "version: 1\n", string(content))
 	})
 
 	t.Run("custom file in sub directory that does not exist", func(t *testing.T) {
@@ -139,6 +190,36 @@ func Test_initCmd(t *testing.T) {
 	})
 }
 
+func Test_configEditLeavesCleanTree(t *testing.T) {
+	git, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not found")
+	}
+	runner := newCmdRunner(t)
+	runner.cache = ""
+	runner.configFile = ""
+	testInDir(t, runner.tmpDir)
+	runGit := func(args ...string) string {
+		t.Helper()
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		out, err := exec.Command(git, args...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+	runGit("init", "-q")
+	runner.run("init").assertState(resultState{})
+	runGit("add", "-A")
+	runGit("commit", "-q", "-m", "init")
+
+	runner.run("supported-system", "add", "linux/amd64").assertState(resultState{})
+	require.Equal(t, " M .bindown.yaml\n", runGit("status", "--porcelain", "--untracked-files=all"))
+	runGit("commit", "-q", "-am", "add system")
+
+	result := runner.run("dependency", "remove", "missing")
+	require.Equal(t, 1, result.exitVal)
+	require.Empty(t, runGit("status", "--porcelain", "--untracked-files=all"))
+}
+
 func Test_extractCmd(t *testing.T) {
 	servePath := testdataPath("downloadables/fooinroot.tar.gz")
 	successServer := testutil.ServeFile(t, servePath, "/foo/fooinroot.tar.gz", "")
@@ -229,7 +310,7 @@ url_checksums:
 		assertExtractSuccess(t, result)
 	})
 
-	t.Run("does not overwrite invalid cache", func(t *testing.T) {
+	t.Run("re-extracts invalid cache", func(t *testing.T) {
 		runner := newCmdRunner(t)
 		runner.writeConfigYaml(fmt.Sprintf(`
 dependencies:
@@ -258,10 +339,10 @@ url_checksums:
 		result.assertState(resultState{
 			stdout: "extracted foo to ",
 		})
-		// make sure the file was not overwritten
+		// make sure the file was extracted again
 		got, err := os.ReadFile(filepath.Join(extractDir, "foo"))
 		require.NoError(t, err)
-		assert.Equal(t, "foo", string(got))
+		assert.NotEqual(t, "foo", string(got))
 	})
 }
 
@@ -308,7 +389,7 @@ dependencies:
 `)
 		result := runner.run("download", "foo")
 		result.assertState(resultState{
-			stderr: `cmd: error: dependency "foo" has no URL`,
+			stderr: `cmd: error: .+\.bindown\.yaml:3:8: dependency "foo" has no URL`,
 			exit:   1,
 		})
 	})
@@ -322,7 +403,7 @@ dependencies:
 `)
 		result := runner.run("download", "foo")
 		result.assertState(resultState{
-			stderr: `cmd: error: error applying template`,
+			stderr: `cmd: error: .+\.bindown\.yaml:4:10: dependency "foo" url: error applying template: .+map has no entry for key "MISSING_VAR"`,
 			exit:   1,
 		})
 	})
@@ -397,6 +478,149 @@ dependencies:
 		result = runner.run("download", "foo", "--allow-missing-checksum")
 		assertDownloadSuccess(t, result)
 	})
+
+	t.Run("--retries", func(t *testing.T) {
+		var requests atomic.Int32
+		var userAgent atomic.Value
+		flakyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			userAgent.Store(req.UserAgent())
+			if requests.Add(1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			http.ServeFile(w, req, servePath)
+		}))
+		t.Cleanup(flakyServer.Close)
+		flakyURL := flakyServer.URL + "/foo/fooinroot.tar.gz"
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml(fmt.Sprintf(`
+url_checksums:
+  %s: 27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3
+dependencies:
+  foo:
+    url: %s
+`, flakyURL, flakyURL))
+		result := runner.run("download", "foo", "--retries=0")
+		result.assertState(resultState{
+			stderr: `cmd: error: failed downloading`,
+			exit:   1,
+		})
+		result = runner.run("download", "foo", "--retries=1")
+		assertDownloadSuccess(t, result)
+		require.Equal(t, int32(3), requests.Load())
+		require.Equal(t, "bindown", userAgent.Load())
+	})
+
+	t.Run("BINDOWN_URL_REWRITES", func(t *testing.T) {
+		upstreamURL := "https://example.invalid/foo/fooinroot.tar.gz"
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml(fmt.Sprintf(`
+url_checksums:
+  %s: 27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3
+dependencies:
+  foo:
+    url: %s
+`, upstreamURL, upstreamURL))
+		t.Setenv("BINDOWN_URL_REWRITES", "https://other.invalid/=https://other.invalid/mirror/ https://example.invalid/="+successServer.URL+"/")
+		result := runner.run("download", "foo")
+		assertDownloadSuccess(t, result)
+
+		result = runner.run("download", "foo", "--force", "--url-rewrite", "https://example.invalid")
+		result.assertState(resultState{
+			stderr: `cmd: error: invalid url rewrite "https://example.invalid"`,
+			exit:   1,
+		})
+	})
+
+	t.Run("BINDOWN_OFFLINE", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml(fmt.Sprintf(`
+url_checksums:
+  %s: 27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3
+dependencies:
+  foo:
+    url: %s
+`, depURL, depURL))
+		t.Setenv("BINDOWN_OFFLINE", "1")
+		result := runner.run("download", "foo")
+		result.assertState(resultState{
+			stderr: `cmd: error: offline: foo is not cached: ` + regexp.QuoteMeta(depURL),
+			exit:   1,
+		})
+
+		result = runner.run("download", "foo", "--offline=false")
+		assertDownloadSuccess(t, result)
+		result = runner.run("download", "foo")
+		assertDownloadSuccess(t, result)
+	})
+
+	t.Run("BINDOWN_SHARED_CACHE_DIR", func(t *testing.T) {
+		config := fmt.Sprintf(`
+url_checksums:
+  %s: 27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3
+dependencies:
+  foo:
+    url: %s
+`, depURL, depURL)
+		sharedDir := filepath.Join(testTmp(t), "shared")
+		t.Setenv("BINDOWN_SHARED_CACHE_DIR", sharedDir)
+		runner1 := newCmdRunner(t)
+		runner1.cache = ""
+		runner1.writeConfigYaml(config)
+		runner2 := newCmdRunner(t)
+		runner2.cache = ""
+		runner2.writeConfigYaml(config)
+
+		result := runner1.run("download", "foo")
+		result.assertState(resultState{
+			stdout: "downloaded foo to " + regexp.QuoteMeta(filepath.Join(sharedDir, "downloads", "27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3-fooinroot.tar.gz", "fooinroot.tar.gz")),
+		})
+		// the second project uses the first project's download
+		result = runner2.run("download", "foo", "--offline")
+		assertDownloadSuccess(t, result)
+		require.NoDirExists(t, filepath.Join(runner2.tmpDir, ".bindown"))
+
+		result = runner2.run("download", "foo", "--offline", "--cache", filepath.Join(runner2.tmpDir, "cache"))
+		result.assertState(resultState{
+			stderr: `cmd: error: offline: foo is not cached`,
+			exit:   1,
+		})
+
+		result = runner2.run("cache", "prune", "--unreachable")
+		result.assertState(resultState{
+			stderr: `cmd: error: can't prune unreachable entries from a shared cache`,
+			exit:   1,
+		})
+
+		result = runner2.run("cache", "clear")
+		result.assertState(resultState{
+			stderr: `cmd: error: can't clear a shared cache because other projects use it`,
+			exit:   1,
+		})
+		require.DirExists(t, filepath.Join(sharedDir, "downloads"))
+
+		result = runner2.run("cache", "clear", "--all")
+		result.assertState(resultState{})
+		require.NoDirExists(t, sharedDir)
+	})
+
+	t.Run("--ca-file", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml(fmt.Sprintf(`
+url_checksums:
+  %s: 27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3
+dependencies:
+  foo:
+    url: %s
+`, depURL, depURL))
+		caFile := filepath.Join(runner.tmpDir, "ca.pem")
+		require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0o600))
+		result := runner.run("download", "foo", "--ca-file", caFile)
+		result.assertState(resultState{
+			stderr: `cmd: error: no certificates found in .+ca\.pem`,
+			exit:   1,
+		})
+	})
 }
 
 func Test_installCmd(t *testing.T) {
@@ -508,6 +732,53 @@ url_checksums:
 		require.Equal(t, "Hello world", strings.TrimSpace(string(out)))
 	})
 
+	t.Run("shared cache", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.cache = ""
+		servePath := testdataPath("downloadables/runnable.tar.gz")
+		ts := testutil.ServeFile(t, servePath, "/runnable/runnable.tar.gz", "")
+		depURL := ts.URL + "/runnable/runnable.tar.gz"
+		runner.writeConfigYaml(fmt.Sprintf(`
+dependencies:
+  runnable:
+    archive_path: bin/runnable.sh
+    url: %s
+url_checksums:
+    %s: fb2fe41a34b77ee180def0cb9a222d8776a6e581106009b64f35983da291ab6e
+`, depURL, depURL))
+		sharedDir := filepath.Join(testTmp(t), "shared")
+		t.Setenv("BINDOWN_SHARED_CACHE_DIR", sharedDir)
+		runnable := filepath.Join(runner.tmpDir, "output", "runnable")
+		result := runner.run("wrap", "runnable", "--bindown", testutil.BindownBin(), "--output", runnable)
+		result.assertState(resultState{stdout: runnable})
+		content, err := os.ReadFile(runnable)
+		require.NoError(t, err)
+		require.Contains(t, string(content), fmt.Sprintf("--shared-cache-dir %q", filepath.ToSlash(sharedDir)))
+		require.NotContains(t, string(content), "--cache")
+
+		// the wrapper uses the shared cache it was created with
+		cmd := exec.Command("sh", "-c", filepath.ToSlash(runnable))
+		for _, env := range os.Environ() {
+			if !strings.HasPrefix(env, "BINDOWN_SHARED_CACHE_DIR=") {
+				cmd.Env = append(cmd.Env, env)
+			}
+		}
+		out, err := cmd.Output()
+		require.NoError(t, err)
+		require.Equal(t, "Hello world", strings.TrimSpace(string(out)))
+		require.DirExists(t, filepath.Join(sharedDir, "bin"))
+
+		// the default shared cache is found by the wrapper at runtime
+		t.Setenv("BINDOWN_SHARED_CACHE_DIR", "")
+		t.Setenv("BINDOWN_SHARED_CACHE", "1")
+		result = runner.run("wrap", "runnable", "--bindown", testutil.BindownBin(), "--output", runnable)
+		result.assertState(resultState{stdout: runnable})
+		content, err = os.ReadFile(runnable)
+		require.NoError(t, err)
+		require.Contains(t, string(content), "--shared-cache\n")
+		require.NotContains(t, string(content), "--shared-cache-dir")
+	})
+
 	t.Run("wrap bindown", func(t *testing.T) {
 		runner := newCmdRunner(t)
 		servePath := testdataPath("downloadables/runnable.tar.gz")
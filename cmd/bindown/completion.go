@@ -24,12 +24,11 @@ func findConfigFileForCompletion(args []string) string {
 	if ok {
 		return prepCompletionConfigFile(cf)
 	}
-	for _, cf := range defaultConfigFilenames {
-		if _, err := os.Stat(cf); err == nil {
-			return prepCompletionConfigFile(cf)
-		}
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
 	}
-	return prepCompletionConfigFile("")
+	return prepCompletionConfigFile(findConfigFile(wd))
 }
 
 func getCompletionSource(args []string) string {
@@ -67,6 +66,10 @@ func completionConfig(ctx context.Context, args []string) *bindown.Config {
 	if err != nil {
 		return nil
 	}
+	err = loadOverlay(ctx, configFile, path)
+	if err != nil {
+		return nil
+	}
 	return configFile
 }
 
@@ -15,8 +15,10 @@ import (
 func Test_findConfigFileForCompletion(t *testing.T) {
 	t.Run("default", func(t *testing.T) {
 		t.Run("missing default", func(t *testing.T) {
-			got := findConfigFileForCompletion([]string{})
-			require.Equal(t, "", got)
+			inDir(t, t.TempDir(), func() {
+				got := findConfigFileForCompletion([]string{})
+				require.Equal(t, "", got)
+			})
 		})
 
 		t.Run("exists", func(t *testing.T) {
@@ -33,6 +35,19 @@ func Test_findConfigFileForCompletion(t *testing.T) {
 				require.Equal(t, string(want), string(gotContent))
 			})
 		})
+
+		t.Run("parent directory", func(t *testing.T) {
+			dir := t.TempDir()
+			configFile := filepath.Join(dir, "bindown.yml")
+			err := os.WriteFile(configFile, nil, 0o600)
+			require.NoError(t, err)
+			subDir := filepath.Join(dir, "foo", "bar")
+			require.NoError(t, os.MkdirAll(subDir, 0o750))
+			inDir(t, subDir, func() {
+				got := findConfigFileForCompletion([]string{})
+				require.Equal(t, configFile, got)
+			})
+		})
 	})
 
 	t.Run("from command line", func(t *testing.T) {
@@ -52,8 +67,10 @@ func Test_findConfigFileForCompletion(t *testing.T) {
 func Test_completionConfig(t *testing.T) {
 	ctx := context.Background()
 	t.Run("no config file", func(t *testing.T) {
-		got := completionConfig(ctx, []string{})
-		require.Nil(t, got)
+		inDir(t, t.TempDir(), func() {
+			got := completionConfig(ctx, []string{})
+			require.Nil(t, got)
+		})
 	})
 
 	t.Run("valid config file", func(t *testing.T) {
@@ -78,7 +95,10 @@ func Test_completionConfig(t *testing.T) {
 
 func Test_binCompleter(t *testing.T) {
 	ctx := context.Background()
-	got := binCompleter(ctx).Predict(complete.Args{})
+	var got []string
+	inDir(t, t.TempDir(), func() {
+		got = binCompleter(ctx).Predict(complete.Args{})
+	})
 	require.Empty(t, got)
 	require.NotNil(t, got)
 
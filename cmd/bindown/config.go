@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/willabides/bindown/v4/internal/bindown"
+)
+
+type configCmd struct {
+	Show    configShowCmd    `kong:"cmd,help=${config_show_help}"`
+	Migrate configMigrateCmd `kong:"cmd,help=${config_migrate_help}"`
+	Lint    configLintCmd    `kong:"cmd,help=${config_lint_help}"`
+	Convert configConvertCmd `kong:"cmd,help=${config_convert_help}"`
+}
+
+type configShowCmd struct {
+	Effective bool `kong:"help=${config_show_effective_help}"`
+}
+
+func (c *configShowCmd) Run(ctx *runContext) error {
+	cfg, err := loadConfigFile(ctx, true)
+	if err != nil {
+		return err
+	}
+	if !c.Effective {
+		cfg = cfg.RootConfig()
+	}
+	if ctx.rootCmd.JSONConfig {
+		encoder := json.NewEncoder(ctx.stdout)
+		encoder.SetIndent("", "  ")
+		if !c.Effective {
+			return encoder.Encode(cfg)
+		}
+		return encoder.Encode(map[string]any{
+			"config":  cfg,
+			"sources": cfg.Sources(),
+		})
+	}
+	if !c.Effective {
+		return bindown.EncodeYaml(ctx.stdout, cfg)
+	}
+	return cfg.EncodeEffectiveYaml(ctx.stdout)
+}
+
+type configMigrateCmd struct {
+	DryRun bool `kong:"help=${config_migrate_dry_run_help}"`
+}
+
+func (c *configMigrateCmd) Run(ctx *runContext) error {
+	ctx.rootCmd.clearCacheFlags()
+	cfg, err := loadConfigFileForUpdate(ctx, true)
+	if err != nil {
+		return err
+	}
+	applied, err := cfg.Migrate()
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Fprintf(ctx.stdout, "config is already at the latest version (%d)\n", bindown.CurrentConfigVersion)
+		return nil
+	}
+	if c.DryRun {
+		diff, err := cfg.Diff(ctx.rootCmd.JSONConfig)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(ctx.stdout, diff)
+		return nil
+	}
+	err = cfg.WriteFile(ctx.rootCmd.JSONConfig)
+	if err != nil {
+		return err
+	}
+	for _, migration := range applied {
+		fmt.Fprintf(ctx.stdout, "migrated to %s\n", migration)
+	}
+	return nil
+}
+
+type configLintCmd struct {
+	FailOn string `kong:"name=fail-on,enum='info,warning,error',default=error,help=${config_lint_fail_on_help}"`
+}
+
+func (c *configLintCmd) Run(ctx *runContext) error {
+	threshold, err := bindown.ParseSeverity(c.FailOn)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfigFile(ctx, true)
+	if err != nil {
+		return err
+	}
+	diagnostics := cfg.Lint()
+	if ctx.rootCmd.JSONConfig {
+		if diagnostics == nil {
+			diagnostics = []bindown.Diagnostic{}
+		}
+		encoder := json.NewEncoder(ctx.stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(diagnostics)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, d := range diagnostics {
+			fmt.Fprintln(ctx.stdout, d)
+		}
+	}
+	failures := 0
+	for _, d := range diagnostics {
+		if d.Severity >= threshold {
+			failures++
+		}
+	}
+	if failures > 0 {
+		return fmt.Errorf("found %d problems with severity %s or higher", failures, threshold)
+	}
+	return nil
+}
+
+type configConvertCmd struct {
+	To string `kong:"required,enum='yaml,json,toml',help=${config_convert_to_help}"`
+}
+
+func (c *configConvertCmd) Run(ctx *runContext) error {
+	ctx.rootCmd.clearCacheFlags()
+	filename, err := configFilename(ctx)
+	if err != nil {
+		return err
+	}
+	ext := filepath.Ext(filename)
+	newExt := "." + c.To
+	if ext == ".yml" && c.To == "yaml" {
+		newExt = ext
+	}
+	if ext == newExt {
+		return fmt.Errorf("%s is already %s", filename, c.To)
+	}
+	newFilename := strings.TrimSuffix(filename, ext) + newExt
+	// lock the new files too so nothing else writes them while they replace the old ones
+	cfg, err := loadConfigFileForUpdate(ctx, true, newFilename, bindown.OverlayFilename(newFilename))
+	if err != nil {
+		return err
+	}
+	oldFilename := cfg.Filename
+	err = cfg.Convert(newFilename)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.stdout, "converted %s to %s\n", oldFilename, cfg.Filename)
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_configShowCmd(t *testing.T) {
+	t.Run("effective", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml(`
+dependencies:
+  foo:
+    url: foo-url
+    vars:
+      version: 1.0.0
+`)
+		overlayFile := filepath.Join(runner.tmpDir, ".bindown.local.yaml")
+		err := os.WriteFile(overlayFile, []byte(`
+dependencies:
+  foo:
+    vars:
+      version: 2.0.0
+`), 0o600)
+		require.NoError(t, err)
+		result := runner.run("config", "show", "--effective")
+		result.assertStdOut(`
+cache: .+
+dependencies:
+  foo:
+    url: foo-url # from .+\.bindown\.yaml
+    vars:
+      version: 2.0.0 # from .+\.bindown\.local\.yaml`)
+	})
+
+	t.Run("root only", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml(`
+dependencies:
+  foo:
+    url: foo-url
+`)
+		overlayFile := filepath.Join(runner.tmpDir, ".bindown.local.yaml")
+		err := os.WriteFile(overlayFile, []byte(`
+dependencies:
+  bar:
+    url: bar-url
+`), 0o600)
+		require.NoError(t, err)
+		result := runner.run("config", "show")
+		result.assertState(resultState{
+			stdout: `cache: .+
+dependencies:
+  foo:
+    url: foo-url`,
+		})
+	})
+}
+
+func Test_configMigrateCmd(t *testing.T) {
+	t.Run("dry run", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml("systems: [linux/amd64]\n")
+		result := runner.run("config", "migrate", "--dry-run")
+		result.assertState(resultState{
+			stdout: `--- .+\.bindown\.yaml
+\+\+\+ .+\.bindown\.yaml
+@@ -1 \+1,2 @@
+\+version: 1
+ systems: \[linux/amd64\]`,
+		})
+		runner.assertConfigYaml("systems: [linux/amd64]\n")
+	})
+
+	t.Run("migrate", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml("systems: [linux/amd64]\n")
+		result := runner.run("config", "migrate")
+		result.assertState(resultState{
+			stdout: "migrated to version 1: default the cache directory to .bindown",
+		})
+		runner.assertConfigYaml("version: 1\nsystems: [linux/amd64]\n")
+
+		result = runner.run("config", "migrate")
+		result.assertState(resultState{
+			stdout: `config is already at the latest version \(1\)`,
+		})
+	})
+
+	t.Run("newer version", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml("version: 99\n")
+		result := runner.run("config", "migrate")
+		result.assertState(resultState{
+			stderr: `cmd: error: .+\.bindown\.yaml:1:10: config version 99 is newer than the latest version supported by this bindown`,
+			exit:   1,
+		})
+	})
+}
+
+func Test_configLintCmd(t *testing.T) {
+	cfg := `
+systems: [linux/amd64]
+dependencies:
+  foo:
+    url: https://example.com/foo
+    vars:
+      version: 1.2.3
+`
+
+	t.Run("warnings don't fail by default", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml(cfg)
+		result := runner.run("config", "lint")
+		result.assertState(resultState{
+			stdout: `.+\.bindown\.yaml:7:16: warning: /dependencies/foo/vars/version: var "version" isn't used by url, archive_path, bin or checksums_url \(unused-var\)`,
+		})
+	})
+
+	t.Run("fail on warning", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml(cfg)
+		result := runner.run("config", "lint", "--fail-on", "warning")
+		result.assertState(resultState{
+			stdout: `\.bindown\.yaml:7:16: warning: /dependencies/foo/vars/version`,
+			stderr: "cmd: error: found 1 problems with severity warning or higher",
+			exit:   1,
+		})
+	})
+
+	t.Run("json", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml("systems: [linux/amd64]\n")
+		result := runner.run("--json", "config", "lint")
+		result.assertStdOut("[]")
+	})
+}
+
+func Test_configConvertCmd(t *testing.T) {
+	t.Run("to toml and back", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.cache = ""
+		runner.writeConfigYaml("systems: [linux/amd64]\n")
+		yamlFile := runner.configFile
+		tomlFile := filepath.Join(runner.tmpDir, ".bindown.toml")
+		result := runner.run("config", "convert", "--to", "toml")
+		result.assertState(resultState{
+			stdout: `converted .+\.bindown\.yaml to .+\.bindown\.toml`,
+		})
+		require.NoFileExists(t, yamlFile)
+		content, err := os.ReadFile(tomlFile)
+		require.NoError(t, err)
+		require.Equal(t, "systems = ['linux/amd64']\n", string(content))
+
+		runner.configFile = tomlFile
+		result = runner.run("supported-system", "add", "darwin/arm64")
+		result.assertState(resultState{})
+		result = runner.run("format")
+		result.assertState(resultState{})
+		content, err = os.ReadFile(tomlFile)
+		require.NoError(t, err)
+		require.Equal(t, "systems = ['darwin/arm64', 'linux/amd64']\n", string(content))
+
+		result = runner.run("config", "convert", "--to", "yaml")
+		result.assertState(resultState{
+			stdout: `converted .+\.bindown\.toml to .+\.bindown\.yaml`,
+		})
+		runner.configFile = yamlFile
+		runner.assertConfigYaml("systems: [darwin/arm64, linux/amd64]\n")
+	})
+
+	t.Run("same format", func(t *testing.T) {
+		runner := newCmdRunner(t)
+		runner.writeConfigYaml("systems: [linux/amd64]\n")
+		result := runner.run("config", "convert", "--to", "yaml")
+		result.assertState(resultState{
+			stderr: `cmd: error: .+\.bindown\.yaml is already yaml`,
+			exit:   1,
+		})
+	})
+}
@@ -31,7 +31,7 @@ type dependencyUpdateVarsCmd struct {
 }
 
 func (c *dependencyUpdateVarsCmd) Run(ctx *runContext) error {
-	config, err := loadConfigFile(ctx, true)
+	config, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
@@ -52,7 +52,7 @@ func (c *dependencyUpdateVarsCmd) Run(ctx *runContext) error {
 		return err
 	}
 	if len(missingVars) == 0 && !c.SkipChecksums {
-		err = config.AddChecksums([]string{c.Dependency}, nil)
+		err = config.AddChecksums(ctx, []string{c.Dependency}, nil)
 		if err != nil {
 			return err
 		}
@@ -141,7 +141,7 @@ type dependencyRemoveCmd struct {
 }
 
 func (c *dependencyRemoveCmd) Run(ctx *runContext) error {
-	cfg, err := loadConfigFile(ctx, true)
+	cfg, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
@@ -166,7 +166,7 @@ type dependencyAddCmd struct {
 }
 
 func (c *dependencyAddCmd) Run(ctx *runContext) error {
-	config, err := loadConfigFile(ctx, true)
+	config, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
@@ -220,7 +220,7 @@ func (c *dependencyAddCmd) Run(ctx *runContext) error {
 
 	skipChecksums := c.SkipChecksums || c.SkipRequiredVars
 	if !skipChecksums {
-		err = config.AddChecksums([]string{c.Name}, nil)
+		err = config.AddChecksums(ctx, []string{c.Name}, nil)
 		if err != nil {
 			return err
 		}
@@ -309,7 +309,7 @@ type dependencyAddByUrlsCmd struct {
 }
 
 func (c *dependencyAddByUrlsCmd) Run(ctx *runContext) error {
-	config, err := loadConfigFile(ctx, true)
+	config, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
@@ -340,7 +340,7 @@ var (
 )
 
 func (c *dependencyAddByGithubReleaseCmd) Run(ctx *runContext) error {
-	config, err := loadConfigFile(ctx, true)
+	config, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
@@ -395,5 +395,5 @@ func (d dependencyValidateCmd) Run(ctx *runContext) error {
 	if err != nil {
 		return err
 	}
-	return config.Validate(d.Dependency, d.Systems)
+	return config.Validate(ctx, d.Dependency, d.Systems)
 }
@@ -32,7 +32,7 @@ type supportedSystemsRemoveCmd struct {
 }
 
 func (c *supportedSystemsRemoveCmd) Run(ctx *runContext) error {
-	cfg, err := loadConfigFile(ctx, true)
+	cfg, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
@@ -54,7 +54,7 @@ type supportedSystemAddCmd struct {
 }
 
 func (c *supportedSystemAddCmd) Run(ctx *runContext) error {
-	cfg, err := loadConfigFile(ctx, true)
+	cfg, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
@@ -77,7 +77,7 @@ func (c *supportedSystemAddCmd) Run(ctx *runContext) error {
 			}
 		}
 		if len(depsForSystem) > 0 {
-			err = cfg.AddChecksums(depsForSystem, []bindown.System{c.System})
+			err = cfg.AddChecksums(ctx, depsForSystem, []bindown.System{c.System})
 			if err != nil {
 				return err
 			}
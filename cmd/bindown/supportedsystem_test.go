@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -121,3 +123,16 @@ func Test_supportedSystemAddCmd(t *testing.T) {
 		})
 	}
 }
+
+func Test_supportedSystemAddCmd_sharedCache(t *testing.T) {
+	runner := newCmdRunner(t)
+	runner.cache = ""
+	t.Setenv("BINDOWN_SHARED_CACHE", "true")
+	t.Setenv("BINDOWN_SHARED_CACHE_DIR", filepath.Join(runner.tmpDir, "shared"))
+	runner.writeConfigYaml("systems:\n  - darwin/amd64\n")
+	result := runner.run("supported-system", "add", "linux/amd64")
+	result.assertState(resultState{})
+	content, err := os.ReadFile(runner.configFile)
+	require.NoError(t, err)
+	require.Equal(t, "systems:\n  - darwin/amd64\n  - linux/amd64\n", string(content))
+}
@@ -21,7 +21,7 @@ type templateUpdateVarCmd struct {
 }
 
 func (c *templateUpdateVarCmd) Run(ctx *runContext) error {
-	config, err := loadConfigFile(ctx, true)
+	config, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
@@ -57,7 +57,7 @@ func (c *templateUpdateFromSourceCmd) Run(ctx *runContext) error {
 	src := srcParts[0]
 	srcTmpl := srcParts[1]
 
-	cfg, err := loadConfigFile(ctx, true)
+	cfg, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
@@ -95,7 +95,7 @@ type templateRemoveCmd struct {
 }
 
 func (c *templateRemoveCmd) Run(ctx *runContext) error {
-	cfg, err := loadConfigFile(ctx, true)
+	cfg, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
@@ -36,7 +36,7 @@ type templateSourceAddCmd struct {
 }
 
 func (c *templateSourceAddCmd) Run(ctx *runContext) error {
-	cfg, err := loadConfigFile(ctx, true)
+	cfg, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
@@ -56,7 +56,7 @@ type templateSourceRemoveCmd struct {
 }
 
 func (c *templateSourceRemoveCmd) Run(ctx *runContext) error {
-	cfg, err := loadConfigFile(ctx, true)
+	cfg, err := loadConfigFileForUpdate(ctx, true)
 	if err != nil {
 		return err
 	}
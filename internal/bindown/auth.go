@@ -0,0 +1,299 @@
+package bindown
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/willabides/bindown/v4/internal/httpclient"
+)
+
+// HostConfig configures requests to a host.
+type HostConfig struct {
+	// Headers to send with every request to the host. Values are go templates. `{{env "NAME"}}` is the value of the
+	// environment variable NAME. A header is left out when an environment variable it uses is empty.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+
+	// An environment variable with a token to send as "Authorization: Bearer <token>". It is ignored when the variable
+	// is empty or headers sets Authorization.
+	TokenEnv string `json:"token_env,omitempty" yaml:"token_env,omitempty"`
+
+	// The API url of a GitHub Enterprise Server. When requests to the host have an Authorization header, release
+	// download urls are downloaded from the API so private release assets work. This is automatic for github.com.
+	GitHubAPIURL string `json:"github_api_url,omitempty" yaml:"github_api_url,omitempty"`
+}
+
+// headers returns the headers to send to the host with canonical names.
+func (h *HostConfig) headers() (http.Header, error) {
+	result := http.Header{}
+	if h == nil {
+		return result, nil
+	}
+	for _, name := range sortedKeys(h.Headers) {
+		missingEnv := false
+		tmpl, err := template.New(name).Funcs(template.FuncMap{
+			"env": func(key string) string {
+				val := os.Getenv(key)
+				if val == "" {
+					missingEnv = true
+				}
+				return val
+			},
+		}).Parse(h.Headers[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for header %q: %w", name, err)
+		}
+		var buf strings.Builder
+		err = tmpl.Execute(&buf, nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for header %q: %w", name, err)
+		}
+		if !missingEnv {
+			result.Set(name, buf.String())
+		}
+	}
+	if h.TokenEnv != "" && result.Get("Authorization") == "" {
+		token := os.Getenv(h.TokenEnv)
+		if token != "" {
+			result.Set("Authorization", "Bearer "+token)
+		}
+	}
+	return result, nil
+}
+
+// httpContext returns ctx with an http client that adds credentials from c's hosts and from .netrc to requests.
+// Credentials are only added to requests, so they never end up in url_checksums or cache paths.
+func (c *Config) httpContext(ctx context.Context) context.Context {
+	client := httpclient.FromContext(ctx)
+	auth := &hostAuth{
+		hosts:    c.Hosts,
+		client:   client,
+		netrc:    sync.OnceValues(loadNetrc),
+		releases: map[string]*githubRelease{},
+	}
+	return httpclient.NewContext(ctx, client.WithRequestEditor(auth.edit))
+}
+
+// hostAuth adds credentials to requests.
+type hostAuth struct {
+	hosts  map[string]*HostConfig
+	client *httpclient.Client
+	netrc  func() ([]netrcEntry, error)
+
+	mu       sync.Mutex
+	releases map[string]*githubRelease
+}
+
+func (a *hostAuth) edit(req *http.Request) error {
+	host := a.hostConfig(req.URL)
+	headers, err := host.headers()
+	if err != nil {
+		return fmt.Errorf("host %s: %w", req.URL.Host, err)
+	}
+	if headers.Get("Authorization") == "" && req.Header.Get("Authorization") == "" && req.URL.User == nil {
+		entries, err := a.netrc()
+		if err != nil {
+			return err
+		}
+		entry := netrcLookup(entries, req.URL.Hostname())
+		if entry != nil {
+			req.SetBasicAuth(entry.login, entry.password)
+		}
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	apiURL := githubAPIURL(req.URL, host)
+	if apiURL == "" || req.Header.Get("Authorization") == "" {
+		return nil
+	}
+	assetURL, err := a.githubAssetURL(req.Context(), apiURL, req.URL, req.Header.Get("Authorization"))
+	if err != nil || assetURL == nil {
+		return err
+	}
+	req.URL = assetURL
+	req.Host = ""
+	req.Header.Set("Accept", "application/octet-stream")
+	return nil
+}
+
+// hostConfig returns the config for u's host with or without its port.
+func (a *hostAuth) hostConfig(u *url.URL) *HostConfig {
+	host, ok := a.hosts[u.Host]
+	if !ok {
+		host = a.hosts[u.Hostname()]
+	}
+	return host
+}
+
+// githubAPIURL returns the url of the GitHub API for the host of u or "" if it isn't a GitHub host.
+func githubAPIURL(u *url.URL, host *HostConfig) string {
+	if host != nil && host.GitHubAPIURL != "" {
+		return strings.TrimSuffix(host.GitHubAPIURL, "/")
+	}
+	if u.Host == "github.com" {
+		return "https://api.github.com"
+	}
+	return ""
+}
+
+type githubRelease struct {
+	Assets []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"assets"`
+}
+
+// githubAssetURL returns the API url of the release asset at dlURL or nil if dlURL isn't a release download url.
+func (a *hostAuth) githubAssetURL(ctx context.Context, apiURL string, dlURL *url.URL, authorization string) (*url.URL, error) {
+	// release download urls look like /<owner>/<repo>/releases/download/<tag>/<asset>
+	parts := strings.Split(strings.TrimPrefix(dlURL.EscapedPath(), "/"), "/")
+	if len(parts) != 6 || parts[2] != "releases" || parts[3] != "download" {
+		return nil, nil
+	}
+	repoURL := fmt.Sprintf("%s/repos/%s/%s", apiURL, parts[0], parts[1])
+	release, err := a.githubRelease(ctx, repoURL+"/releases/tags/"+parts[4], authorization)
+	if err != nil {
+		return nil, err
+	}
+	assetName, err := url.PathUnescape(parts[5])
+	if err != nil {
+		return nil, err
+	}
+	for _, asset := range release.Assets {
+		if asset.Name == assetName {
+			return url.Parse(repoURL + "/releases/assets/" + strconv.FormatInt(asset.ID, 10))
+		}
+	}
+	return nil, fmt.Errorf("no asset named %q in GitHub release for %s", assetName, dlURL.Redacted())
+}
+
+// githubRelease returns the release at releaseURL. Releases are remembered, but a.mu is only held to read and write
+// them so lookups of other releases aren't blocked by the request.
+func (a *hostAuth) githubRelease(ctx context.Context, releaseURL, authorization string) (_ *githubRelease, errOut error) {
+	a.mu.Lock()
+	release, ok := a.releases[releaseURL]
+	a.mu.Unlock()
+	if ok {
+		return release, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, releaseURL, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", authorization)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer deferErr(&errOut, resp.Body.Close)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed getting GitHub release %s: %s", releaseURL, resp.Status)
+	}
+	release = &githubRelease{}
+	err = json.NewDecoder(resp.Body).Decode(release)
+	if err != nil {
+		return nil, fmt.Errorf("failed getting GitHub release %s: %w", releaseURL, err)
+	}
+	a.mu.Lock()
+	a.releases[releaseURL] = release
+	a.mu.Unlock()
+	return release, nil
+}
+
+// netrcEntry is a machine or default entry from a .netrc file. machine is "" for the default entry.
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+// loadNetrc reads the file named by the NETRC environment variable or .netrc in the home directory (_netrc on
+// Windows). It returns nil when the file doesn't exist.
+func loadNetrc() ([]netrcEntry, error) {
+	filename := os.Getenv("NETRC")
+	if filename == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil
+		}
+		name := ".netrc"
+		if runtime.GOOS == "windows" {
+			name = "_netrc"
+		}
+		filename = filepath.Join(home, name)
+	}
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseNetrc(string(data)), nil
+}
+
+func parseNetrc(data string) []netrcEntry {
+	var entries []netrcEntry
+	var entry *netrcEntry
+	inMacro := false
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		// a macro definition ends at the next empty line
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			next := ""
+			if i+1 < len(fields) {
+				next = fields[i+1]
+			}
+			switch fields[i] {
+			case "machine":
+				entries = append(entries, netrcEntry{machine: next})
+				entry = &entries[len(entries)-1]
+				i++
+			case "default":
+				entries = append(entries, netrcEntry{})
+				entry = &entries[len(entries)-1]
+			case "login", "password", "account":
+				if entry != nil && fields[i] == "login" {
+					entry.login = next
+				}
+				if entry != nil && fields[i] == "password" {
+					entry.password = next
+				}
+				i++
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+	return entries
+}
+
+// netrcLookup returns the entry for host, the default entry or nil.
+func netrcLookup(entries []netrcEntry, host string) *netrcEntry {
+	var defaultEntry *netrcEntry
+	for i := range entries {
+		if entries[i].machine == host {
+			return &entries[i]
+		}
+		if entries[i].machine == "" && defaultEntry == nil {
+			defaultEntry = &entries[i]
+		}
+	}
+	return defaultEntry
+}
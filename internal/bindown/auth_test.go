@@ -0,0 +1,282 @@
+package bindown
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/bindown/v4/internal/httpclient"
+)
+
+func TestHostConfig_headers(t *testing.T) {
+	t.Setenv("TEST_TOKEN", "secret")
+	t.Setenv("TEST_EMPTY", "")
+
+	t.Run("templates", func(t *testing.T) {
+		host := &HostConfig{Headers: map[string]string{
+			"authorization": `token {{env "TEST_TOKEN"}}`,
+			"X-Missing":     `{{env "TEST_EMPTY"}}`,
+			"X-Static":      "static",
+		}}
+		got, err := host.headers()
+		require.NoError(t, err)
+		require.Equal(t, http.Header{
+			"Authorization": {"token secret"},
+			"X-Static":      {"static"},
+		}, got)
+	})
+
+	t.Run("token_env", func(t *testing.T) {
+		got, err := (&HostConfig{TokenEnv: "TEST_TOKEN"}).headers()
+		require.NoError(t, err)
+		require.Equal(t, http.Header{"Authorization": {"Bearer secret"}}, got)
+
+		got, err = (&HostConfig{TokenEnv: "TEST_EMPTY"}).headers()
+		require.NoError(t, err)
+		require.Empty(t, got)
+
+		got, err = (&HostConfig{
+			TokenEnv: "TEST_TOKEN",
+			Headers:  map[string]string{"Authorization": "Basic abc"},
+		}).headers()
+		require.NoError(t, err)
+		require.Equal(t, http.Header{"Authorization": {"Basic abc"}}, got)
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		_, err := (&HostConfig{Headers: map[string]string{"X-Foo": "{{"}}).headers()
+		require.ErrorContains(t, err, `invalid template for header "X-Foo"`)
+	})
+}
+
+func Test_parseNetrc(t *testing.T) {
+	entries := parseNetrc(`
+machine example.com login alice password hunter2
+macdef init
+  machine evil.com login mallory password x
+
+machine other.com
+  login bob
+  account acct
+  password pw
+default login anon password anon@
+`)
+	require.Equal(t, []netrcEntry{
+		{machine: "example.com", login: "alice", password: "hunter2"},
+		{machine: "other.com", login: "bob", password: "pw"},
+		{login: "anon", password: "anon@"},
+	}, entries)
+	require.Equal(t, &entries[1], netrcLookup(entries, "other.com"))
+	require.Equal(t, &entries[2], netrcLookup(entries, "evil.com"))
+	require.Nil(t, netrcLookup(entries[:2], "evil.com"))
+}
+
+func TestConfig_DownloadDependencies_auth(t *testing.T) {
+	ctx := context.Background()
+	foo, err := os.ReadFile(filepath.Join("testdata", "downloadables", "foo.tar.gz"))
+	require.NoError(t, err)
+	t.Setenv("TEST_TOKEN", "secret")
+	t.Setenv("NETRC", filepath.Join(t.TempDir(), "netrc"))
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		authorized := func(want string) bool {
+			if req.Header.Get("Authorization") != want {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return false
+			}
+			return true
+		}
+		switch req.URL.Path {
+		case "/private/foo.tar.gz":
+			if authorized("token secret") {
+				_, _ = w.Write(foo)
+			}
+		case "/netrc/foo.tar.gz":
+			if authorized("Basic dXNlcjpwYXNz") {
+				_, _ = w.Write(foo)
+			}
+		case "/api/repos/me/foo/releases/tags/v1.0.0":
+			if authorized("token secret") {
+				_, _ = fmt.Fprint(w, `{"assets": [{"id": 1, "name": "bar.tar.gz"}, {"id": 2, "name": "foo.tar.gz"}]}`)
+			}
+		case "/api/repos/me/foo/releases/assets/2":
+			if authorized("token secret") && req.Header.Get("Accept") == "application/octet-stream" {
+				http.Redirect(w, req, ts.URL+"/storage/foo.tar.gz", http.StatusFound)
+			}
+		case "/storage/foo.tar.gz":
+			_, _ = w.Write(foo)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	download := func(t *testing.T, dlURL, hostsYAML string) (*Config, error) {
+		t.Helper()
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yaml")
+		writeTestFile(t, cfgFile, fmt.Sprintf(`
+cache: %q
+dependencies:
+  foo:
+    url: %s
+hosts:
+%s`, filepath.Join(dir, "cache"), dlURL, hostsYAML))
+		cfg, err := NewConfig(ctx, cfgFile, false)
+		require.NoError(t, err)
+		err = cfg.AddChecksums(ctx, nil, []System{"darwin/amd64"})
+		if err != nil {
+			return nil, err
+		}
+		return cfg, cfg.DownloadDependencies(ctx, []string{"foo"}, "darwin/amd64", nil)
+	}
+
+	t.Run("header template", func(t *testing.T) {
+		dlURL := ts.URL + "/private/foo.tar.gz"
+		cfg, err := download(t, dlURL, fmt.Sprintf(`
+  %s:
+    headers:
+      Authorization: 'token {{env "TEST_TOKEN"}}'
+`, host))
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{dlURL: fooChecksum}, cfg.URLChecksums)
+		cacheFiles, err := filepath.Glob(filepath.Join(cfg.Cache, "downloads", "*", "*"))
+		require.NoError(t, err)
+		for _, file := range cacheFiles {
+			require.NotContains(t, file, "secret")
+		}
+	})
+
+	t.Run("wrong credentials", func(t *testing.T) {
+		_, err := download(t, ts.URL+"/private/foo.tar.gz", fmt.Sprintf(`
+  %s:
+    token_env: TEST_TOKEN
+`, host))
+		require.ErrorContains(t, err, "failed downloading")
+	})
+
+	t.Run("netrc", func(t *testing.T) {
+		u, err := url.Parse(ts.URL)
+		require.NoError(t, err)
+		writeTestFile(t, os.Getenv("NETRC"), fmt.Sprintf("machine %s login user password pass\n", u.Hostname()))
+		t.Cleanup(func() { require.NoError(t, os.Remove(os.Getenv("NETRC"))) })
+		_, err = download(t, ts.URL+"/netrc/foo.tar.gz", "  {}\n")
+		require.NoError(t, err)
+	})
+
+	t.Run("github release asset", func(t *testing.T) {
+		dlURL := ts.URL + "/me/foo/releases/download/v1.0.0/foo.tar.gz"
+		cfg, err := download(t, dlURL, fmt.Sprintf(`
+  %s:
+    headers:
+      Authorization: 'token {{env "TEST_TOKEN"}}'
+    github_api_url: %s/api
+`, host, ts.URL))
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{dlURL: fooChecksum}, cfg.URLChecksums)
+	})
+
+	t.Run("github release without asset", func(t *testing.T) {
+		_, err := download(t, ts.URL+"/me/foo/releases/download/v1.0.0/baz.tar.gz", fmt.Sprintf(`
+  %s:
+    headers:
+      Authorization: 'token {{env "TEST_TOKEN"}}'
+    github_api_url: %s/api
+`, host, ts.URL))
+		require.ErrorContains(t, err, `no asset named "baz.tar.gz" in GitHub release`)
+	})
+}
+
+func TestConfig_httpContext_redirect(t *testing.T) {
+	t.Setenv("NETRC", filepath.Join(t.TempDir(), "netrc"))
+	var cdnHeaders http.Header
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cdnHeaders = req.Header.Clone()
+		_, _ = w.Write([]byte("foo"))
+	}))
+	t.Cleanup(cdn.Close)
+	var artifactHeaders http.Header
+	artifacts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/cdn":
+			http.Redirect(w, req, cdn.URL+"/foo", http.StatusFound)
+		case "/local":
+			http.Redirect(w, req, "/foo", http.StatusFound)
+		default:
+			artifactHeaders = req.Header.Clone()
+			_, _ = w.Write([]byte("foo"))
+		}
+	}))
+	t.Cleanup(artifacts.Close)
+	cfg := &Config{Hosts: map[string]*HostConfig{
+		strings.TrimPrefix(artifacts.URL, "http://"): {Headers: map[string]string{
+			"X-Api-Key":     "secret",
+			"Authorization": "token secret",
+		}},
+	}}
+	ctx := cfg.httpContext(context.Background())
+	get := func(u string) {
+		t.Helper()
+		resp, err := httpclient.FromContext(ctx).Get(ctx, u)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	get(artifacts.URL + "/cdn")
+	require.NotNil(t, cdnHeaders)
+	require.Empty(t, cdnHeaders.Get("X-Api-Key"))
+	require.Empty(t, cdnHeaders.Get("Authorization"))
+
+	get(artifacts.URL + "/local")
+	require.Equal(t, "secret", artifactHeaders.Get("X-Api-Key"))
+	require.Equal(t, "token secret", artifactHeaders.Get("Authorization"))
+}
+
+func Test_hostAuth_githubRelease(t *testing.T) {
+	ctx := context.Background()
+	slowStarted := make(chan struct{})
+	releaseSlow := make(chan struct{})
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		if req.URL.Path == "/slow" {
+			close(slowStarted)
+			<-releaseSlow
+		}
+		_, _ = fmt.Fprint(w, `{"assets": [{"id": 1, "name": "foo.tar.gz"}]}`)
+	}))
+	t.Cleanup(ts.Close)
+	auth := &hostAuth{
+		client:   httpclient.FromContext(ctx),
+		releases: map[string]*githubRelease{},
+	}
+
+	slowDone := make(chan error)
+	go func() {
+		_, err := auth.githubRelease(ctx, ts.URL+"/slow", "token secret")
+		slowDone <- err
+	}()
+	<-slowStarted
+
+	// a lookup of another release isn't blocked by the slow one
+	release, err := auth.githubRelease(ctx, ts.URL+"/fast", "token secret")
+	require.NoError(t, err)
+	require.Len(t, release.Assets, 1)
+	close(releaseSlow)
+	require.NoError(t, <-slowDone)
+
+	_, err = auth.githubRelease(ctx, ts.URL+"/fast", "token secret")
+	require.NoError(t, err)
+	require.Equal(t, int32(2), requests.Load())
+}
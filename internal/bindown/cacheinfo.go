@@ -0,0 +1,72 @@
+package bindown
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/willabides/bindown/v4/internal/cache"
+)
+
+// cacheNames are the caches under a config's cache directory.
+var cacheNames = []string{"downloads", "extracts", "bin"}
+
+// CacheEntry is an entry in one of the caches under the config's cache directory.
+type CacheEntry struct {
+	// Cache is "downloads", "extracts" or "bin".
+	Cache string `json:"cache"`
+	// Path is the entry's directory.
+	Path string `json:"path"`
+	cache.Entry
+	// partialKey is the key of the download when this is a partial download from PruneCache.
+	partialKey string
+}
+
+// CacheEntries returns the entries in the downloads, extracts and bin caches in cache and key order.
+func (c *Config) CacheEntries() ([]CacheEntry, error) {
+	var result []CacheEntry
+	for _, name := range cacheNames {
+		entryCache := c.namedCache(name)
+		entries, err := entryCache.Entries()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			result = append(result, CacheEntry{
+				Cache: name,
+				Path:  filepath.Join(entryCache.Root, entry.Key),
+				Entry: entry,
+			})
+		}
+	}
+	return result, nil
+}
+
+// CacheInfo returns the cache entries with the key keyOrDependency or that were created for the dependency named
+// keyOrDependency.
+func (c *Config) CacheInfo(keyOrDependency string) ([]CacheEntry, error) {
+	entries, err := c.CacheEntries()
+	if err != nil {
+		return nil, err
+	}
+	var result []CacheEntry
+	for _, entry := range entries {
+		if entry.Key == keyOrDependency || entry.Dependency == keyOrDependency {
+			result = append(result, entry)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no cache entries for %q", keyOrDependency)
+	}
+	return result, nil
+}
+
+func (c *Config) namedCache(name string) *cache.Cache {
+	switch name {
+	case "downloads":
+		return c.downloadsCache()
+	case "extracts":
+		return c.extractsCache()
+	default:
+		return c.binCache()
+	}
+}
@@ -0,0 +1,71 @@
+package bindown
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/bindown/v4/internal/testutil"
+)
+
+func TestConfig_CacheEntries(t *testing.T) {
+	ctx := context.Background()
+	servePath := filepath.Join("testdata", "downloadables", "fooinroot.tar.gz")
+	ts := testutil.ServeFile(t, servePath, "/foo/fooinroot.tar.gz", "")
+	depURL := ts.URL + "/foo/fooinroot.tar.gz"
+	checksum := "27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3"
+	dir := t.TempDir()
+	cfg := mustConfigFromYAML(t, fmt.Sprintf(`
+install_dir: %q
+cache: %q
+url_checksums:
+  %s: %s
+dependencies:
+  foo:
+    url: %s
+`, filepath.Join(dir, "bin"), filepath.Join(dir, "cache"), depURL, checksum, depURL))
+
+	entries, err := cfg.CacheEntries()
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	err = cfg.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{ToCache: true})
+	require.NoError(t, err)
+	dep, err := cfg.BuildDependency("foo", "darwin/amd64")
+	require.NoError(t, err)
+
+	entries, err = cfg.CacheEntries()
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	dlKey := cacheKey(checksum)
+	for i, want := range []struct{ cache, key string }{
+		{"downloads", dlKey},
+		{"extracts", dlKey},
+		{"bin", cfg.binCacheKey(dep)},
+	} {
+		entry := entries[i]
+		require.Equal(t, want.cache, entry.Cache)
+		require.Equal(t, want.key, entry.Key)
+		require.Equal(t, filepath.Join(cfg.Cache, want.cache, want.key), entry.Path)
+		require.Equal(t, "foo", entry.Dependency)
+		require.Equal(t, "darwin/amd64", entry.System)
+		require.Equal(t, depURL, entry.URL)
+		require.Equal(t, checksum, entry.Checksum)
+		require.Positive(t, entry.Size)
+		require.False(t, entry.Created.IsZero())
+		require.False(t, entry.LastUsed.Before(entry.Created))
+	}
+
+	info, err := cfg.CacheInfo("foo")
+	require.NoError(t, err)
+	require.Equal(t, entries, info)
+
+	info, err = cfg.CacheInfo(dlKey)
+	require.NoError(t, err)
+	require.Equal(t, entries[:2], info)
+
+	_, err = cfg.CacheInfo("bar")
+	require.EqualError(t, err, `no cache entries for "bar"`)
+}
@@ -0,0 +1,136 @@
+package bindown
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/willabides/bindown/v4/internal/cache"
+)
+
+// ConfigPruneCacheOpts selects what PruneCache removes. Entries matching any of the options are removed.
+type ConfigPruneCacheOpts struct {
+	// Unreachable removes entries that no dependency in the config uses on any of its systems.
+	Unreachable bool
+	// UnusedFor removes entries and partial downloads that haven't been used for this long. Zero disables it.
+	UnusedFor time.Duration
+	// MaxSize removes the least recently used entries and partial downloads until the cache is no bigger than MaxSize
+	// bytes. Zero disables it.
+	MaxSize int64
+	// DryRun returns what would be removed without removing anything.
+	DryRun bool
+}
+
+// PruneCache removes entries from the downloads, extracts and bin caches and returns the removed entries. Entries
+// are removed while holding their write lock, so entries that are in use are removed once they are released. An
+// entry that was selected because of UnusedFor or MaxSize is kept if it was used after it was selected. Unreachable
+// can't be used with a shared cache.
+//
+// Partial downloads left by interrupted downloads are pruned by UnusedFor and MaxSize too. They are returned as
+// downloads entries with keys like .partial/<key>.
+func (c *Config) PruneCache(opts *ConfigPruneCacheOpts) ([]CacheEntry, error) {
+	if opts == nil {
+		opts = &ConfigPruneCacheOpts{}
+	}
+	if opts.Unreachable && c.sharedCacheDir != "" {
+		return nil, fmt.Errorf("can't prune unreachable entries from a shared cache because other projects use it")
+	}
+	entries, err := c.CacheEntries()
+	if err != nil {
+		return nil, err
+	}
+	partials, err := partialDownloadEntries(c.downloadsCache())
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, partials...)
+	var reachable map[string]map[string]*Dependency
+	var unbuilt map[string][]System
+	if opts.Unreachable {
+		reachable, unbuilt, err = c.cacheEntryDependencies()
+		if err != nil {
+			return nil, err
+		}
+	}
+	// entries of dependencies that can't be built might still be used, so they are treated as reachable
+	isUnbuilt := func(entry CacheEntry) bool {
+		systems, ok := unbuilt[entry.Dependency]
+		return ok && (systems == nil || slices.Contains(systems, System(entry.System)))
+	}
+	now := time.Now()
+	var selected, kept []CacheEntry
+	// unreachable entries are removed even when they have been used since they were selected
+	unreachable := map[string]bool{}
+	for _, entry := range entries {
+		switch {
+		case opts.Unreachable && entry.partialKey == "" && reachable[entry.Cache][entry.Key] == nil && !isUnbuilt(entry):
+			unreachable[entry.Path] = true
+			selected = append(selected, entry)
+		case opts.UnusedFor > 0 && now.Sub(entry.LastUsed) > opts.UnusedFor:
+			selected = append(selected, entry)
+		default:
+			kept = append(kept, entry)
+		}
+	}
+	if opts.MaxSize > 0 {
+		var size int64
+		for _, entry := range kept {
+			size += entry.Size
+		}
+		slices.SortStableFunc(kept, func(a, b CacheEntry) int {
+			return a.LastUsed.Compare(b.LastUsed)
+		})
+		for _, entry := range kept {
+			if size <= opts.MaxSize {
+				break
+			}
+			selected = append(selected, entry)
+			size -= entry.Size
+		}
+	}
+	if opts.DryRun {
+		return selected, nil
+	}
+	var removed []CacheEntry
+	for _, entry := range selected {
+		lastUsed := entry.LastUsed
+		if entry.partialKey != "" {
+			evicted, err := evictPartialDownload(c.downloadsCache(), entry.partialKey, lastUsed)
+			if err != nil {
+				return removed, err
+			}
+			if evicted {
+				removed = append(removed, entry)
+			}
+			continue
+		}
+		force := unreachable[entry.Path]
+		var sumErr error
+		evicted, err := c.namedCache(entry.Cache).EvictIf(entry.Key, func(current *cache.Entry) bool {
+			if !force && current.LastUsed.After(lastUsed) {
+				return false
+			}
+			if entry.Cache != "extracts" {
+				return true
+			}
+			// the sum file is removed while the entry is locked so a new extract can't lose it
+			sumErr = os.Remove(extractSumFile(c.cacheDir(), entry.Key))
+			if os.IsNotExist(sumErr) {
+				sumErr = nil
+			}
+			return sumErr == nil
+		})
+		if err == nil {
+			err = sumErr
+		}
+		if err != nil {
+			return removed, err
+		}
+		if !evicted {
+			continue
+		}
+		removed = append(removed, entry)
+	}
+	return removed, nil
+}
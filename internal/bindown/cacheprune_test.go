@@ -0,0 +1,171 @@
+package bindown
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/bindown/v4/internal/cache"
+	"github.com/willabides/bindown/v4/internal/testutil"
+)
+
+func TestConfig_PruneCache(t *testing.T) {
+	ctx := context.Background()
+	ts := testutil.ServeFiles(t, map[string]string{
+		"/foo/fooinroot.tar.gz": filepath.Join("testdata", "downloadables", "fooinroot.tar.gz"),
+		"/bar/foo.tar.gz":       filepath.Join("testdata", "downloadables", "foo.tar.gz"),
+	})
+	fooURL := ts.URL + "/foo/fooinroot.tar.gz"
+	barURL := ts.URL + "/bar/foo.tar.gz"
+	fooKey := cacheKey("27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3")
+	barKey := cacheKey(fooChecksum)
+
+	setup := func(t *testing.T) *Config {
+		t.Helper()
+		dir := t.TempDir()
+		cfg := mustConfigFromYAML(t, fmt.Sprintf(`
+install_dir: %q
+cache: %q
+systems: [darwin/amd64]
+url_checksums:
+  %s: 27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3
+  %s: %s
+dependencies:
+  foo:
+    url: %s
+  bar:
+    url: %s
+    archive_path: bin/foo.txt
+`, filepath.Join(dir, "bin"), filepath.Join(dir, "cache"), fooURL, barURL, fooChecksum, fooURL, barURL))
+		err := cfg.ExtractDependencies(ctx, []string{"foo", "bar"}, "darwin/amd64", nil)
+		require.NoError(t, err)
+		return cfg
+	}
+
+	// setLastUsed changes the last use recorded in an entry's metadata.
+	setLastUsed := func(t *testing.T, cfg *Config, cacheName, key string, lastUsed time.Time) {
+		t.Helper()
+		filename := filepath.Join(cfg.Cache, cacheName, ".meta", key+".json")
+		data, err := os.ReadFile(filename)
+		require.NoError(t, err)
+		var meta cache.Metadata
+		require.NoError(t, json.Unmarshal(data, &meta))
+		meta.LastUsed = lastUsed
+		data, err = json.Marshal(&meta)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filename, data, 0o600))
+	}
+
+	keys := func(entries []CacheEntry) []string {
+		var result []string
+		for _, entry := range entries {
+			result = append(result, entry.Cache+"/"+entry.Key)
+		}
+		return result
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		cfg := setup(t)
+		delete(cfg.Dependencies, "bar")
+
+		removed, err := cfg.PruneCache(&ConfigPruneCacheOpts{Unreachable: true, DryRun: true})
+		require.NoError(t, err)
+		require.Equal(t, []string{"downloads/" + barKey, "extracts/" + barKey}, keys(removed))
+		require.DirExists(t, removed[0].Path)
+
+		removed, err = cfg.PruneCache(&ConfigPruneCacheOpts{Unreachable: true})
+		require.NoError(t, err)
+		require.Equal(t, []string{"downloads/" + barKey, "extracts/" + barKey}, keys(removed))
+		require.NoDirExists(t, removed[0].Path)
+		require.NoDirExists(t, removed[1].Path)
+		require.NoFileExists(t, extractSumFile(cfg.Cache, barKey))
+
+		entries, err := cfg.CacheEntries()
+		require.NoError(t, err)
+		require.Equal(t, []string{"downloads/" + fooKey, "extracts/" + fooKey}, keys(entries))
+	})
+
+	t.Run("keeps entries of dependencies that can't be built", func(t *testing.T) {
+		cfg := setup(t)
+		cfg.Dependencies["bar"].URL = ptr("{{.missing")
+		_, err := cfg.BuildDependency("bar", "darwin/amd64")
+		require.Error(t, err)
+		removed, err := cfg.PruneCache(&ConfigPruneCacheOpts{Unreachable: true})
+		require.NoError(t, err)
+		require.Empty(t, removed)
+	})
+
+	t.Run("unused", func(t *testing.T) {
+		cfg := setup(t)
+		setLastUsed(t, cfg, "extracts", barKey, time.Now().Add(-40*24*time.Hour))
+		removed, err := cfg.PruneCache(&ConfigPruneCacheOpts{UnusedFor: 30 * 24 * time.Hour})
+		require.NoError(t, err)
+		require.Equal(t, []string{"extracts/" + barKey}, keys(removed))
+
+		// extracting again replaces the removed entry
+		err = cfg.ExtractDependencies(ctx, []string{"bar"}, "darwin/amd64", nil)
+		require.NoError(t, err)
+		entries, err := cfg.CacheEntries()
+		require.NoError(t, err)
+		require.Len(t, entries, 4)
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		cfg := setup(t)
+		now := time.Now()
+		setLastUsed(t, cfg, "downloads", fooKey, now.Add(-4*time.Hour))
+		setLastUsed(t, cfg, "downloads", barKey, now.Add(-3*time.Hour))
+		setLastUsed(t, cfg, "extracts", fooKey, now.Add(-2*time.Hour))
+		setLastUsed(t, cfg, "extracts", barKey, now.Add(-1*time.Hour))
+		entries, err := cfg.CacheEntries()
+		require.NoError(t, err)
+		var total int64
+		for _, entry := range entries {
+			total += entry.Size
+		}
+		removed, err := cfg.PruneCache(&ConfigPruneCacheOpts{MaxSize: total - 1})
+		require.NoError(t, err)
+		require.Equal(t, []string{"downloads/" + fooKey}, keys(removed))
+
+		removed, err = cfg.PruneCache(&ConfigPruneCacheOpts{MaxSize: 1})
+		require.NoError(t, err)
+		require.Equal(t, []string{"downloads/" + barKey, "extracts/" + fooKey, "extracts/" + barKey}, keys(removed))
+	})
+
+	t.Run("partial downloads", func(t *testing.T) {
+		cfg := setup(t)
+		partialDir := filepath.Join(partialDownloadsDir(cfg.downloadsCache()), "abandoned")
+		partialFile := filepath.Join(partialDir, "big.tar.gz")
+		writeTestFile(t, partialFile, strings.Repeat("x", 1<<20))
+		writeTestFile(t, partialDownloadMetaFile(partialFile), `{"url":"https://example.com/big.tar.gz","etag":"\"v1\""}`)
+		old := time.Now().Add(-40 * 24 * time.Hour)
+		for _, file := range []string{partialFile, partialDownloadMetaFile(partialFile), partialDir} {
+			require.NoError(t, os.Chtimes(file, old, old))
+		}
+
+		// partials aren't cache entries, so they aren't unreachable
+		removed, err := cfg.PruneCache(&ConfigPruneCacheOpts{Unreachable: true})
+		require.NoError(t, err)
+		require.Empty(t, removed)
+
+		// they count toward the size
+		removed, err = cfg.PruneCache(&ConfigPruneCacheOpts{MaxSize: 1 << 20, DryRun: true})
+		require.NoError(t, err)
+		require.Equal(t, []string{"downloads/.partial/abandoned"}, keys(removed))
+		require.Greater(t, removed[0].Size, int64(1<<20))
+
+		removed, err = cfg.PruneCache(&ConfigPruneCacheOpts{UnusedFor: 30 * 24 * time.Hour})
+		require.NoError(t, err)
+		require.Equal(t, []string{"downloads/.partial/abandoned"}, keys(removed))
+		require.NoDirExists(t, partialDir)
+		entries, err := cfg.CacheEntries()
+		require.NoError(t, err)
+		require.Len(t, entries, 4)
+	})
+}
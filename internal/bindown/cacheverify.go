@@ -0,0 +1,210 @@
+package bindown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// CacheStatus is the result of verifying a cache entry.
+type CacheStatus string
+
+// Cache statuses
+const (
+	// CacheOK means the entry is intact.
+	CacheOK CacheStatus = "ok"
+	// CacheCorrupt means the entry's files don't match what was downloaded, extracted or installed.
+	CacheCorrupt CacheStatus = "corrupt"
+	// CacheRepaired means the entry was corrupt and has been re-created.
+	CacheRepaired CacheStatus = "repaired"
+	// CacheRemoved means the entry was corrupt and has been removed because no dependency can re-create it.
+	CacheRemoved CacheStatus = "removed"
+	// CacheUnknown means there is nothing to verify the entry against. Either no dependency in the config uses it or it
+	// is an extracts entry without a recorded checksum.
+	CacheUnknown CacheStatus = "unknown"
+)
+
+// CacheVerification is the result of verifying one cache entry.
+type CacheVerification struct {
+	// Cache is "downloads", "extracts" or "bin".
+	Cache  string      `json:"cache"`
+	Key    string      `json:"key"`
+	Status CacheStatus `json:"status"`
+	// Dependency and System are the dependency that uses the entry when the config has one.
+	Dependency string `json:"dependency,omitempty"`
+	System     System `json:"system,omitempty"`
+	// Error is why the entry is corrupt or couldn't be repaired.
+	Error string `json:"error,omitempty"`
+}
+
+// VerifyCache checks every entry in the downloads, extracts and bin caches. Downloads are compared to their
+// checksums, and extracts and bin entries to the checksum recorded when they were created.
+// When repair is true, corrupt entries are removed and re-created from the dependency that uses them. Results are in
+// cache and key order.
+func (c *Config) VerifyCache(ctx context.Context, repair bool) ([]CacheVerification, error) {
+	ctx = c.httpContext(ctx)
+	deps, _, err := c.cacheEntryDependencies()
+	if err != nil {
+		return nil, err
+	}
+	var results []CacheVerification
+	for _, name := range cacheNames {
+		entryCache := c.namedCache(name)
+		keys, err := entryCache.Keys()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			result := CacheVerification{Cache: name, Key: key, Status: CacheOK}
+			dep := deps[name][key]
+			if dep != nil {
+				result.Dependency = dep.name
+				result.System = dep.system
+			}
+			validate, err := c.cacheEntryValidator(name, key, dep)
+			if err != nil {
+				return nil, err
+			}
+			if validate == nil {
+				result.Status = CacheUnknown
+				results = append(results, result)
+				continue
+			}
+			err = entryCache.Validate(key, validate)
+			if err != nil {
+				result.Status = CacheCorrupt
+				result.Error = err.Error()
+			}
+			if err != nil && repair {
+				result.Status, err = c.repairCacheEntry(ctx, name, key, dep)
+				if err != nil {
+					result.Error = fmt.Sprintf("%s; failed repairing: %v", result.Error, err)
+				}
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// cacheEntryDependencies returns the dependency that uses each key in the downloads, extracts and bin caches.
+// Dependencies that can't be built are skipped. They are returned in unbuilt with the systems they failed on. A nil
+// list of systems means every system.
+func (c *Config) cacheEntryDependencies() (_ map[string]map[string]*Dependency, unbuilt map[string][]System, _ error) {
+	result := map[string]map[string]*Dependency{}
+	unbuilt = map[string][]System{}
+	for _, name := range cacheNames {
+		result[name] = map[string]*Dependency{}
+	}
+	add := func(name, key string, dep *Dependency) {
+		if result[name][key] == nil {
+			result[name][key] = dep
+		}
+	}
+	for _, depName := range c.DependencyNames() {
+		systems, err := c.DependencySystems(depName)
+		if err != nil {
+			unbuilt[depName] = nil
+			continue
+		}
+		for _, system := range systems {
+			dep, err := c.BuildDependency(depName, system)
+			if err != nil {
+				unbuilt[depName] = append(unbuilt[depName], system)
+				continue
+			}
+			algorithm, digest, err := parseChecksum(dep.checksum)
+			if err != nil {
+				// dependencies without a valid checksum can't be in the cache
+				continue
+			}
+			dlFile, err := urlFilename(dep.url)
+			if err != nil {
+				return nil, nil, err
+			}
+			key := c.downloadCacheKey(algorithm, digest, dlFile)
+			add("downloads", key, dep)
+			add("extracts", key, dep)
+			add("bin", c.binCacheKey(dep), dep)
+		}
+	}
+	return result, unbuilt, nil
+}
+
+// cacheEntryValidator returns the validator for an entry or nil when there is nothing to validate it against.
+func (c *Config) cacheEntryValidator(name, key string, dep *Dependency) (func(dir string) error, error) {
+	switch {
+	case name == "extracts":
+		sumFile := extractSumFile(c.cacheDir(), key)
+		_, err := os.Stat(sumFile)
+		if os.IsNotExist(err) {
+			// extracts made before checksums were recorded can't be validated
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return extractValidator(sumFile), nil
+	case dep == nil:
+		return nil, nil
+	case name == "downloads":
+		dlFile, err := urlFilename(dep.url)
+		if err != nil {
+			return nil, err
+		}
+		algorithm, digest, err := parseChecksum(dep.checksum)
+		if err != nil {
+			return nil, err
+		}
+		return downloadValidator(dlFile, algorithm, formatChecksum(algorithm, digest)), nil
+	default:
+		entry, err := c.binCache().Entry(key)
+		if err != nil {
+			return nil, err
+		}
+		if entry.ContentChecksum == "" {
+			// bins cached before checksums were recorded can only be checked for existence
+			return binValidator(dep), nil
+		}
+		return binChecksumValidator(dep, entry.ContentChecksum)
+	}
+}
+
+// repairCacheEntry removes an entry and re-creates it from dep.
+func (c *Config) repairCacheEntry(ctx context.Context, name, key string, dep *Dependency) (CacheStatus, error) {
+	err := c.namedCache(name).Evict(key)
+	if err != nil {
+		return CacheCorrupt, err
+	}
+	if dep == nil {
+		if name == "extracts" {
+			err = os.Remove(extractSumFile(c.cacheDir(), key))
+			if err != nil && !os.IsNotExist(err) {
+				return CacheRemoved, err
+			}
+		}
+		return CacheRemoved, nil
+	}
+	switch name {
+	case "downloads", "extracts":
+		dlFile, _, dlUnlock, err := c.downloadDependency(ctx, dep, false, false)
+		if err != nil {
+			return CacheCorrupt, err
+		}
+		if name == "downloads" {
+			return CacheRepaired, dlUnlock()
+		}
+		_, exUnlock, err := extractDependencyToCache(dlFile, c.cacheDir(), key, c.extractsCache(), dep.cacheMetadata(), false)
+		if err != nil {
+			return CacheCorrupt, errors.Join(dlUnlock(), err)
+		}
+		return CacheRepaired, errors.Join(exUnlock(), dlUnlock())
+	default:
+		_, err = c.install(ctx, dep, "", false, true, false)
+		if err != nil {
+			return CacheCorrupt, err
+		}
+		return CacheRepaired, nil
+	}
+}
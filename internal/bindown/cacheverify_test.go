@@ -0,0 +1,133 @@
+package bindown
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/bindown/v4/internal/testutil"
+)
+
+func TestConfig_VerifyCache(t *testing.T) {
+	ctx := context.Background()
+	servePath := filepath.Join("testdata", "downloadables", "fooinroot.tar.gz")
+	ts := testutil.ServeFile(t, servePath, "/foo/fooinroot.tar.gz", "")
+	depURL := ts.URL + "/foo/fooinroot.tar.gz"
+
+	setup := func(t *testing.T) (cfg *Config, dep *Dependency) {
+		t.Helper()
+		dir := t.TempDir()
+		cfg = mustConfigFromYAML(t, fmt.Sprintf(`
+install_dir: %q
+cache: %q
+systems: [darwin/amd64]
+url_checksums:
+  %s: 27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3
+dependencies:
+  foo:
+    url: %s
+`, filepath.Join(dir, "bin"), filepath.Join(dir, "cache"), depURL, depURL))
+		err := cfg.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{ToCache: true})
+		require.NoError(t, err)
+		dep, err = cfg.BuildDependency("foo", "darwin/amd64")
+		require.NoError(t, err)
+		return cfg, dep
+	}
+
+	dlKey := cacheKey("27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3")
+
+	t.Run("ok", func(t *testing.T) {
+		cfg, dep := setup(t)
+		writeTestFile(t, filepath.Join(cfg.Cache, "downloads", "deadbeef", "bar.tar.gz"), "bar")
+		results, err := cfg.VerifyCache(ctx, false)
+		require.NoError(t, err)
+		require.Equal(t, []CacheVerification{
+			{Cache: "downloads", Key: dlKey, Status: CacheOK, Dependency: "foo", System: "darwin/amd64"},
+			{Cache: "downloads", Key: "deadbeef", Status: CacheUnknown},
+			{Cache: "extracts", Key: dlKey, Status: CacheOK, Dependency: "foo", System: "darwin/amd64"},
+			{Cache: "bin", Key: cfg.binCacheKey(dep), Status: CacheOK, Dependency: "foo", System: "darwin/amd64"},
+		}, results)
+	})
+
+	t.Run("repairs corrupt entries", func(t *testing.T) {
+		cfg, dep := setup(t)
+		writeTestFile(t, filepath.Join(cfg.Cache, "downloads", dlKey, "fooinroot.tar.gz"), "tampered")
+		writeTestFile(t, filepath.Join(cfg.Cache, "extracts", dlKey, "foo"), "tampered")
+		require.NoError(t, os.Remove(filepath.Join(cfg.Cache, "bin", cfg.binCacheKey(dep), "foo")))
+		writeTestFile(t, filepath.Join(cfg.Cache, "extracts", "deadbeef", "bar"), "bar")
+		writeTestFile(t, extractSumFile(cfg.Cache, "deadbeef"), "deadbeef")
+
+		results, err := cfg.VerifyCache(ctx, false)
+		require.NoError(t, err)
+		require.Len(t, results, 4)
+		for _, result := range results {
+			require.Equal(t, CacheCorrupt, result.Status, result.Key)
+			require.NotEmpty(t, result.Error)
+		}
+
+		results, err = cfg.VerifyCache(ctx, true)
+		require.NoError(t, err)
+		var statuses []CacheStatus
+		for _, result := range results {
+			statuses = append(statuses, result.Status)
+		}
+		require.Equal(t, []CacheStatus{CacheRepaired, CacheRepaired, CacheRemoved, CacheRepaired}, statuses)
+		require.NoDirExists(t, filepath.Join(cfg.Cache, "extracts", "deadbeef"))
+
+		results, err = cfg.VerifyCache(ctx, false)
+		require.NoError(t, err)
+		require.Len(t, results, 3)
+		for _, result := range results {
+			require.Equal(t, CacheOK, result.Status, result.Key)
+		}
+	})
+
+	t.Run("extract without a recorded checksum", func(t *testing.T) {
+		cfg, _ := setup(t)
+		require.NoError(t, os.Remove(extractSumFile(cfg.Cache, dlKey)))
+		results, err := cfg.VerifyCache(ctx, true)
+		require.NoError(t, err)
+		require.Equal(t, CacheVerification{
+			Cache: "extracts", Key: dlKey, Status: CacheUnknown, Dependency: "foo", System: "darwin/amd64",
+		}, results[1])
+		require.FileExists(t, filepath.Join(cfg.Cache, "extracts", dlKey, "foo"))
+	})
+
+	t.Run("changed bin", func(t *testing.T) {
+		cfg, dep := setup(t)
+		binFile := filepath.Join(cfg.Cache, "bin", cfg.binCacheKey(dep), "foo")
+		want, err := os.ReadFile(binFile)
+		require.NoError(t, err)
+		writeTestFile(t, binFile, "tampered")
+		results, err := cfg.VerifyCache(ctx, false)
+		require.NoError(t, err)
+		require.Equal(t, CacheCorrupt, results[2].Status)
+		require.Contains(t, results[2].Error, "expected checksum")
+
+		results, err = cfg.VerifyCache(ctx, true)
+		require.NoError(t, err)
+		require.Equal(t, CacheRepaired, results[2].Status)
+		got, err := os.ReadFile(binFile)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("install re-extracts changed files", func(t *testing.T) {
+		cfg, _ := setup(t)
+		extracted := filepath.Join(cfg.Cache, "extracts", dlKey, "foo")
+		want, err := os.ReadFile(extracted)
+		require.NoError(t, err)
+		writeTestFile(t, extracted, "tampered")
+		err = cfg.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", nil)
+		require.NoError(t, err)
+		got, err := os.ReadFile(filepath.Join(cfg.InstallDir, "foo"))
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+		got, err = os.ReadFile(extracted)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+}
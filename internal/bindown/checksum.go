@@ -0,0 +1,153 @@
+package bindown
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// Checksum algorithms
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumSHA512 = "sha512"
+	ChecksumBLAKE3 = "blake3"
+)
+
+// ChecksumAlgorithms are the supported checksum algorithms.
+var ChecksumAlgorithms = []string{ChecksumSHA256, ChecksumSHA512, ChecksumBLAKE3}
+
+// DefaultChecksumAlgorithm is the algorithm for checksums without an algorithm prefix.
+const DefaultChecksumAlgorithm = ChecksumSHA256
+
+func newChecksumHasher(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumSHA512:
+		return sha512.New(), nil
+	case ChecksumBLAKE3:
+		return blake3.New(32, nil), nil
+	}
+	return nil, fmt.Errorf("unknown checksum algorithm %q. must be one of %s", algorithm, strings.Join(ChecksumAlgorithms, ", "))
+}
+
+// parseChecksum splits a url_checksums value like "sha512:abc123" into its algorithm and lowercase hex digest. Values
+// without a prefix are sha256.
+func parseChecksum(checksum string) (algorithm, digest string, err error) {
+	algorithm, digest, ok := strings.Cut(checksum, ":")
+	if !ok {
+		algorithm, digest = DefaultChecksumAlgorithm, checksum
+	}
+	if !slices.Contains(ChecksumAlgorithms, algorithm) {
+		return "", "", fmt.Errorf("checksum %q has unknown algorithm %q", checksum, algorithm)
+	}
+	digest = strings.ToLower(digest)
+	_, err = hex.DecodeString(digest)
+	if err != nil || digest == "" {
+		return "", "", fmt.Errorf("checksum %q is not a valid hex digest", checksum)
+	}
+	return algorithm, digest, nil
+}
+
+// formatChecksum returns the url_checksums value for a digest. sha256 digests don't get a prefix so existing configs
+// don't change.
+func formatChecksum(algorithm, digest string) string {
+	if algorithm == DefaultChecksumAlgorithm {
+		return digest
+	}
+	return algorithm + ":" + digest
+}
+
+// checksumAlgorithm returns the algorithm of a url_checksums value.
+func checksumAlgorithm(checksum string) (string, error) {
+	algorithm, _, err := parseChecksum(checksum)
+	return algorithm, err
+}
+
+// checksumsEqual returns true when a and b are the same checksum. They may differ in hex case or in whether sha256
+// has a prefix.
+func checksumsEqual(a, b string) bool {
+	aAlg, aDigest, err := parseChecksum(a)
+	if err != nil {
+		return false
+	}
+	bAlg, bDigest, err := parseChecksum(b)
+	if err != nil {
+		return false
+	}
+	return aAlg == bAlg && aDigest == bDigest
+}
+
+// multiHasher calculates checksums with several algorithms in one pass.
+type multiHasher struct {
+	algorithms []string
+	hashers    []hash.Hash
+	io.Writer
+}
+
+func newMultiHasher(algorithms ...string) (*multiHasher, error) {
+	mh := &multiHasher{}
+	writers := make([]io.Writer, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		if slices.Contains(mh.algorithms, algorithm) {
+			continue
+		}
+		hasher, err := newChecksumHasher(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		mh.algorithms = append(mh.algorithms, algorithm)
+		mh.hashers = append(mh.hashers, hasher)
+		writers = append(writers, hasher)
+	}
+	mh.Writer = io.MultiWriter(writers...)
+	return mh, nil
+}
+
+// checksum returns the formatted checksum for algorithm. algorithm must be one that mh was created with.
+func (mh *multiHasher) checksum(algorithm string) string {
+	i := slices.Index(mh.algorithms, algorithm)
+	return formatChecksum(algorithm, hex.EncodeToString(mh.hashers[i].Sum(nil)))
+}
+
+// fileChecksum returns the checksum of a file using algorithm.
+func fileChecksum(filename, algorithm string) (_ string, errOut error) {
+	mh, err := newMultiHasher(algorithm)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer deferErr(&errOut, f.Close)
+	_, err = io.Copy(mh, f)
+	if err != nil {
+		return "", err
+	}
+	return mh.checksum(algorithm), nil
+}
+
+// fileExistsWithChecksum returns true if the file both exists and has a matching checksum
+func fileExistsWithChecksum(filename, checksum string) (bool, error) {
+	if !FileExists(filename) {
+		return false, nil
+	}
+	algorithm, err := checksumAlgorithm(checksum)
+	if err != nil {
+		return false, err
+	}
+	got, err := fileChecksum(filename, algorithm)
+	if err != nil {
+		return false, err
+	}
+	return checksumsEqual(checksum, got), nil
+}
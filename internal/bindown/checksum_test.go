@@ -0,0 +1,121 @@
+package bindown
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/bindown/v4/internal/testutil"
+)
+
+const (
+	fooSHA512Checksum = "sha512:d45b19b1c22681fab402e87f7eec51851695321981b35f8e13a3d1001b6d4b03e62589b151b06cea7ffb5d3500d92fdea660e71a1a02e37a0965ce400bc99db6"
+	fooBLAKE3Checksum = "blake3:ddd84d8ebeefd4de0cc06be24d049c205aaefb1586f1b6373c63cd1612efece8"
+)
+
+func Test_parseChecksum(t *testing.T) {
+	for _, td := range []struct {
+		checksum  string
+		algorithm string
+		digest    string
+		err       string
+	}{
+		{checksum: "ABCD", algorithm: "sha256", digest: "abcd"},
+		{checksum: "sha256:abcd", algorithm: "sha256", digest: "abcd"},
+		{checksum: "sha512:abcd", algorithm: "sha512", digest: "abcd"},
+		{checksum: "blake3:abcd", algorithm: "blake3", digest: "abcd"},
+		{checksum: "md5:abcd", err: `checksum "md5:abcd" has unknown algorithm "md5"`},
+		{checksum: "sha512:xyz", err: `checksum "sha512:xyz" is not a valid hex digest`},
+		{checksum: "sha512:", err: `checksum "sha512:" is not a valid hex digest`},
+	} {
+		t.Run(td.checksum, func(t *testing.T) {
+			algorithm, digest, err := parseChecksum(td.checksum)
+			if td.err != "" {
+				require.EqualError(t, err, td.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, td.algorithm, algorithm)
+			require.Equal(t, td.digest, digest)
+		})
+	}
+}
+
+func Test_checksumsEqual(t *testing.T) {
+	require.True(t, checksumsEqual("ABCD", "sha256:abcd"))
+	require.False(t, checksumsEqual("abcd", "sha512:abcd"))
+	require.False(t, checksumsEqual("abcd", "nope:abcd"))
+}
+
+func Test_fileChecksum(t *testing.T) {
+	emptyFile := filepath.Join(t.TempDir(), "empty")
+	writeTestFile(t, emptyFile, "")
+	got, err := fileChecksum(emptyFile, ChecksumBLAKE3)
+	require.NoError(t, err)
+	require.Equal(t, "blake3:af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262", got)
+
+	foo := filepath.Join("testdata", "downloadables", "foo.tar.gz")
+	for _, want := range []string{fooChecksum, fooSHA512Checksum, fooBLAKE3Checksum} {
+		algorithm, err := checksumAlgorithm(want)
+		require.NoError(t, err)
+		got, err = fileChecksum(foo, algorithm)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+
+	_, err = fileChecksum(foo, "md5")
+	require.EqualError(t, err, `unknown checksum algorithm "md5". must be one of sha256, sha512, blake3`)
+}
+
+func TestConfig_AddChecksumsWithAlgorithm(t *testing.T) {
+	ctx := context.Background()
+	ts := testutil.ServeFile(t, filepath.Join("testdata", "downloadables", "foo.tar.gz"), "/foo.tar.gz", "")
+	dlURL := ts.URL + "/foo.tar.gz"
+	newConfig := func(t *testing.T, checksum string) *Config {
+		t.Helper()
+		cfg := mustConfigFromYAML(t, fmt.Sprintf(`
+systems: [linux/amd64]
+dependencies:
+  foo:
+    url: %q
+`, dlURL))
+		if checksum != "" {
+			cfg.URLChecksums = map[string]string{dlURL: checksum}
+		}
+		return cfg
+	}
+
+	t.Run("new checksum", func(t *testing.T) {
+		cfg := newConfig(t, "")
+		require.NoError(t, cfg.AddChecksumsWithAlgorithm(ctx, nil, nil, ChecksumSHA512))
+		require.Equal(t, map[string]string{dlURL: fooSHA512Checksum}, cfg.URLChecksums)
+	})
+
+	t.Run("keeps existing checksums by default", func(t *testing.T) {
+		cfg := newConfig(t, fooSHA512Checksum)
+		require.NoError(t, cfg.AddChecksums(ctx, nil, nil))
+		require.Equal(t, map[string]string{dlURL: fooSHA512Checksum}, cfg.URLChecksums)
+	})
+
+	t.Run("replaces verified checksum", func(t *testing.T) {
+		cfg := newConfig(t, fooChecksum)
+		require.NoError(t, cfg.AddChecksumsWithAlgorithm(ctx, nil, nil, ChecksumBLAKE3))
+		require.Equal(t, map[string]string{dlURL: fooBLAKE3Checksum}, cfg.URLChecksums)
+	})
+
+	t.Run("existing checksum mismatch", func(t *testing.T) {
+		bad := "0000000000000000000000000000000000000000000000000000000000000000"
+		cfg := newConfig(t, bad)
+		err := cfg.AddChecksumsWithAlgorithm(ctx, nil, nil, ChecksumSHA512)
+		require.EqualError(t, err, fmt.Sprintf("checksum mismatch for %s\nwanted: %s\ngot: %s", dlURL, bad, fooChecksum))
+		require.Equal(t, map[string]string{dlURL: bad}, cfg.URLChecksums)
+	})
+
+	t.Run("unknown algorithm", func(t *testing.T) {
+		cfg := newConfig(t, "")
+		err := cfg.AddChecksumsWithAlgorithm(ctx, nil, nil, "md5")
+		require.EqualError(t, err, `unknown checksum algorithm "md5". must be one of sha256, sha512, blake3`)
+	})
+}
@@ -0,0 +1,255 @@
+package bindown
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/willabides/bindown/v4/internal/httpclient"
+)
+
+// MissingChecksum is a dependency url that ImportChecksums didn't find in a checksums file.
+type MissingChecksum struct {
+	Dependency string
+	System     System
+	URL        string
+}
+
+// ImportChecksums adds checksums for dependencies on systems from a checksums file like SHA256SUMS or goreleaser's
+// checksums.txt. source is a file or an http(s) url. algorithm is the algorithm of the checksums in the file. When it
+// is "", it comes from source's name. The checksums file's entries are matched to the file names at the end of the
+// dependencies' urls. Existing checksums for matched urls are replaced. It returns the dependencies and systems whose
+// urls weren't found in the checksums file. When dependencies is empty, all dependencies are used. When systems is
+// empty, each dependency's systems are used.
+func (c *Config) ImportChecksums(
+	ctx context.Context,
+	source, algorithm string,
+	dependencies []string,
+	systems []System,
+) ([]MissingChecksum, error) {
+	ctx = c.httpContext(ctx)
+	var data []byte
+	var err error
+	if isHTTPURL(source) {
+		// checksums are only imported from the original url, so a stale or compromised mirror can't be pinned
+		data, err = downloadBytes(ctx, source, "checksums file")
+	} else {
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if algorithm == "" {
+		algorithm = manifestAlgorithm(source)
+	} else if _, err = newChecksumHasher(algorithm); err != nil {
+		return nil, err
+	}
+	entries := parseChecksumManifest(data, algorithm)
+	// a checksum without a file name can't be matched to a url when there are many
+	delete(entries, "")
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no checksums found in %s", source)
+	}
+	if len(dependencies) == 0 {
+		dependencies = c.DependencyNames()
+		slices.Sort(dependencies)
+	}
+	var missing []MissingChecksum
+	for _, depName := range dependencies {
+		if c.Dependencies[depName] == nil {
+			return nil, fmt.Errorf("no dependency configured with the name %q", depName)
+		}
+		depSystems := systems
+		if len(depSystems) == 0 {
+			depSystems, err = c.DependencySystems(depName)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, system := range depSystems {
+			dep, err := c.BuildDependency(depName, system)
+			if err != nil {
+				return nil, err
+			}
+			sum, err := manifestChecksum(entries, dep.url)
+			if err != nil {
+				return nil, err
+			}
+			if sum == "" {
+				missing = append(missing, MissingChecksum{Dependency: depName, System: system, URL: dep.url})
+				continue
+			}
+			if c.URLChecksums == nil {
+				c.URLChecksums = map[string]string{}
+			}
+			c.URLChecksums[dep.url] = sum
+		}
+	}
+	return missing, nil
+}
+
+// checksumManifests downloads checksums files for AddChecksums. It maps checksums file urls to their content so each
+// file is only downloaded once.
+type checksumManifests map[string][]byte
+
+// checksum returns the checksum of built dependency dep's url from the checksums file at its checksums_url. It returns
+// "" when the checksums file has no entry for the url or when algorithm isn't "" and the entry uses a different
+// algorithm. The checksums file is downloaded from its original url and never from a mirror because nothing verifies
+// it.
+func (m checksumManifests) checksum(ctx context.Context, dep *Dependency, algorithm string) (string, error) {
+	dep.mustBeBuilt()
+	manifestURL := *dep.ChecksumsURL
+	data, ok := m[manifestURL]
+	if !ok {
+		var err error
+		data, err = downloadBytes(ctx, manifestURL, "checksums file")
+		if err != nil {
+			return "", err
+		}
+		m[manifestURL] = data
+	}
+	entries := parseChecksumManifest(data, dep.checksumsAlgorithm())
+	if len(entries) == 0 {
+		return "", fmt.Errorf("no checksums found in checksums file %s", manifestURL)
+	}
+	sum, err := manifestChecksum(entries, dep.url)
+	if err != nil || sum == "" || algorithm == "" {
+		return sum, err
+	}
+	sumAlgorithm, err := checksumAlgorithm(sum)
+	if err != nil || sumAlgorithm != algorithm {
+		return "", err
+	}
+	return sum, nil
+}
+
+// manifestChecksum returns the checksum of the file at dlURL from the parsed entries of a checksums file or "" if
+// there isn't one.
+func manifestChecksum(entries map[string]string, dlURL string) (string, error) {
+	u, err := url.Parse(dlURL)
+	if err != nil {
+		return "", err
+	}
+	sum, ok := entries[path.Base(u.Path)]
+	if !ok && len(entries) == 1 {
+		// a file like foo.tar.gz.sha256 may have only the checksum
+		sum = entries[""]
+	}
+	return sum, nil
+}
+
+// downloadBytes returns the content of the small file at dlURL. what describes the file in errors.
+func downloadBytes(ctx context.Context, dlURL, what string) (_ []byte, errOut error) {
+	resp, err := httpclient.FromContext(ctx).Get(ctx, dlURL)
+	if err != nil {
+		return nil, err
+	}
+	defer deferErr(&errOut, resp.Body.Close)
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("failed downloading %s %s", what, dlURL)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// downloadMirroredBytes is downloadBytes for a file that is downloaded from mirrors before dlURL.
+func downloadMirroredBytes(ctx context.Context, dlURL string, mirrors []string, what string) ([]byte, error) {
+	var data []byte
+	err := tryMirrors(dlURL, mirrors, func(u string) error {
+		var err error
+		data, err = downloadBytes(ctx, u, what)
+		return err
+	})
+	return data, err
+}
+
+// bsdChecksumLine matches lines like "SHA256 (foo.tar.gz) = <hex>".
+var bsdChecksumLine = regexp.MustCompile(`^([A-Za-z0-9-]+) \((.*)\) = ([0-9A-Fa-f]+)$`)
+
+// manifestAlgorithm returns the checksum algorithm in the name of the checksums file at location like SHA256SUMS,
+// checksums.sha512 or foo.tar.gz.b3. It returns "" when the name doesn't have one.
+func manifestAlgorithm(location string) string {
+	name := filepath.Base(location)
+	if isHTTPURL(location) {
+		u, err := url.Parse(location)
+		if err != nil {
+			return ""
+		}
+		name = path.Base(u.Path)
+	}
+	name = strings.ToLower(name)
+	switch {
+	case strings.Contains(name, ChecksumSHA512):
+		return ChecksumSHA512
+	case strings.Contains(name, ChecksumSHA256):
+		return ChecksumSHA256
+	case strings.Contains(name, ChecksumBLAKE3), strings.Contains(name, "b3sum"), path.Ext(name) == ".b3":
+		return ChecksumBLAKE3
+	}
+	return ""
+}
+
+// checksumsAlgorithm returns the algorithm of the checksums in the file at d's checksums_url. It is
+// checksums_algorithm or the algorithm in the file's name. It returns "" when neither has one.
+func (d *Dependency) checksumsAlgorithm() string {
+	if d.ChecksumsAlgorithm != nil && *d.ChecksumsAlgorithm != "" {
+		return *d.ChecksumsAlgorithm
+	}
+	if d.ChecksumsURL == nil {
+		return ""
+	}
+	return manifestAlgorithm(*d.ChecksumsURL)
+}
+
+// parseChecksumManifest returns the checksums from a checksums file keyed by file name. It reads lines in the format
+// of sha256sum and goreleaser like "<hex>  foo.tar.gz" or "<hex> *foo.tar.gz" and BSD style lines like
+// "SHA512 (foo.tar.gz) = <hex>". A line with only a checksum has the key "". algorithm is the algorithm of lines that
+// don't name one. When it is "", those lines are sha256 or sha512 by their length like other checksums without an
+// algorithm. Lines that can't be parsed, use unsupported algorithms or have the wrong length are ignored.
+func parseChecksumManifest(data []byte, algorithm string) map[string]string {
+	entries := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lineAlgorithm, digest, name := algorithm, "", ""
+		if m := bsdChecksumLine.FindStringSubmatch(line); m != nil {
+			lineAlgorithm, name, digest = strings.ToLower(strings.ReplaceAll(m[1], "-", "")), m[2], m[3]
+		} else {
+			var ok bool
+			digest, name, ok = strings.Cut(line, " ")
+			if ok {
+				name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+			}
+		}
+		if lineAlgorithm == "" {
+			lineAlgorithm = DefaultChecksumAlgorithm
+			if len(digest) == 128 {
+				lineAlgorithm = ChecksumSHA512
+			}
+		}
+		lineAlgorithm, digest, err := parseChecksum(lineAlgorithm + ":" + digest)
+		if err != nil {
+			continue
+		}
+		hasher, err := newChecksumHasher(lineAlgorithm)
+		if err != nil || len(digest) != hasher.Size()*2 {
+			continue
+		}
+		if name != "" {
+			name = path.Base(name)
+		}
+		entries[name] = formatChecksum(lineAlgorithm, digest)
+	}
+	return entries
+}
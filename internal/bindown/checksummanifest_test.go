@@ -0,0 +1,254 @@
+package bindown
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseChecksumManifest(t *testing.T) {
+	sha256Sum := strings.Repeat("a", 64)
+	sha512Sum := strings.Repeat("b", 128)
+	manifest := []byte(fmt.Sprintf(`
+# comment
+%s  foo_linux_amd64.tar.gz
+%s *./dist/foo_darwin_amd64.tar.gz
+%s  foo_windows_amd64.zip
+SHA512 (bar.tar.gz) = %s
+BLAKE3 (baz.tar.gz) = %s
+SHA256 (short.tar.gz) = abcd
+MD5 (qux.tar.gz) = 0123456789abcdef0123456789abcdef
+0123456789abcdef0123456789abcdef  qux.tar.gz
+not a checksum line
+`, sha256Sum, strings.ToUpper(sha256Sum), sha512Sum, sha512Sum, sha256Sum))
+
+	t.Run("sha256", func(t *testing.T) {
+		require.Equal(t, map[string]string{
+			"foo_linux_amd64.tar.gz":  sha256Sum,
+			"foo_darwin_amd64.tar.gz": sha256Sum,
+			"bar.tar.gz":              "sha512:" + sha512Sum,
+			"baz.tar.gz":              "blake3:" + sha256Sum,
+		}, parseChecksumManifest(manifest, ChecksumSHA256))
+	})
+
+	t.Run("blake3", func(t *testing.T) {
+		require.Equal(t, map[string]string{
+			"foo_linux_amd64.tar.gz":  "blake3:" + sha256Sum,
+			"foo_darwin_amd64.tar.gz": "blake3:" + sha256Sum,
+			"bar.tar.gz":              "sha512:" + sha512Sum,
+			"baz.tar.gz":              "blake3:" + sha256Sum,
+		}, parseChecksumManifest(manifest, ChecksumBLAKE3))
+	})
+
+	t.Run("unknown algorithm", func(t *testing.T) {
+		require.Equal(t, map[string]string{
+			"foo_linux_amd64.tar.gz":  sha256Sum,
+			"foo_darwin_amd64.tar.gz": sha256Sum,
+			"foo_windows_amd64.zip":   "sha512:" + sha512Sum,
+			"bar.tar.gz":              "sha512:" + sha512Sum,
+			"baz.tar.gz":              "blake3:" + sha256Sum,
+		}, parseChecksumManifest(manifest, ""))
+	})
+
+	t.Run("only a checksum", func(t *testing.T) {
+		require.Equal(t, map[string]string{"": sha256Sum}, parseChecksumManifest([]byte(sha256Sum+"\n"), ChecksumSHA256))
+	})
+}
+
+func Test_manifestAlgorithm(t *testing.T) {
+	for _, td := range []struct {
+		location string
+		want     string
+	}{
+		{location: "SHA256SUMS", want: ChecksumSHA256},
+		{location: filepath.Join("dist", "foo.tar.gz.sha256"), want: ChecksumSHA256},
+		{location: "https://example.com/v1/foo_1.0.0_SHA512SUMS?raw=1", want: ChecksumSHA512},
+		{location: "https://example.com/v1/foo.tar.gz.sha512", want: ChecksumSHA512},
+		{location: "B3SUMS", want: ChecksumBLAKE3},
+		{location: "https://example.com/v1/foo.tar.gz.b3", want: ChecksumBLAKE3},
+		{location: "checksums.blake3", want: ChecksumBLAKE3},
+		{location: "https://example.com/sha512/checksums.txt", want: ""},
+		{location: "checksums.txt", want: ""},
+	} {
+		t.Run(td.location, func(t *testing.T) {
+			require.Equal(t, td.want, manifestAlgorithm(td.location))
+		})
+	}
+}
+
+func TestConfig_AddChecksums_checksumsURL(t *testing.T) {
+	ctx := context.Background()
+	foo, err := os.ReadFile(filepath.Join("testdata", "downloadables", "foo.tar.gz"))
+	require.NoError(t, err)
+	var manifestRequests, downloadRequests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/checksums.txt", func(w http.ResponseWriter, _ *http.Request) {
+		manifestRequests.Add(1)
+		fmt.Fprintf(w, "%s  foo-darwin-amd64.tar.gz\nSHA512 (foo-linux-amd64.tar.gz) = %s\n", fooChecksum, fooSHA512Checksum[len("sha512:"):])
+	})
+	mux.HandleFunc("/foo-windows-amd64.tar.gz.sha256", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, fooChecksum)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
+		downloadRequests.Add(1)
+		_, _ = w.Write(foo)
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	cfg := mustConfigFromYAML(t, fmt.Sprintf(`
+systems: [darwin/amd64, linux/amd64, linux/arm64, windows/amd64]
+dependencies:
+  foo:
+    url: %[1]s/foo-{{.os}}-{{.arch}}.tar.gz
+    checksums_url: %[1]s/checksums.txt
+    checksums_algorithm: sha256
+    overrides:
+      - matcher: {os: [windows]}
+        dependency:
+          checksums_url: %[1]s/foo-{{.os}}-{{.arch}}.tar.gz.sha256
+`, ts.URL))
+	require.NoError(t, cfg.AddChecksums(ctx, nil, nil))
+	require.Equal(t, map[string]string{
+		ts.URL + "/foo-darwin-amd64.tar.gz":  fooChecksum,
+		ts.URL + "/foo-linux-amd64.tar.gz":   fooSHA512Checksum,
+		ts.URL + "/foo-linux-arm64.tar.gz":   fooChecksum,
+		ts.URL + "/foo-windows-amd64.tar.gz": fooChecksum,
+	}, cfg.URLChecksums)
+	require.Equal(t, int32(1), manifestRequests.Load())
+	// only linux/arm64 is missing from checksums.txt
+	require.Equal(t, int32(1), downloadRequests.Load())
+
+	t.Run("different algorithm", func(t *testing.T) {
+		cfg.URLChecksums = nil
+		downloadRequests.Store(0)
+		require.NoError(t, cfg.AddChecksumsWithAlgorithm(ctx, nil, []System{"darwin/amd64", "linux/amd64"}, ChecksumSHA512))
+		require.Equal(t, map[string]string{
+			ts.URL + "/foo-darwin-amd64.tar.gz": fooSHA512Checksum,
+			ts.URL + "/foo-linux-amd64.tar.gz":  fooSHA512Checksum,
+		}, cfg.URLChecksums)
+		require.Equal(t, int32(1), downloadRequests.Load())
+	})
+
+	t.Run("checksums file without algorithm", func(t *testing.T) {
+		cfg.URLChecksums = nil
+		downloadRequests.Store(0)
+		cfg.Dependencies["foo"].ChecksumsAlgorithm = nil
+		t.Cleanup(func() { cfg.Dependencies["foo"].ChecksumsAlgorithm = ptr(ChecksumSHA256) })
+		require.NoError(t, cfg.AddChecksums(ctx, nil, []System{"darwin/amd64", "linux/amd64"}))
+		require.Equal(t, map[string]string{
+			ts.URL + "/foo-darwin-amd64.tar.gz": fooChecksum,
+			ts.URL + "/foo-linux-amd64.tar.gz":  fooSHA512Checksum,
+		}, cfg.URLChecksums)
+		// darwin's line is read as sha256
+		require.Equal(t, int32(0), downloadRequests.Load())
+	})
+
+	t.Run("invalid checksums_algorithm", func(t *testing.T) {
+		cfg.URLChecksums = nil
+		cfg.Dependencies["foo"].ChecksumsAlgorithm = ptr("md5")
+		t.Cleanup(func() { cfg.Dependencies["foo"].ChecksumsAlgorithm = ptr(ChecksumSHA256) })
+		err := cfg.AddChecksums(ctx, nil, []System{"darwin/amd64"})
+		require.ErrorContains(t, err, `dependency "foo": checksums_algorithm: unknown checksum algorithm "md5"`)
+	})
+
+	t.Run("missing checksums file", func(t *testing.T) {
+		cfg.URLChecksums = nil
+		cfg.Dependencies["foo"].ChecksumsURL = ptr(ts.URL + "/missing/checksums.txt")
+		mux.HandleFunc("/missing/", http.NotFound)
+		err := cfg.AddChecksums(ctx, nil, []System{"darwin/amd64"})
+		require.EqualError(t, err, fmt.Sprintf("failed downloading checksums file %s/missing/checksums.txt", ts.URL))
+	})
+
+	t.Run("no checksums in checksums file", func(t *testing.T) {
+		cfg.URLChecksums = nil
+		downloadRequests.Store(0)
+		cfg.Dependencies["foo"].ChecksumsURL = ptr(ts.URL + "/empty/checksums.txt")
+		mux.HandleFunc("/empty/checksums.txt", func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprintln(w, "not a checksum")
+		})
+		err := cfg.AddChecksums(ctx, nil, []System{"darwin/amd64"})
+		require.EqualError(t, err, fmt.Sprintf("no checksums found in checksums file %s/empty/checksums.txt", ts.URL))
+		require.Equal(t, int32(0), downloadRequests.Load())
+	})
+}
+
+func TestConfig_ImportChecksums(t *testing.T) {
+	ctx := context.Background()
+	sha256Sum := strings.Repeat("a", 64)
+	sha512Sum := strings.Repeat("b", 128)
+	newConfig := func(t *testing.T) *Config {
+		t.Helper()
+		return mustConfigFromYAML(t, `
+systems: [darwin/amd64, linux/amd64, linux/arm64]
+dependencies:
+  foo:
+    url: https://example.com/v{{.version}}/foo_{{.os}}_{{.arch}}.tar.gz
+    vars:
+      version: 1.2.3
+  bar:
+    url: https://example.com/bar_{{.os}}_{{.arch}}.tar.gz
+url_checksums:
+  https://example.com/v1.2.3/foo_darwin_amd64.tar.gz: old
+`)
+	}
+	manifest := fmt.Sprintf("%s  foo_darwin_amd64.tar.gz\nSHA512 (foo_linux_amd64.tar.gz) = %s\n%s  bar_linux_amd64.tar.gz\n",
+		sha256Sum, sha512Sum, sha256Sum)
+
+	t.Run("file", func(t *testing.T) {
+		cfg := newConfig(t)
+		manifestFile := filepath.Join(t.TempDir(), "SHA256SUMS")
+		writeTestFile(t, manifestFile, manifest)
+		missing, err := cfg.ImportChecksums(ctx, manifestFile, "", []string{"foo"}, nil)
+		require.NoError(t, err)
+		require.Equal(t, []MissingChecksum{
+			{Dependency: "foo", System: "linux/arm64", URL: "https://example.com/v1.2.3/foo_linux_arm64.tar.gz"},
+		}, missing)
+		require.Equal(t, map[string]string{
+			"https://example.com/v1.2.3/foo_darwin_amd64.tar.gz": sha256Sum,
+			"https://example.com/v1.2.3/foo_linux_amd64.tar.gz":  "sha512:" + sha512Sum,
+		}, cfg.URLChecksums)
+	})
+
+	t.Run("url", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprint(w, manifest)
+		}))
+		t.Cleanup(ts.Close)
+		cfg := newConfig(t)
+		missing, err := cfg.ImportChecksums(ctx, ts.URL+"/checksums.txt", ChecksumSHA256, nil, []System{"linux/amd64"})
+		require.NoError(t, err)
+		require.Empty(t, missing)
+		require.Equal(t, map[string]string{
+			"https://example.com/v1.2.3/foo_darwin_amd64.tar.gz": "old",
+			"https://example.com/v1.2.3/foo_linux_amd64.tar.gz":  "sha512:" + sha512Sum,
+			"https://example.com/bar_linux_amd64.tar.gz":         sha256Sum,
+		}, cfg.URLChecksums)
+	})
+
+	t.Run("no checksums", func(t *testing.T) {
+		cfg := newConfig(t)
+		manifestFile := filepath.Join(t.TempDir(), "foo.tar.gz.sha256")
+		writeTestFile(t, manifestFile, sha256Sum+"\n")
+		_, err := cfg.ImportChecksums(ctx, manifestFile, "", nil, nil)
+		require.EqualError(t, err, "no checksums found in "+manifestFile)
+	})
+
+	t.Run("algorithm", func(t *testing.T) {
+		cfg := newConfig(t)
+		manifestFile := filepath.Join(t.TempDir(), "checksums.txt")
+		writeTestFile(t, manifestFile, fmt.Sprintf("%s  foo_darwin_amd64.tar.gz\n", sha256Sum))
+		missing, err := cfg.ImportChecksums(ctx, manifestFile, ChecksumBLAKE3, []string{"foo"}, []System{"darwin/amd64"})
+		require.NoError(t, err)
+		require.Empty(t, missing)
+		require.Equal(t, "blake3:"+sha256Sum, cfg.URLChecksums["https://example.com/v1.2.3/foo_darwin_amd64.tar.gz"])
+	})
+}
@@ -1,6 +1,7 @@
 package bindown
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"encoding/json"
@@ -8,29 +9,46 @@ import (
 	"fmt"
 	"hash/fnv"
 	"io"
-	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/pmezard/go-difflib/difflib"
 	"github.com/willabides/bindown/v4/internal/cache"
+	"github.com/willabides/bindown/v4/internal/httpclient"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
+	// The version of the config format. Configs without a version are version 0. Use `bindown config migrate` to
+	// upgrade a config to the latest version.
+	Version int `json:"version,omitempty" yaml:"version,omitempty"`
+
 	// The directory where bindown will cache downloads and extracted files. This is relative to the directory where
 	// the configuration file resides. cache paths should always use / as a delimiter even on Windows or other
 	// operating systems where the native delimiter isn't /.
 	Cache string `json:"cache,omitempty" yaml:"cache,omitempty"`
 
+	// Remove write permission from cached downloads, extracts and installs so tools can't change them by accident.
+	// Entries are made writable again before bindown replaces or removes them.
+	SealCache *bool `json:"seal_cache,omitempty" yaml:"seal_cache,omitempty"`
+
 	// The directory that bindown installs files to. This is relative to the directory where the configuration file
 	// resides. install_directory paths should always use / as a delimiter even on Windows or other operating systems
 	// where the native delimiter isn't /.
 	InstallDir string `json:"install_dir,omitempty" yaml:"install_dir,omitempty"`
 
+	// Other config files to merge into this config. Values are paths relative to the directory where this
+	// configuration file resides or http(s) URLs. Systems, dependencies, templates, template_sources and url_checksums
+	// from imported files are merged into this config. Values from the importing file take precedence over values
+	// from the files it imports. It is an error for two imported files to define the same entry with different
+	// values. cache, seal_cache, install_dir, url_rewrites and hosts are only read from the root configuration file.
+	Imports []string `json:"imports,omitempty" yaml:"imports,omitempty"`
+
 	// List of systems supported by this config. Systems are in the form of os/architecture.
 	Systems []System `json:"systems,omitempty" yaml:"systems,omitempty"`
 
@@ -43,10 +61,45 @@ type Config struct {
 	// Upstream sources for templates.
 	TemplateSources map[string]string `json:"template_sources,omitempty" yaml:"template_sources,omitempty"`
 
-	// Checksums of downloaded files.
+	// Rules that rewrite download urls to mirrors. The mirrors are tried in order before the original url. Checksums
+	// are still looked up by the original url.
+	URLRewrites []URLRewrite `json:"url_rewrites,omitempty" yaml:"url_rewrites,omitempty"`
+
+	// Settings for requests to hosts. Keys are host names with or without a port. Use this to send credentials for
+	// private downloads. hosts are usually kept in the local overlay so credentials aren't committed.
+	Hosts map[string]*HostConfig `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+
+	// Checksums of downloaded files. Values are sha256 hex digests or digests prefixed with their algorithm like
+	// "sha512:<hex>" or "blake3:<hex>".
 	URLChecksums map[string]string `json:"url_checksums,omitempty" yaml:"url_checksums,omitempty"`
 
 	Filename string `json:"-" yaml:"-"`
+
+	// imported holds the unmerged content of every file imported by this config.
+	imported []*Config
+	// owners maps entries that were merged from an imported file to that file's name.
+	owners map[entryKey]string
+	// overlay is the local overlay applied by LoadOverlay.
+	overlay *Config
+	// base holds the content of the config from before the overlay was applied.
+	base *Config
+	// raw is the content of the file this config was read from or last written to. WriteFile patches it to preserve
+	// comments and formatting.
+	raw []byte
+	// lockfile is the name of the lockfile that holds this config's checksums.
+	lockfile string
+	// inlineChecksums are the urls whose checksums were in the root config's url_checksums when it was loaded with a
+	// lockfile. They stay in the root config until UseLockfile moves them.
+	inlineChecksums map[string]bool
+	// extraURLRewrites are rewrites from AddURLRewrites.
+	extraURLRewrites []URLRewrite
+	// removeLockfile is the name of a lockfile WriteFile should delete after InlineChecksums.
+	removeLockfile string
+	// sharedCacheDir is the root of the shared cache set by UseSharedCache. It is used instead of Cache without
+	// changing Cache, so the shared cache is never written to the config file.
+	sharedCacheDir string
+	// defaultSharedCache is true when sharedCacheDir came from UseDefaultSharedCache.
+	defaultSharedCache bool
 }
 
 func (c *Config) DependencyNames() []string {
@@ -159,14 +212,17 @@ func (c *Config) BuildDependency(depName string, system System) (*Dependency, er
 	if dep == nil {
 		return nil, fmt.Errorf("no dependency configured with the name %q", depName)
 	}
+	depPtr := jsonPointer(sectionDependencies, depName)
 	dep = dep.clone()
 	err := dep.applyTemplate(c.Templates, 0)
 	if err != nil {
-		return nil, err
+		chain := c.templateChain(depName)
+		ptr := chain[len(chain)-1].ptr + "/template"
+		return nil, c.errorAt(ptr, fmt.Errorf("%s: %w", describePointer(ptr), err))
 	}
 	err = dep.applyOverrides(system, 0)
 	if err != nil {
-		return nil, err
+		return nil, c.errorAt(depPtr, fmt.Errorf("dependency %q: %w", depName, err))
 	}
 	if dep.Vars == nil {
 		dep.Vars = map[string]string{}
@@ -179,16 +235,55 @@ func (c *Config) BuildDependency(depName string, system System) (*Dependency, er
 	}
 	dep.Vars = varsWithSubstitutions(dep.Vars, dep.Substitutions)
 	err = dep.interpolateVars(system)
+	var fieldErr *templateFieldError
+	if errors.As(err, &fieldErr) {
+		ptr := c.fieldPointer(depName, fieldErr.field, fieldErr.value)
+		desc := describePointer(ptr)
+		if !strings.HasPrefix(ptr, depPtr+"/") {
+			desc = fmt.Sprintf("dependency %q: %s", depName, desc)
+		}
+		return nil, c.errorAt(ptr, fmt.Errorf("%s: %w", desc, fieldErr.err))
+	}
 	if err != nil {
 		return nil, err
 	}
 	if dep.URL == nil {
-		return nil, fmt.Errorf("dependency %q has no URL", depName)
+		return nil, c.errorAt(depPtr, fmt.Errorf("dependency %q has no URL", depName))
+	}
+	if dep.ChecksumsAlgorithm != nil && *dep.ChecksumsAlgorithm != "" {
+		_, err = newChecksumHasher(*dep.ChecksumsAlgorithm)
+		if err != nil {
+			return nil, c.errorAt(depPtr, fmt.Errorf("dependency %q: checksums_algorithm: %w", depName, err))
+		}
+	}
+	if dep.Signature != nil {
+		err = dep.Signature.validate()
+		if err != nil {
+			return nil, c.errorAt(depPtr, fmt.Errorf("dependency %q: %w", depName, err))
+		}
+		keyPtr := c.fieldPointer(depName, "signature/public_key_file", dep.Signature.PublicKeyFile)
+		resolveSignatureKeyFile(dep.Signature, c.pointerFilename(depName, keyPtr))
 	}
 	checksum := ""
 	if c.URLChecksums != nil && dep.URL != nil {
 		checksum = c.URLChecksums[*dep.URL]
 	}
+	dep.mirrors, err = c.mirrorURLs(*dep.URL)
+	if err != nil {
+		return nil, c.errorAt(jsonPointer("url_rewrites"), err)
+	}
+	if dep.Signature != nil {
+		dep.signatureMirrors, err = c.mirrorURLs(dep.Signature.URL)
+		if err != nil {
+			return nil, c.errorAt(jsonPointer("url_rewrites"), err)
+		}
+	}
+	if dep.ChecksumsURL != nil && *dep.ChecksumsURL != "" {
+		dep.checksumsMirrors, err = c.mirrorURLs(*dep.ChecksumsURL)
+		if err != nil {
+			return nil, c.errorAt(jsonPointer("url_rewrites"), err)
+		}
+	}
 	dep.built = true
 	dep.name = depName
 	dep.system = system
@@ -197,6 +292,100 @@ func (c *Config) BuildDependency(depName string, system System) (*Dependency, er
 	return dep, nil
 }
 
+// templateSource is a dependency or template that a dependency's values come from.
+type templateSource struct {
+	ptr     string
+	section string
+	name    string
+	dep     *Dependency
+}
+
+// templateChain returns the dependency depName followed by the templates it uses in the order they are applied.
+func (c *Config) templateChain(depName string) []templateSource {
+	dep := c.Dependencies[depName]
+	chain := []templateSource{{
+		ptr:     jsonPointer(sectionDependencies, depName),
+		section: sectionDependencies,
+		name:    depName,
+		dep:     dep,
+	}}
+	for len(chain) <= maxTemplateDepth && dep.Template != nil && *dep.Template != "" {
+		name := *dep.Template
+		dep = c.Templates[name]
+		if dep == nil {
+			break
+		}
+		chain = append(chain, templateSource{
+			ptr:     jsonPointer(sectionTemplates, name),
+			section: sectionTemplates,
+			name:    name,
+			dep:     dep,
+		})
+	}
+	return chain
+}
+
+// fieldPointer returns a JSON pointer to the value a field of dependency depName was built from. value is the
+// field's value after templates and overrides were applied but before it was interpolated.
+func (c *Config) fieldPointer(depName, field, value string) string {
+	chain := c.templateChain(depName)
+	// overrides take precedence over plain values, and later overrides take precedence over earlier ones
+	var findOverride func(ptr string, o *Overrideable) string
+	findOverride = func(ptr string, o *Overrideable) string {
+		for i := len(o.Overrides) - 1; i >= 0; i-- {
+			overridePtr := ptr + "/overrides/" + strconv.Itoa(i) + "/dependency"
+			override := &o.Overrides[i].Dependency
+			found := findOverride(overridePtr, override)
+			if found != "" {
+				return found
+			}
+			v := pointerFields(override)[field]
+			if v != nil && *v == value {
+				return overridePtr + "/" + field
+			}
+		}
+		return ""
+	}
+	for _, src := range chain {
+		found := findOverride(src.ptr, &src.dep.Overrideable)
+		if found != "" {
+			return found
+		}
+	}
+	for _, src := range chain {
+		v := pointerFields(&src.dep.Overrideable)[field]
+		if v != nil && *v == value {
+			return src.ptr + "/" + field
+		}
+	}
+	return chain[0].ptr
+}
+
+// pointerFields returns the fields fieldPointer can find. They are the template fields and the signature's
+// public_key_file.
+func pointerFields(o *Overrideable) map[string]*string {
+	fields := templateFields(o)
+	if o.Signature != nil {
+		fields["signature/public_key_file"] = &o.Signature.PublicKeyFile
+	}
+	return fields
+}
+
+// pointerFilename returns the config file that defines the value at ptr, which is in dependency depName or one of
+// its templates. Values from imported files belong to the file they were imported from.
+func (c *Config) pointerFilename(depName, ptr string) string {
+	for _, src := range c.templateChain(depName) {
+		if ptr != src.ptr && !strings.HasPrefix(ptr, src.ptr+"/") {
+			continue
+		}
+		if owner := c.owner(src.section, src.name); owner != "" {
+			return owner
+		}
+		break
+	}
+	return c.Filename
+}
+
 // defaultSystems returns c.Systems if it isn't empty. Otherwise returns the runtime system.
 func (c *Config) defaultSystems() []System {
 	if len(c.Systems) > 0 {
@@ -206,8 +395,23 @@ func (c *Config) defaultSystems() []System {
 }
 
 // AddChecksums downloads, calculates checksums and adds them to the config's URLChecksums. AddChecksums skips urls that
-// already exist in URLChecksums.
-func (c *Config) AddChecksums(dependencies []string, systems []System) error {
+// already exist in URLChecksums. New checksums use DefaultChecksumAlgorithm. Dependencies with a checksums_url get
+// checksums from the checksums file instead, and their urls are only downloaded when the checksums file doesn't list
+// them.
+func (c *Config) AddChecksums(ctx context.Context, dependencies []string, systems []System) error {
+	return c.AddChecksumsWithAlgorithm(ctx, dependencies, systems, "")
+}
+
+// AddChecksumsWithAlgorithm is AddChecksums with new checksums calculated using algorithm. When algorithm isn't "",
+// existing checksums that use a different algorithm are replaced after verifying the download against them.
+func (c *Config) AddChecksumsWithAlgorithm(ctx context.Context, dependencies []string, systems []System, algorithm string) error {
+	ctx = c.httpContext(ctx)
+	if algorithm != "" {
+		_, err := newChecksumHasher(algorithm)
+		if err != nil {
+			return err
+		}
+	}
 	if len(dependencies) == 0 && c.Dependencies != nil {
 		dependencies = make([]string, 0, len(c.Dependencies))
 		for dlName := range c.Dependencies {
@@ -215,6 +419,7 @@ func (c *Config) AddChecksums(dependencies []string, systems []System) error {
 		}
 	}
 	var err error
+	manifests := checksumManifests{}
 	for _, depName := range dependencies {
 		depSystems := systems
 		if len(depSystems) == 0 {
@@ -228,7 +433,7 @@ func (c *Config) AddChecksums(dependencies []string, systems []System) error {
 			return fmt.Errorf("no dependency configured with the name %q", depName)
 		}
 		for _, system := range depSystems {
-			err = c.addChecksum(depName, system)
+			err = c.addChecksum(ctx, depName, system, algorithm, manifests)
 			if err != nil {
 				return err
 			}
@@ -262,28 +467,74 @@ func (c *Config) PruneChecksums() error {
 	return nil
 }
 
-func (c *Config) addChecksum(dependencyName string, system System) error {
+func (c *Config) addChecksum(ctx context.Context, dependencyName string, system System, algorithm string, manifests checksumManifests) error {
 	dep, err := c.BuildDependency(dependencyName, system)
 	if err != nil {
 		return err
 	}
 	existingSum := c.URLChecksums[dep.url]
+	if existingSum == "" && dep.ChecksumsURL != nil && *dep.ChecksumsURL != "" {
+		var sum string
+		sum, err = manifests.checksum(ctx, dep, algorithm)
+		if err != nil {
+			return err
+		}
+		if sum != "" {
+			if c.URLChecksums == nil {
+				c.URLChecksums = make(map[string]string, 1)
+			}
+			c.URLChecksums[dep.url] = sum
+			return nil
+		}
+	}
+	algorithms := []string{algorithm}
+	if algorithm == "" {
+		algorithms[0] = DefaultChecksumAlgorithm
+	}
 	if existingSum != "" {
-		return nil
+		if algorithm == "" {
+			return nil
+		}
+		existingAlgorithm, err := checksumAlgorithm(existingSum)
+		if err != nil {
+			return err
+		}
+		if existingAlgorithm == algorithm {
+			return nil
+		}
+		algorithms = append(algorithms, existingAlgorithm)
+	}
+	var sums *multiHasher
+	if existingSum == "" {
+		// a new checksum only comes from the original url, so a stale or compromised mirror can't be pinned
+		sums, err = getURLChecksums(ctx, dep.url, "", algorithms...)
+	} else {
+		// the existing checksum verifies the file, so it can come from a mirror
+		err = tryMirrors(dep.url, dep.mirrors, func(u string) error {
+			var urlErr error
+			sums, urlErr = getURLChecksums(ctx, u, "", algorithms...)
+			if urlErr != nil {
+				return urlErr
+			}
+			got := sums.checksum(algorithms[1])
+			if !checksumsEqual(existingSum, got) {
+				return fmt.Errorf("checksum mismatch for %s\nwanted: %s\ngot: %s", dep.url, existingSum, got)
+			}
+			return nil
+		})
 	}
-	sum, err := getURLChecksum(dep.url, "")
 	if err != nil {
 		return err
 	}
 	if c.URLChecksums == nil {
 		c.URLChecksums = make(map[string]string, 1)
 	}
-	c.URLChecksums[dep.url] = sum
+	c.URLChecksums[dep.url] = sums.checksum(algorithms[0])
 	return nil
 }
 
 // Validate installs the downloader to a temporary directory and returns an error if it was unsuccessful.
-func (c *Config) Validate(depName string, systems []System) (errOut error) {
+func (c *Config) Validate(ctx context.Context, depName string, systems []System) (errOut error) {
 	tmpDir, err := os.MkdirTemp("", "bindown-validate")
 	if err != nil {
 		return err
@@ -291,11 +542,12 @@ func (c *Config) Validate(depName string, systems []System) (errOut error) {
 	defer deferErr(&errOut, func() error {
 		return os.RemoveAll(tmpDir)
 	})
-	installDir, cacheDir := c.InstallDir, c.Cache
+	installDir, cacheDir, sharedCacheDir := c.InstallDir, c.Cache, c.sharedCacheDir
 	c.InstallDir = filepath.Join(tmpDir, "bin")
 	c.Cache = filepath.Join(tmpDir, "cache")
+	c.sharedCacheDir = ""
 	defer func() {
-		c.InstallDir, c.Cache = installDir, cacheDir
+		c.InstallDir, c.Cache, c.sharedCacheDir = installDir, cacheDir, sharedCacheDir
 	}()
 	depSystems := systems
 	if len(depSystems) == 0 {
@@ -305,7 +557,7 @@ func (c *Config) Validate(depName string, systems []System) (errOut error) {
 		}
 	}
 	for _, system := range depSystems {
-		err = c.InstallDependencies([]string{depName}, system, &ConfigInstallDependenciesOpts{
+		err = c.InstallDependencies(ctx, []string{depName}, system, &ConfigInstallDependenciesOpts{
 			Force: true,
 		})
 		if err != nil {
@@ -315,7 +567,24 @@ func (c *Config) Validate(depName string, systems []System) (errOut error) {
 	return nil
 }
 
+// ClearCache removes the cache. It can't be used with a shared cache because other projects use it. Use
+// ClearSharedCache for that.
 func (c *Config) ClearCache() error {
+	if c.sharedCacheDir != "" {
+		return errors.New("can't clear a shared cache because other projects use it")
+	}
+	return c.clearCache()
+}
+
+// ClearSharedCache removes the shared cache c uses, including the entries of every other project.
+func (c *Config) ClearSharedCache() error {
+	if c.sharedCacheDir == "" {
+		return errors.New("not using a shared cache")
+	}
+	return c.clearCache()
+}
+
+func (c *Config) clearCache() error {
 	err := cache.RemoveRoot(c.downloadsCache().Root)
 	if err != nil {
 		return err
@@ -324,18 +593,58 @@ func (c *Config) ClearCache() error {
 	if err != nil {
 		return err
 	}
-	return os.RemoveAll(c.Cache)
+	err = cache.RemoveRoot(c.binCache().Root)
+	if err != nil {
+		return err
+	}
+	return removeCacheDir(c.cacheDir())
+}
+
+// removeCacheDir removes everything in a cache dir except the config lock and its .gitignore, which another process
+// may be holding. The dir itself is only removed when nothing is left in it.
+func removeCacheDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	kept := false
+	for _, entry := range entries {
+		if entry.Name() == configLockName || entry.Name() == ".gitignore" {
+			kept = true
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	if kept {
+		return nil
+	}
+	return os.Remove(dir)
 }
 
 func (c *Config) downloadsCache() *cache.Cache {
 	return &cache.Cache{
-		Root: filepath.Join(c.Cache, "downloads"),
+		Root:     filepath.Join(c.cacheDir(), "downloads"),
+		ReadOnly: c.SealCache != nil && *c.SealCache,
 	}
 }
 
 func (c *Config) extractsCache() *cache.Cache {
 	return &cache.Cache{
-		Root: filepath.Join(c.Cache, "extracts"),
+		Root:     filepath.Join(c.cacheDir(), "extracts"),
+		ReadOnly: c.SealCache != nil && *c.SealCache,
+	}
+}
+
+func (c *Config) binCache() *cache.Cache {
+	return &cache.Cache{
+		Root:     filepath.Join(c.cacheDir(), "bin"),
+		ReadOnly: c.SealCache != nil && *c.SealCache,
 	}
 }
 
@@ -352,10 +661,11 @@ type ConfigDownloadDependenciesOpts struct {
 	Stdout               io.Writer
 }
 
-func (c *Config) DownloadDependencies(deps []string, system System, opts *ConfigDownloadDependenciesOpts) error {
+func (c *Config) DownloadDependencies(ctx context.Context, deps []string, system System, opts *ConfigDownloadDependenciesOpts) error {
 	if opts == nil {
 		opts = &ConfigDownloadDependenciesOpts{}
 	}
+	ctx = c.httpContext(ctx)
 	if opts.AllDeps {
 		deps = c.DependencyNames()
 	}
@@ -364,7 +674,7 @@ func (c *Config) DownloadDependencies(deps []string, system System, opts *Config
 		if err != nil {
 			return err
 		}
-		dlFile, _, unlock, err := downloadDependency(dep, c.downloadsCache(), opts.AllowMissingChecksum, opts.Force)
+		dlFile, _, unlock, err := c.downloadDependency(ctx, dep, opts.AllowMissingChecksum, opts.Force)
 		if err != nil {
 			return err
 		}
@@ -397,10 +707,11 @@ type ConfigExtractDependenciesOpts struct {
 	Stdout               io.Writer
 }
 
-func (c *Config) ExtractDependencies(deps []string, system System, opts *ConfigExtractDependenciesOpts) error {
+func (c *Config) ExtractDependencies(ctx context.Context, deps []string, system System, opts *ConfigExtractDependenciesOpts) error {
 	if opts == nil {
 		opts = &ConfigExtractDependenciesOpts{}
 	}
+	ctx = c.httpContext(ctx)
 	if opts.AllDeps {
 		deps = c.DependencyNames()
 	}
@@ -409,11 +720,11 @@ func (c *Config) ExtractDependencies(deps []string, system System, opts *ConfigE
 		if err != nil {
 			return err
 		}
-		dlFile, key, dlUnlock, err := downloadDependency(dep, c.downloadsCache(), opts.AllowMissingChecksum, false)
+		dlFile, key, dlUnlock, err := c.downloadDependency(ctx, dep, opts.AllowMissingChecksum, false)
 		if err != nil {
 			return err
 		}
-		outDir, unlock, err := extractDependencyToCache(dlFile, c.Cache, key, c.extractsCache(), false)
+		outDir, unlock, err := extractDependencyToCache(dlFile, c.cacheDir(), key, c.extractsCache(), dep.cacheMetadata(), false)
 		if err != nil {
 			return errors.Join(dlUnlock(), err)
 		}
@@ -455,10 +766,11 @@ type ConfigInstallDependenciesOpts struct {
 	AllDeps              bool
 }
 
-func (c *Config) InstallDependencies(deps []string, system System, opts *ConfigInstallDependenciesOpts) error {
+func (c *Config) InstallDependencies(ctx context.Context, deps []string, system System, opts *ConfigInstallDependenciesOpts) error {
 	if opts == nil {
 		opts = &ConfigInstallDependenciesOpts{}
 	}
+	ctx = c.httpContext(ctx)
 	if opts.AllDeps {
 		deps = c.DependencyNames()
 	}
@@ -477,7 +789,7 @@ func (c *Config) InstallDependencies(deps []string, system System, opts *ConfigI
 		if outputIsDir {
 			target = filepath.Join(output, dep.binName())
 		}
-		out, err := install(dep, target, c.Cache, opts.Force, opts.ToCache, opts.AllowMissingChecksum)
+		out, err := c.install(ctx, dep, target, opts.Force, opts.ToCache, opts.AllowMissingChecksum)
 		if err != nil {
 			return err
 		}
@@ -506,7 +818,7 @@ type ConfigWrapDependenciesOpts struct {
 	Stdout               io.Writer
 }
 
-func (c *Config) WrapDependencies(deps []string, opts *ConfigWrapDependenciesOpts) error {
+func (c *Config) WrapDependencies(ctx context.Context, deps []string, opts *ConfigWrapDependenciesOpts) error {
 	if opts == nil {
 		opts = &ConfigWrapDependenciesOpts{}
 	}
@@ -540,7 +852,7 @@ func (c *Config) WrapDependencies(deps []string, opts *ConfigWrapDependenciesOpt
 		if outputIsDir {
 			target = filepath.Join(output, "bindown")
 		}
-		out, err := createBindownWrapper(target, c.Cache, opts.BindownTag, opts.BaseURL)
+		out, err := createBindownWrapper(ctx, target, c.cacheDir(), opts.BindownTag, opts.BaseURL)
 		if err != nil {
 			return err
 		}
@@ -570,7 +882,10 @@ func (c *Config) WrapDependencies(deps []string, opts *ConfigWrapDependenciesOpt
 		if name == "bindown" && wrapsSelf {
 			continue
 		}
-		out, err := createWrapper(name, target, bindownExec, c.Cache, c.Filename, opts.AllowMissingChecksum)
+		out, err := createWrapper(
+			name, target, bindownExec, c.cacheDir(), c.Filename,
+			c.sharedCacheDir != "", c.defaultSharedCache, opts.AllowMissingChecksum,
+		)
 		if err != nil {
 			return err
 		}
@@ -683,6 +998,7 @@ func (c *Config) addTemplateFromSource(ctx context.Context, src, srcTemplate, de
 	if c.Templates == nil {
 		c.Templates = map[string]*Dependency{}
 	}
+	rebaseSignatureKeyFiles(&tmpl.Overrideable, srcCfg.Filename, c.Filename)
 	c.Templates[destName] = tmpl
 	return varVals, nil
 }
@@ -748,49 +1064,147 @@ func (c *Config) DependencySystems(depName string) ([]System, error) {
 	return result, nil
 }
 
-func (c *Config) WriteFile(outputJSON bool) (errOut error) {
+// WriteFile writes the config to c.Filename. Entries that were imported from another file are written back to that
+// file. Values from an overlay are not written. Each file is replaced atomically. Use LockConfigFiles with LocalFiles to
+// keep concurrent updates from overwriting each other.
+func (c *Config) WriteFile(outputJSON bool) error {
 	if c.Filename == "" {
 		return fmt.Errorf("no filename specified")
 	}
-	if filepath.Ext(c.Filename) == ".json" {
-		outputJSON = true
+	root, imports := c.splitFiles()
+	err := c.writeImports(imports)
+	if err != nil {
+		return err
+	}
+	err = root.writeFile(outputJSON)
+	if err != nil {
+		return err
+	}
+	c.raw = root.raw
+	if c.removeLockfile != "" {
+		err = os.Remove(c.removeLockfile)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		c.removeLockfile = ""
 	}
-	file, err := os.Create(c.Filename)
+	return nil
+}
+
+// DiscardFormatting makes the next call to WriteFile write the root config file from scratch instead of preserving
+// its comments and formatting.
+func (c *Config) DiscardFormatting() {
+	c.raw = nil
+}
+
+// RootConfig returns the content of the root config file without values from imports or an overlay.
+func (c *Config) RootConfig() *Config {
+	root, _ := c.splitFiles()
+	return root
+}
+
+func (c *Config) writeFile(outputJSON bool) error {
+	content, err := c.encodeFile(outputJSON)
 	if err != nil {
 		return err
 	}
-	defer deferErr(&errOut, file.Close)
+	err = writeFileAtomic(c.Filename, content)
+	if err != nil {
+		return err
+	}
+	c.raw = content
+	return nil
+}
+
+// encodeFile returns the content WriteFile would write to c's file. TOML files are always encoded from scratch. yaml
+// files are patched in place when possible, otherwise they are encoded from scratch with their comments kept.
+func (c *Config) encodeFile(outputJSON bool) ([]byte, error) {
+	if isTOMLFile(c.Filename) {
+		slices.Sort(c.Systems)
+		return encodeTOML(c)
+	}
+	if filepath.Ext(c.Filename) == ".json" {
+		outputJSON = true
+	}
+	if !outputJSON {
+		patched, ok := patchYaml(c.raw, c)
+		if ok {
+			return patched, nil
+		}
+	}
 	slices.Sort(c.Systems)
+	if !outputJSON {
+		// the formatting can't be kept, but the comments can
+		encoded, ok := encodeYamlWithComments(c.raw, c)
+		if ok {
+			return encoded, nil
+		}
+	}
+	var buf bytes.Buffer
 	if outputJSON {
-		encoder := json.NewEncoder(file)
+		encoder := json.NewEncoder(&buf)
 		encoder.SetIndent("", "  ")
-		return encoder.Encode(c)
+		err := encoder.Encode(c)
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
 	}
-	return EncodeYaml(file, &c)
+	err := EncodeYaml(&buf, &c)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Diff returns a unified diff of the changes WriteFile would make to the root config file.
+func (c *Config) Diff(outputJSON bool) (string, error) {
+	root, _ := c.splitFiles()
+	content, err := root.encodeFile(outputJSON)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(c.raw),
+		B:        diffLines(content),
+		FromFile: c.Filename,
+		ToFile:   c.Filename,
+		Context:  3,
+	})
+}
+
+// diffLines splits content into lines that keep their line endings.
+func diffLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
 }
 
 // NewConfig loads a config from a URL
 func NewConfig(ctx context.Context, cfgSrc string, noDefaultDirs bool) (*Config, error) {
-	cfgURL, err := url.Parse(cfgSrc)
-	if err == nil {
-		if cfgURL.Scheme == "http" || cfgURL.Scheme == "https" {
-			return configFromHTTP(ctx, cfgSrc)
-		}
-	}
-	data, err := os.ReadFile(cfgSrc)
+	cfg, err := configFromSource(ctx, cfgSrc)
 	if err != nil {
 		return nil, err
 	}
-	cfg, err := ConfigFromYAML(ctx, data)
+	err = cfg.loadImports(ctx, cfgSrc)
 	if err != nil {
 		return nil, err
 	}
+	if isHTTPURL(cfgSrc) {
+		return cfg, nil
+	}
 	cfg.Filename = cfgSrc
+	err = cfg.loadLockfile(ctx)
+	if err != nil {
+		return nil, err
+	}
 	if noDefaultDirs {
 		return cfg, nil
 	}
 	if cfg.Cache == "" {
-		cfg.Cache, err = findCacheDir(filepath.Dir(cfgSrc))
+		cfg.Cache, err = defaultCacheDir(cfg.Version, filepath.Dir(cfgSrc))
 		if err != nil {
 			return nil, err
 		}
@@ -801,6 +1215,14 @@ func NewConfig(ctx context.Context, cfgSrc string, noDefaultDirs bool) (*Config,
 	return cfg, nil
 }
 
+// defaultCacheDir returns the cache directory to use for a config that doesn't specify one.
+func defaultCacheDir(version int, cfgDir string) (string, error) {
+	if version >= 1 {
+		return filepath.Join(cfgDir, ".bindown"), nil
+	}
+	return findCacheDir(cfgDir)
+}
+
 // findCacheDir decides between .bindown and .cache for the cache directory to use when
 // none is specified. This is necessary because v4 mistakenly made .cache the default.
 // We want to use .bindown, but will revert to .cache if it is in .gitignore and .bindown
@@ -836,15 +1258,32 @@ func findCacheDir(cfgDir string) (string, error) {
 	return bindownDir, nil
 }
 
-func configFromHTTP(ctx context.Context, src string) (*Config, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", src, http.NoBody)
+// configFromSource loads a config from a URL or file without resolving imports or default directories.
+func configFromSource(ctx context.Context, cfgSrc string) (*Config, error) {
+	if isHTTPURL(cfgSrc) {
+		return configFromHTTP(ctx, cfgSrc)
+	}
+	data, err := os.ReadFile(cfgSrc)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := configFromYAML(ctx, cfgSrc, data)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := http.DefaultClient.Do(req)
+	cfg.raw = data
+	return cfg, nil
+}
+
+func configFromHTTP(ctx context.Context, src string) (*Config, error) {
+	resp, err := httpclient.FromContext(ctx).Get(ctx, src)
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		//nolint:errcheck // ignore error
+		_ = resp.Body.Close()
+	}()
 	if resp.StatusCode >= 300 {
 		return nil, fmt.Errorf("error downloading %q", src)
 	}
@@ -852,18 +1291,50 @@ func configFromHTTP(ctx context.Context, src string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	return ConfigFromYAML(ctx, data)
+	cfg, err := configFromYAML(ctx, src, data)
+	if err != nil {
+		return nil, err
+	}
+	cfg.raw = data
+	return cfg, nil
 }
 
+// ConfigFromYAML loads a config from yaml or json content. Problems with the content are reported as *ConfigError
+// values with the line and column of the problem.
 func ConfigFromYAML(ctx context.Context, data []byte) (*Config, error) {
-	err := validateConfig(ctx, data)
+	return configFromYAML(ctx, "", data)
+}
+
+// configFromYAML is ConfigFromYAML for content from filename. Content is decoded as TOML when filename has a .toml
+// extension. Otherwise filename is only used in errors.
+func configFromYAML(ctx context.Context, filename string, data []byte) (*Config, error) {
+	if isTOMLFile(filename) {
+		var err error
+		data, err = tomlToJSON(filename, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := checkConfigVersion(filename, data)
+	if err != nil {
+		return nil, err
+	}
+	err = validateConfig(ctx, filename, data)
 	if err != nil {
 		return nil, err
 	}
 	var cfg Config
 	err = yaml.Unmarshal(data, &cfg)
 	if err != nil {
-		return nil, err
+		return nil, &ConfigError{File: filename, Line: yamlErrorLine(err), Err: err}
+	}
+	for i := range cfg.URLRewrites {
+		err = cfg.URLRewrites[i].compile()
+		if err != nil {
+			ptr := jsonPointer("url_rewrites", strconv.Itoa(i))
+			line, col := configPosition(filename, data, ptr)
+			return nil, &ConfigError{File: filename, Line: line, Column: col, Path: ptr, Err: err}
+		}
 	}
 	cfg.Cache = filepath.FromSlash(cfg.Cache)
 	cfg.InstallDir = filepath.FromSlash(cfg.InstallDir)
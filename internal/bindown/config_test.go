@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"github.com/willabides/bindown/v4/internal/httpclient"
 	"github.com/willabides/bindown/v4/internal/testutil"
 )
 
@@ -170,6 +171,34 @@ func TestConfig_addTemplateFromSource(t *testing.T) {
 			require.EqualError(t, err, `source has no template named "fake"`)
 		})
 
+		t.Run("public_key_file", func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "sources", "src.yaml")
+			writeTestFile(t, src, `
+templates:
+  signed:
+    url: https://example.com/foo.tar.gz
+    signature:
+      url: https://example.com/foo.tar.gz.sig
+      type: cosign
+      public_key_file: keys/cosign.pub
+    overrides:
+      - matcher:
+          os: [windows]
+        dependency:
+          signature:
+            url: https://example.com/foo.zip.sig
+            type: cosign
+            public_key_file: keys/windows.pub
+`)
+			cfg := &Config{Filename: filepath.Join(dir, "bindown.yaml")}
+			_, err := cfg.addTemplateFromSource(ctx, src, "signed", "signed")
+			require.NoError(t, err)
+			tmpl := cfg.Templates["signed"]
+			require.Equal(t, "sources/keys/cosign.pub", tmpl.Signature.PublicKeyFile)
+			require.Equal(t, "sources/keys/windows.pub", tmpl.Overrides[0].Dependency.Signature.PublicKeyFile)
+		})
+
 		t.Run("missing file", func(t *testing.T) {
 			cfg := &Config{}
 			src := filepath.Join("testdata", "configs", "thisdoesnotexist.yaml")
@@ -194,6 +223,7 @@ func TestConfig_addTemplateFromSource(t *testing.T) {
 }
 
 func TestConfig_InstallDependencies(t *testing.T) {
+	ctx := context.Background()
 	t.Run("raw file", func(t *testing.T) {
 		dir := t.TempDir()
 		servePath := filepath.Join("testdata", "downloadables", "rawfile", "foo")
@@ -215,7 +245,7 @@ dependencies:
 		wantBin := filepath.Join(binDir, "foo")
 		wantStdout := fmt.Sprintf("installed foo to %s\n", wantBin)
 		var stdout bytes.Buffer
-		err := config.InstallDependencies([]string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{
+		err := config.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{
 			Stdout: &stdout,
 		})
 		require.NoError(t, err)
@@ -223,6 +253,82 @@ dependencies:
 		testutil.AssertFile(t, wantBin, true, false)
 	})
 
+	t.Run("sha512 checksum", func(t *testing.T) {
+		dir := t.TempDir()
+		servePath := filepath.Join("testdata", "downloadables", "rawfile", "foo")
+		ts := testutil.ServeFile(t, servePath, "/foo/foo", "")
+		depURL := ts.URL + "/foo/foo"
+		binDir := filepath.Join(dir, "bin")
+		require.NoError(t, os.MkdirAll(binDir, 0o755))
+		cacheDir := filepath.Join(dir, ".bindown")
+		config := mustConfigFromYAML(t, fmt.Sprintf(`
+install_dir: %q
+cache: %q
+url_checksums:
+  "%s": sha512:1c8af2afcf80f6f17dd90a4e4bbc73026f652916ed0448e6430dcff51768bc2317f42108a76ca68f2290ea3a20cf2ba93c267369d74828fbbe081e26975f10ec
+dependencies:
+  foo:
+    url: %q
+`, binDir, cacheDir, depURL, depURL))
+		t.Cleanup(func() { require.NoError(t, config.ClearCache()) })
+		err := config.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{})
+		require.NoError(t, err)
+		testutil.AssertFile(t, filepath.Join(binDir, "foo"), true, false)
+	})
+
+	t.Run("seal_cache", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("windows doesn't have write permission bits")
+		}
+		dir := t.TempDir()
+		servePath := filepath.Join("testdata", "downloadables", "foo.tar.gz")
+		ts := testutil.ServeFile(t, servePath, "/foo/foo.tar.gz", "")
+		depURL := ts.URL + "/foo/foo.tar.gz"
+		binDir := filepath.Join(dir, "bin")
+		cacheDir := filepath.Join(dir, ".bindown")
+		config := mustConfigFromYAML(t, fmt.Sprintf(`
+install_dir: %q
+cache: %q
+seal_cache: true
+url_checksums:
+  "%s": %s
+dependencies:
+  foo:
+    url: %q
+    archive_path: bin/foo.txt
+`, binDir, cacheDir, depURL, fooChecksum, depURL))
+		t.Cleanup(func() { require.NoError(t, config.ClearCache()) })
+		isWritable := func(filename string) bool {
+			t.Helper()
+			info, err := os.Stat(filename)
+			require.NoError(t, err)
+			return info.Mode()&0o222 != 0
+		}
+		key := cacheKey(fooChecksum)
+
+		err := config.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", nil)
+		require.NoError(t, err)
+		require.False(t, isWritable(filepath.Join(cacheDir, "downloads", key, "foo.tar.gz")))
+		require.False(t, isWritable(filepath.Join(cacheDir, "extracts", key, "bin", "foo.txt")))
+		require.True(t, isWritable(filepath.Join(binDir, "foo")))
+
+		err = config.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{
+			Force:   true,
+			ToCache: true,
+		})
+		require.NoError(t, err)
+		dep, err := config.BuildDependency("foo", "darwin/amd64")
+		require.NoError(t, err)
+		require.False(t, isWritable(filepath.Join(cacheDir, "bin", config.binCacheKey(dep), "foo")))
+
+		removed, err := config.PruneCache(&ConfigPruneCacheOpts{MaxSize: 1})
+		require.NoError(t, err)
+		require.Len(t, removed, 3)
+		entries, err := config.CacheEntries()
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+
 	t.Run("bin in root", func(t *testing.T) {
 		dir := t.TempDir()
 		servePath := filepath.Join("testdata", "downloadables", "fooinroot.tar.gz")
@@ -244,7 +350,7 @@ dependencies:
 		wantBin := filepath.Join(binDir, "foo")
 		var stdout bytes.Buffer
 		wantStdout := fmt.Sprintf("installed foo to %s\n", wantBin)
-		err := config.InstallDependencies([]string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{
+		err := config.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{
 			Stdout: &stdout,
 		})
 		require.NoError(t, err)
@@ -283,7 +389,7 @@ dependencies:
 		wantBin := filepath.Join(binDir, "baz")
 		var stdout bytes.Buffer
 		wantStdout := fmt.Sprintf("installed foo to %s\n", wantBin)
-		err := config.InstallDependencies([]string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{
+		err := config.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{
 			Stdout: &stdout,
 		})
 		require.NoError(t, err)
@@ -318,13 +424,47 @@ dependencies:
 `, binDir, cacheDir, depURL, depURL))
 		t.Cleanup(func() { require.NoError(t, config.ClearCache()) })
 		wantBin := filepath.Join(binDir, "foo")
-		err := config.InstallDependencies([]string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{})
+		err := config.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{})
 		require.Error(t, err)
 		require.False(t, FileExists(wantBin))
 	})
+
+	t.Run("offline", func(t *testing.T) {
+		dir := t.TempDir()
+		servePath := filepath.Join("testdata", "downloadables", "fooinroot.tar.gz")
+		ts := testutil.ServeFile(t, servePath, "/foo/fooinroot.tar.gz", "")
+		depURL := ts.URL + "/foo/fooinroot.tar.gz"
+		binDir := filepath.Join(dir, "bin")
+		cacheDir := filepath.Join(dir, ".bindown")
+		config := mustConfigFromYAML(t, fmt.Sprintf(`
+install_dir: %q
+cache: %q
+url_checksums:
+  "%s": 27dcce60d1ed72920a84dd4bc01e0bbd013e5a841660e9ee2e964e53fb83c0b3
+dependencies:
+  foo:
+    url: %q
+`, binDir, cacheDir, depURL, depURL))
+		t.Cleanup(func() { require.NoError(t, config.ClearCache()) })
+		client, err := httpclient.New(httpclient.Options{Offline: true})
+		require.NoError(t, err)
+		offlineCtx := httpclient.NewContext(ctx, client)
+
+		err = config.InstallDependencies(offlineCtx, []string{"foo"}, "darwin/amd64", nil)
+		require.ErrorIs(t, err, httpclient.ErrOffline)
+		require.EqualError(t, err, "offline: foo is not cached: "+depURL)
+
+		err = config.DownloadDependencies(ctx, []string{"foo"}, "darwin/amd64", nil)
+		require.NoError(t, err)
+		ts.Close()
+		err = config.InstallDependencies(offlineCtx, []string{"foo"}, "darwin/amd64", nil)
+		require.NoError(t, err)
+		require.True(t, FileExists(filepath.Join(binDir, "foo")))
+	})
 }
 
 func TestConfig_addChecksums(t *testing.T) {
+	ctx := context.Background()
 	ts1 := testutil.ServeFile(t, filepath.Join("testdata", "downloadables", "foo.tar.gz"), "/foo/foo.tar.gz", "")
 	ts2 := testutil.ServeFile(t, filepath.Join("testdata", "downloadables", "foo.tar.gz"), "/foo/foo.tar.gz", "")
 	ts3 := testutil.ServeFile(t, filepath.Join("testdata", "downloadables", "foo.tar.gz"), "/foo/foo.tar.gz", "")
@@ -350,7 +490,7 @@ dependencies:
       - matcher: {os: [darwin]}
         dependency: {url: %q}
 `, dl1, dl2, dl5, dl3, dl4))
-	err := cfg.AddChecksums(nil, []System{"darwin/amd64", "linux/amd64"})
+	err := cfg.AddChecksums(ctx, nil, []System{"darwin/amd64", "linux/amd64"})
 	require.NoError(t, err)
 	require.Len(t, cfg.URLChecksums, 4)
 	require.Equal(t, map[string]string{
@@ -384,6 +524,7 @@ dependencies:
 }
 
 func TestConfig_addChecksum(t *testing.T) {
+	ctx := context.Background()
 	ts1 := testutil.ServeFile(t, filepath.Join("testdata", "downloadables", "foo.tar.gz"), "/testOS2-v1-v2", "")
 	ts2 := testutil.ServeFile(t, filepath.Join("testdata", "downloadables", "foo.tar.gz"), "/testOS-overrideV1-overrideV2", "")
 	dlURL := ts1.URL + "/{{.os}}-{{.var1}}-{{.var2}}"
@@ -400,9 +541,9 @@ dependencies:
     vars: {var1: v1, var2: v2}
 
 `, dlURL, dlURL2))
-	err := cfg.addChecksum("dut", "testOS/testArch")
+	err := cfg.addChecksum(ctx, "dut", "testOS/testArch", "", checksumManifests{})
 	require.NoError(t, err)
-	err = cfg.addChecksum("dut", "testOS2/foo")
+	err = cfg.addChecksum(ctx, "dut", "testOS2/foo", "", checksumManifests{})
 	require.NoError(t, err)
 	require.Equal(t, cfg.URLChecksums, map[string]string{
 		checkedURL:         fooChecksum,
@@ -0,0 +1,165 @@
+package bindown
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigError is an error about a value in a config file.
+type ConfigError struct {
+	// File is the config file or URL the value came from. It is empty when the config wasn't loaded from a file.
+	File string
+	// Line and Column are the 1-based position of the value in File. They are 0 when unknown.
+	Line   int
+	Column int
+	// Path is a JSON pointer to the value.
+	Path string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	var location []string
+	if e.File != "" {
+		location = append(location, e.File)
+	}
+	if e.Line > 0 {
+		location = append(location, strconv.Itoa(e.Line))
+		if e.Column > 0 {
+			location = append(location, strconv.Itoa(e.Column))
+		}
+	}
+	if len(location) == 0 {
+		return e.Err.Error()
+	}
+	return strings.Join(location, ":") + ": " + e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// errorAt returns a ConfigError for the value at ptr.
+func (c *Config) errorAt(ptr string, err error) *ConfigError {
+	file, line, col := c.position(ptr)
+	return &ConfigError{
+		File:   file,
+		Line:   line,
+		Column: col,
+		Path:   ptr,
+		Err:    err,
+	}
+}
+
+// position returns the file and position where the value at ptr was defined. When ptr isn't in the file, the position
+// of its closest ancestor is returned.
+func (c *Config) position(ptr string) (file string, line, col int) {
+	file = sourceFile(c.Sources(), ptr)
+	if file == "" {
+		file = c.Filename
+	}
+	raw := c.raw
+	if file != c.Filename {
+		raw = nil
+		for _, imp := range c.imported {
+			if imp.Filename == file {
+				raw = imp.raw
+			}
+		}
+	}
+	line, col = configPosition(file, raw, ptr)
+	return file, line, col
+}
+
+// sourceFile returns the file that the value at ptr or its closest ancestor came from.
+func sourceFile(sources map[string]string, ptr string) string {
+	for {
+		if src, ok := sources[ptr]; ok {
+			return src
+		}
+		i := strings.LastIndex(ptr, "/")
+		if i <= 0 {
+			return ""
+		}
+		ptr = ptr[:i]
+	}
+}
+
+// yamlPosition returns the line and column of the value at ptr in a yaml or json document. When ptr doesn't exist,
+// the position of its closest ancestor is returned. Returns 0, 0 when data isn't valid yaml.
+func yamlPosition(data []byte, ptr string) (line, col int) {
+	var doc yaml.Node
+	if len(data) == 0 || yaml.Unmarshal(data, &doc) != nil || len(doc.Content) == 0 {
+		return 0, 0
+	}
+	node := doc.Content[0]
+	tokens := strings.Split(ptr, "/")[1:]
+	for _, token := range tokens {
+		token = unescapeJSONPointer(token)
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		child := yamlChild(node, token)
+		if child == nil {
+			break
+		}
+		node = child
+	}
+	return node.Line, node.Column
+}
+
+func yamlChild(node *yaml.Node, token string) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == token {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		i, err := strconv.Atoi(token)
+		if err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
+
+var yamlErrLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// yamlErrorLine returns the line number from a yaml parser error or 0 if it doesn't have one.
+func yamlErrorLine(err error) int {
+	m := yamlErrLine.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(m[1])
+	return line
+}
+
+// describePointer describes the location of a value in a config for error messages. For example
+// "/templates/foo/overrides/1/dependency/url" is described as `template "foo" override 1 url`.
+func describePointer(ptr string) string {
+	tokens := strings.Split(ptr, "/")[1:]
+	var parts []string
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch {
+		case i+1 < len(tokens) && i == 0 && token == sectionDependencies:
+			i++
+			parts = append(parts, fmt.Sprintf("dependency %q", unescapeJSONPointer(tokens[i])))
+		case i+1 < len(tokens) && i == 0 && token == sectionTemplates:
+			i++
+			parts = append(parts, fmt.Sprintf("template %q", unescapeJSONPointer(tokens[i])))
+		case i+2 < len(tokens) && token == "overrides" && tokens[i+2] == "dependency":
+			parts = append(parts, "override "+tokens[i+1])
+			i += 2
+		default:
+			parts = append(parts, unescapeJSONPointer(token))
+		}
+	}
+	return strings.Join(parts, " ")
+}
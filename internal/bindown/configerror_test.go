@@ -0,0 +1,106 @@
+package bindown
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFromYAML_errorPositions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("schema errors", func(t *testing.T) {
+		_, err := ConfigFromYAML(ctx, []byte(`
+dependencies:
+  foo: surprise string
+url_checksums:
+  bar: []
+`))
+		require.EqualError(t, err, `3:8: invalid config: /dependencies/foo: expected object, but got string
+5:8: invalid config: /url_checksums/bar: expected string, but got array`)
+		var cfgErr *ConfigError
+		require.True(t, errors.As(err, &cfgErr))
+		require.Equal(t, "/dependencies/foo", cfgErr.Path)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		_, err := ConfigFromYAML(ctx, []byte(`{
+  "systems": ["linux/amd64"],
+  "dependencies": {"foo": {"url": 12}}
+}`))
+		require.EqualError(t, err, `3:35: invalid config: /dependencies/foo/url: expected string, but got number`)
+	})
+
+	t.Run("invalid yaml", func(t *testing.T) {
+		_, err := ConfigFromYAML(ctx, []byte("systems: [linux/amd64\n"))
+		require.ErrorContains(t, err, "1: config is not valid yaml (or json): yaml: line 1:")
+	})
+
+	t.Run("file", func(t *testing.T) {
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		writeTestFile(t, cfgFile, "systems: [linux/amd64]\ninstall_dir: 1\ncache: [x]\n")
+		_, err := NewConfig(ctx, cfgFile, true)
+		require.EqualError(t, err, cfgFile+":2:14: invalid config: /install_dir: expected string, but got number\n"+
+			cfgFile+":3:8: invalid config: /cache: expected string, but got array")
+	})
+}
+
+func TestConfig_BuildDependency_errorPositions(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "bindown.yml")
+	sharedFile := filepath.Join(dir, "shared.yml")
+	writeTestFile(t, sharedFile, `
+templates:
+  tmpl:
+    url: https://example.com/{{.version}}
+    overrides:
+      - matcher:
+          os: [windows]
+        dependency:
+          url: https://example.com/{{.version}}.exe
+`)
+	writeTestFile(t, cfgFile, `
+imports: [shared.yml]
+dependencies:
+  fromTemplate:
+    template: tmpl
+  bad:
+    url: https://example.com/{{.nope}}
+  missing:
+    template: nope
+  noURL:
+    vars:
+      foo: bar
+`)
+	cfg, err := NewConfig(ctx, cfgFile, true)
+	require.NoError(t, err)
+
+	_, err = cfg.BuildDependency("fromTemplate", "linux/amd64")
+	require.ErrorContains(t, err, sharedFile+`:4:10: dependency "fromTemplate": template "tmpl" url: error applying template: `)
+	var cfgErr *ConfigError
+	require.True(t, errors.As(err, &cfgErr))
+	require.Equal(t, "/templates/tmpl/url", cfgErr.Path)
+
+	_, err = cfg.BuildDependency("fromTemplate", "windows/amd64")
+	require.ErrorContains(t, err, sharedFile+`:9:16: dependency "fromTemplate": template "tmpl" override 0 url: error applying template: `)
+
+	_, err = cfg.BuildDependency("bad", "linux/amd64")
+	require.ErrorContains(t, err, cfgFile+`:7:10: dependency "bad" url: error applying template: `)
+
+	_, err = cfg.BuildDependency("missing", "linux/amd64")
+	require.EqualError(t, err, cfgFile+`:9:15: dependency "missing" template: no template named nope`)
+
+	_, err = cfg.BuildDependency("noURL", "linux/amd64")
+	require.EqualError(t, err, cfgFile+`:11:5: dependency "noURL" has no URL`)
+}
+
+func Test_describePointer(t *testing.T) {
+	require.Equal(t, `template "a/b" override 1 url`, describePointer("/templates/a~1b/overrides/1/dependency/url"))
+	require.Equal(t, `dependency "foo" vars version`, describePointer("/dependencies/foo/vars/version"))
+	require.Equal(t, `url_checksums`, describePointer("/url_checksums"))
+}
@@ -0,0 +1,160 @@
+package bindown
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/rogpeppe/go-internal/lockedfile"
+)
+
+// LockConfigFile acquires an advisory lock for updating the config file at filename. It blocks until no other
+// process holds the lock. Close the returned io.Closer to release it.
+//
+// Hold the lock from loading the config until after WriteFile so concurrent updates are serialized instead of
+// overwriting each other. There is one lock for every config file in a directory. Its file is config.lock in the
+// directory's default cache dir, usually .bindown, so it is shared by every user and container that can write the
+// config without leaving an untracked file next to it. It is left in place after the lock is released.
+func LockConfigFile(filename string) (io.Closer, error) {
+	lockfile, err := configLockfile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = makeLockDir(filepath.Dir(lockfile))
+	if err != nil {
+		return nil, err
+	}
+	return lockedfile.Create(lockfile)
+}
+
+// LockConfigFiles is LockConfigFile for several files. Files in the same directory share a lock. Locks are acquired
+// in the order of their lock files, so processes locking overlapping sets of files can't deadlock. Closing the returned io.Closer releases every lock.
+func LockConfigFiles(filenames ...string) (_ io.Closer, errOut error) {
+	byLockfile := map[string]string{}
+	for _, filename := range filenames {
+		lockfile, err := configLockfile(filename)
+		if err != nil {
+			return nil, err
+		}
+		byLockfile[lockfile] = filename
+	}
+	var locks multiCloser
+	defer func() {
+		if errOut != nil {
+			errOut = errors.Join(errOut, locks.Close())
+		}
+	}()
+	for _, lockfile := range sortedKeys(byLockfile) {
+		lock, err := LockConfigFile(byLockfile[lockfile])
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+	return locks, nil
+}
+
+// multiCloser closes its closers in reverse order.
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var err error
+	for i := len(m) - 1; i >= 0; i-- {
+		err = errors.Join(err, m[i].Close())
+	}
+	return err
+}
+
+// LocalFiles returns the local files WriteFile may write: the config file, its overlay and lockfile and every local
+// file it imports. The result is sorted.
+func (c *Config) LocalFiles() []string {
+	if c.Filename == "" {
+		return nil
+	}
+	files := []string{c.Filename, OverlayFilename(c.Filename), LockFilename(c.Filename)}
+	for _, imp := range c.imported {
+		if imp.Filename != "" && !isHTTPURL(imp.Filename) && !slices.Contains(files, imp.Filename) {
+			files = append(files, imp.Filename)
+		}
+	}
+	slices.Sort(files)
+	return files
+}
+
+// configLockfile returns the file used by LockConfigFile for filename.
+func configLockfile(filename string) (string, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err == nil {
+		abs = resolved
+	}
+	cacheDir, err := findCacheDir(filepath.Dir(abs))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, configLockName), nil
+}
+
+// configLockName is the name of the config lock file in the cache dir.
+const configLockName = "config.lock"
+
+// makeLockDir creates dir for a config lock. When dir doesn't exist yet, it gets a .gitignore that ignores everything
+// in it, so locking a config doesn't leave untracked files in a repository that doesn't ignore the cache dir.
+func makeLockDir(dir string) error {
+	_, err := os.Stat(dir)
+	if !os.IsNotExist(err) {
+		return err
+	}
+	err = os.MkdirAll(dir, 0o777)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*\n"), 0o666)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to filename by writing a temp file in the same directory and renaming it over filename,
+// so readers never see a partially written file. When filename is a symlink, the file it points to is replaced. The
+// existing file's permissions are kept.
+func writeFileAtomic(filename string, data []byte) (errOut error) {
+	resolved, err := filepath.EvalSymlinks(filename)
+	if err == nil {
+		filename = resolved
+	}
+	perm := fs.FileMode(0o644)
+	info, err := os.Stat(filename)
+	if err == nil {
+		perm = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if errOut != nil {
+			errOut = errors.Join(errOut, os.Remove(tmp.Name()))
+		}
+	}()
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	err = errors.Join(err, tmp.Close())
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), perm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
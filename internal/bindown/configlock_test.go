@@ -0,0 +1,189 @@
+package bindown
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockConfigFile(t *testing.T) {
+	cfgFile := filepath.Join(t.TempDir(), "bindown.yml")
+	lock, err := LockConfigFile(cfgFile)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(filepath.Dir(cfgFile), ".bindown", "config.lock"))
+
+	acquired := make(chan struct{})
+	go func() {
+		lock2, err2 := LockConfigFile(cfgFile)
+		if err2 == nil {
+			err2 = lock2.Close()
+		}
+		assert.NoError(t, err2)
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired while held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.NoError(t, lock.Close())
+	select {
+	case <-acquired:
+	case <-time.After(10 * time.Second):
+		t.Fatal("lock not acquired after release")
+	}
+}
+
+func TestLockConfigFile_sameDirectory(t *testing.T) {
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, ".bindown.yaml")
+	lock, err := LockConfigFiles(cfgFile, OverlayFilename(cfgFile), LockFilename(cfgFile))
+	require.NoError(t, err)
+	require.NoError(t, lock.Close())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, ".bindown", entries[0].Name())
+	require.FileExists(t, filepath.Join(dir, ".bindown", "config.lock"))
+	requireFileContent(t, filepath.Join(dir, ".bindown", ".gitignore"), "*\n")
+}
+
+func TestLockConfigFile_ignoredCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".git"), 0o750))
+	writeTestFile(t, filepath.Join(dir, ".gitignore"), ".cache\n")
+	lock, err := LockConfigFile(filepath.Join(dir, "bindown.yml"))
+	require.NoError(t, err)
+	require.NoError(t, lock.Close())
+	require.FileExists(t, filepath.Join(dir, ".cache", "config.lock"))
+	require.NoDirExists(t, filepath.Join(dir, ".bindown"))
+}
+
+func TestLockConfigFile_clearCache(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "bindown.yml")
+	writeTestFile(t, cfgFile, `systems: [linux/amd64]`)
+	cfg, err := NewConfig(ctx, cfgFile, false)
+	require.NoError(t, err)
+	lock, err := LockConfigFile(cfgFile)
+	require.NoError(t, err)
+	writeTestFile(t, filepath.Join(dir, ".bindown", "downloads", "foo", "foo.tar.gz"), "foo")
+
+	require.NoError(t, cfg.ClearCache())
+	require.NoDirExists(t, filepath.Join(dir, ".bindown", "downloads"))
+	require.FileExists(t, filepath.Join(dir, ".bindown", "config.lock"))
+	requireFileContent(t, filepath.Join(dir, ".bindown", ".gitignore"), "*\n")
+
+	acquired := make(chan struct{})
+	go func() {
+		lock2, err2 := LockConfigFile(cfgFile)
+		if err2 == nil {
+			err2 = lock2.Close()
+		}
+		assert.NoError(t, err2)
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired while held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.NoError(t, lock.Close())
+	<-acquired
+}
+
+func TestLockConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	team1 := filepath.Join(dir, "team1", "bindown.yml")
+	team2 := filepath.Join(dir, "team2", "bindown.yml")
+	shared := filepath.Join(dir, "shared.yml")
+	lock, err := LockConfigFiles(team1, shared, team1)
+	require.NoError(t, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		lock2, err2 := LockConfigFiles(shared, team2)
+		if err2 == nil {
+			err2 = lock2.Close()
+		}
+		assert.NoError(t, err2)
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired while held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.NoError(t, lock.Close())
+	select {
+	case <-acquired:
+	case <-time.After(10 * time.Second):
+		t.Fatal("lock not acquired after release")
+	}
+}
+
+func TestConfig_LocalFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "team", "bindown.yml")
+	sharedFile := filepath.Join(dir, "shared.yml")
+	writeTestFile(t, cfgFile, `imports: [../shared.yml]`)
+	writeTestFile(t, sharedFile, `systems: [linux/amd64]`)
+	cfg, err := NewConfig(ctx, cfgFile, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		sharedFile,
+		filepath.Join(dir, "team", "bindown.local.yml"),
+		filepath.Join(dir, "team", "bindown.lock"),
+		cfgFile,
+	}, cfg.LocalFiles())
+}
+
+func Test_writeFileAtomic(t *testing.T) {
+	t.Run("new file", func(t *testing.T) {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "bindown.yml")
+		require.NoError(t, writeFileAtomic(filename, []byte("foo\n")))
+		requireFileContent(t, filename, "foo\n")
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	})
+
+	t.Run("keeps permissions", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("windows doesn't have unix permissions")
+		}
+		filename := filepath.Join(t.TempDir(), "bindown.yml")
+		writeTestFile(t, filename, "old\n")
+		require.NoError(t, os.Chmod(filename, 0o600))
+		require.NoError(t, writeFileAtomic(filename, []byte("new\n")))
+		requireFileContent(t, filename, "new\n")
+		info, err := os.Stat(filename)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("symlink", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "real.yml")
+		link := filepath.Join(dir, "bindown.yml")
+		writeTestFile(t, target, "old\n")
+		err := os.Symlink(target, link)
+		if err != nil {
+			t.Skip("symlinks not supported")
+		}
+		require.NoError(t, writeFileAtomic(link, []byte("new\n")))
+		requireFileContent(t, target, "new\n")
+		info, err := os.Lstat(link)
+		require.NoError(t, err)
+		require.NotZero(t, info.Mode()&os.ModeSymlink)
+	})
+}
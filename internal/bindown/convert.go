@@ -0,0 +1,87 @@
+package bindown
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Convert moves c's config file to filename, writing it in the format for filename's extension. The local overlay is
+// converted too. Imported files and the lockfile are left as they are. The old files are only removed after both new
+// files are written, so a failed conversion leaves the original config and c as they were.
+func (c *Config) Convert(filename string) error {
+	if c.Filename == "" {
+		return fmt.Errorf("no filename specified")
+	}
+	oldFilename := c.Filename
+	if filename == oldFilename {
+		return fmt.Errorf("config is already %s", filename)
+	}
+	_, err := os.Stat(filename)
+	if err == nil {
+		return fmt.Errorf("%s already exists", filename)
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	oldFiles := []string{oldFilename}
+	oldOverlay := c.overlay
+	if oldOverlay != nil {
+		oldFiles = append(oldFiles, oldOverlay.Filename)
+		err = c.convertOverlay(OverlayFilename(filename))
+		if err != nil {
+			return err
+		}
+	}
+	oldRaw := c.raw
+	c.Filename = filename
+	c.raw = nil
+	err = c.WriteFile(false)
+	if err != nil {
+		c.Filename = oldFilename
+		c.raw = oldRaw
+		if oldOverlay != nil {
+			newOverlay := c.overlay.Filename
+			c.setOverlay(oldOverlay)
+			err = errors.Join(err, os.Remove(newOverlay))
+		}
+		return err
+	}
+	for _, f := range oldFiles {
+		err = errors.Join(err, os.Remove(f))
+	}
+	return err
+}
+
+// convertOverlay writes c's overlay to filename and uses it as the overlay. The old overlay file is left in place.
+func (c *Config) convertOverlay(filename string) error {
+	_, err := os.Stat(filename)
+	if err == nil {
+		return fmt.Errorf("%s already exists", filename)
+	}
+	overlay := *c.overlay
+	overlay.Filename = filename
+	overlay.raw = nil
+	err = overlay.writeFile(false)
+	if err != nil {
+		return err
+	}
+	c.setOverlay(&overlay)
+	return nil
+}
+
+// setOverlay replaces c's overlay with overlay, including where c records which file its values came from.
+func (c *Config) setOverlay(overlay *Config) {
+	oldFilename := c.overlay.Filename
+	for i, imp := range c.imported {
+		if imp.Filename == oldFilename {
+			c.imported[i] = overlay
+		}
+	}
+	c.overlay = overlay
+	for key, owner := range c.owners {
+		if owner == oldFilename {
+			c.owners[key] = overlay.Filename
+		}
+	}
+}
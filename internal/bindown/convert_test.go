@@ -0,0 +1,97 @@
+package bindown
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/bindown/v4/internal/testutil"
+)
+
+func TestConfig_Convert(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "bindown.yml")
+	writeTestFile(t, cfgFile, `
+systems: [linux/amd64]
+dependencies:
+  foo:
+    url: https://example.com/foo
+`)
+	writeTestFile(t, OverlayFilename(cfgFile), `
+dependencies:
+  bar:
+    url: https://example.com/bar
+`)
+	cfg, err := NewConfig(ctx, cfgFile, true)
+	require.NoError(t, err)
+	require.NoError(t, cfg.LoadOverlay(ctx, OverlayFilename(cfgFile)))
+
+	jsonOverlay := filepath.Join(dir, "bindown.local.json")
+	writeTestFile(t, jsonOverlay, "{}")
+	err = cfg.Convert(filepath.Join(dir, "bindown.json"))
+	require.EqualError(t, err, jsonOverlay+" already exists")
+	require.FileExists(t, cfgFile)
+	require.FileExists(t, OverlayFilename(cfgFile))
+	require.NoFileExists(t, filepath.Join(dir, "bindown.json"))
+
+	tomlFile := filepath.Join(dir, "bindown.toml")
+	require.NoError(t, cfg.Convert(tomlFile))
+	require.NoFileExists(t, cfgFile)
+	require.NoFileExists(t, OverlayFilename(cfgFile))
+	requireFileContent(t, tomlFile, `systems = ['linux/amd64']
+
+[dependencies]
+[dependencies.foo]
+url = 'https://example.com/foo'
+`)
+	requireFileContent(t, filepath.Join(dir, "bindown.local.toml"), `[dependencies]
+[dependencies.bar]
+url = 'https://example.com/bar'
+`)
+
+	err = cfg.Convert(tomlFile)
+	require.EqualError(t, err, "config is already "+tomlFile)
+
+	writeTestFile(t, cfgFile, "{}")
+	err = cfg.Convert(cfgFile)
+	require.EqualError(t, err, cfgFile+" already exists")
+}
+
+func TestConfig_Convert_failedWrite(t *testing.T) {
+	ctx := context.Background()
+	ts := testutil.ServeFile(t, filepath.Join("testdata", "configs", "ex1.yaml"), "/ex1.yaml", "")
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "bindown.yml")
+	overlayFile := OverlayFilename(cfgFile)
+	writeTestFile(t, cfgFile, "imports: ["+ts.URL+"/ex1.yaml]\n")
+	writeTestFile(t, overlayFile, `
+dependencies:
+  bar:
+    url: https://example.com/bar
+`)
+	cfg, err := NewConfig(ctx, cfgFile, true)
+	require.NoError(t, err)
+	require.NoError(t, cfg.LoadOverlay(ctx, overlayFile))
+	require.NoError(t, cfg.SetDependencyVars("goreleaser", map[string]string{"version": "1.0.0"}))
+
+	err = cfg.Convert(filepath.Join(dir, "bindown.toml"))
+	require.EqualError(t, err, "cannot write changes to imported config "+ts.URL+"/ex1.yaml")
+	require.NoFileExists(t, filepath.Join(dir, "bindown.toml"))
+	require.NoFileExists(t, filepath.Join(dir, "bindown.local.toml"))
+	require.Equal(t, cfgFile, cfg.Filename)
+	require.Equal(t, overlayFile, cfg.overlay.Filename)
+	require.Equal(t, overlayFile, cfg.Sources()["/dependencies/bar"])
+
+	require.NoError(t, cfg.SetDependencyVars("bar", map[string]string{"version": "1.0.0"}))
+	require.NoError(t, cfg.SetDependencyVars("goreleaser", map[string]string{"version": "0.120.7"}))
+	require.NoError(t, cfg.WriteFile(false))
+	requireFileContent(t, overlayFile, `
+dependencies:
+  bar:
+    url: https://example.com/bar
+    vars:
+      version: 1.0.0
+`)
+}
@@ -9,6 +9,7 @@ import (
 	"slices"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/willabides/bindown/v4/internal/cache"
 )
 
 type DependencyOverride struct {
@@ -34,7 +35,22 @@ type Overrideable struct {
 	// Whether to create a symlink to the bin instead of copying it.
 	Link *bool `json:"link,omitempty" yaml:",omitempty"`
 
-	// A list of variables that can be used in 'url', 'archive_path' and 'bin'.
+	// The url of a checksums file that lists the checksum of the file at url. When it is set, adding checksums reads
+	// them from this file instead of downloading url. The file can be a list of checksums like goreleaser's
+	// checksums.txt or SHA256SUMS or a file containing only the checksum of url like foo.tar.gz.sha256. It is a go
+	// template like url.
+	ChecksumsURL *string `json:"checksums_url,omitempty" yaml:"checksums_url,omitempty"`
+
+	// The algorithm of the checksums in the file at checksums_url. Default is the algorithm in the file's name like
+	// SHA256SUMS, checksums.sha512 or foo.tar.gz.b3. When neither says, checksums are sha256 or sha512 by their
+	// length.
+	ChecksumsAlgorithm *string `json:"checksums_algorithm,omitempty" yaml:"checksums_algorithm,omitempty" jsonschema:"enum=sha256,enum=sha512,enum=blake3"`
+
+	// A detached signature to verify the downloaded file or its checksums file with before it is cached. An override's
+	// signature replaces the whole signature.
+	Signature *Signature `json:"signature,omitempty" yaml:",omitempty"`
+
+	// A list of variables that can be used in 'url', 'archive_path', 'bin' and 'checksums_url'.
 	//
 	// Two variables are always added based on the current environment: 'os' and 'arch'. Those are the operating
 	// system and architecture as defined by go's GOOS and GOARCH variables. I should document what those are
@@ -68,13 +84,16 @@ func (d *Overrideable) clone() *Overrideable {
 		}
 	}
 	return &Overrideable{
-		URL:           clonePointer(d.URL),
-		ArchivePath:   clonePointer(d.ArchivePath),
-		BinName:       clonePointer(d.BinName),
-		Link:          clonePointer(d.Link),
-		Vars:          maps.Clone(d.Vars),
-		Overrides:     overrides,
-		Substitutions: cloneSubstitutions(d.Substitutions),
+		URL:                clonePointer(d.URL),
+		ArchivePath:        clonePointer(d.ArchivePath),
+		BinName:            clonePointer(d.BinName),
+		Link:               clonePointer(d.Link),
+		ChecksumsURL:       clonePointer(d.ChecksumsURL),
+		ChecksumsAlgorithm: clonePointer(d.ChecksumsAlgorithm),
+		Signature:          clonePointer(d.Signature),
+		Vars:               maps.Clone(d.Vars),
+		Overrides:          overrides,
+		Substitutions:      cloneSubstitutions(d.Substitutions),
 	}
 }
 
@@ -104,6 +123,11 @@ type Dependency struct {
 	checksum string
 	url      string
 	system   System
+	// mirrors are urls to try before url
+	mirrors []string
+	// signatureMirrors and checksumsMirrors are urls to try before Signature.URL and ChecksumsURL
+	signatureMirrors []string
+	checksumsMirrors []string
 }
 
 func cloneSubstitutions(subs map[string]map[string]string) map[string]map[string]string {
@@ -148,17 +172,50 @@ func (d *Dependency) binName() string {
 	return d.name
 }
 
+// templateFieldError is an error executing the go template in a dependency field.
+type templateFieldError struct {
+	field string
+	// value is the field's template before interpolation
+	value string
+	err   error
+}
+
+func (e *templateFieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.field, e.err)
+}
+
+func (e *templateFieldError) Unwrap() error {
+	return e.err
+}
+
+// templateFields returns the fields of o that are go templates, keyed by their config names. Nested fields are keyed
+// by their JSON pointer relative to o like "signature/url".
+func templateFields(o *Overrideable) map[string]*string {
+	fields := map[string]*string{
+		"url":           o.URL,
+		"archive_path":  o.ArchivePath,
+		"bin":           o.BinName,
+		"checksums_url": o.ChecksumsURL,
+	}
+	if o.Signature != nil {
+		fields["signature/url"] = &o.Signature.URL
+	}
+	return fields
+}
+
 // interpolateVars executes go templates in values
 func (d *Dependency) interpolateVars(system System) error {
-	for _, p := range []*string{d.URL, d.ArchivePath, d.BinName} {
+	fields := templateFields(&d.Overrideable)
+	for _, field := range sortedKeys(fields) {
+		p := fields[field]
 		if p == nil {
 			continue
 		}
-		var err error
-		*p, err = executeTemplate(*p, system.OS(), system.Arch(), d.Vars)
+		value, err := executeTemplate(*p, system.OS(), system.Arch(), d.Vars)
 		if err != nil {
-			return err
+			return &templateFieldError{field: field, value: *p, err: err}
 		}
+		*p = value
 	}
 	return nil
 }
@@ -197,6 +254,9 @@ func (d *Dependency) applyTemplate(templates map[string]*Dependency, depth int)
 	newDL.BinName = overrideValue(newDL.BinName, d.BinName)
 	newDL.URL = overrideValue(newDL.URL, d.URL)
 	newDL.Link = overrideValue(newDL.Link, d.Link)
+	newDL.ChecksumsURL = overrideValue(newDL.ChecksumsURL, d.ChecksumsURL)
+	newDL.ChecksumsAlgorithm = overrideValue(newDL.ChecksumsAlgorithm, d.ChecksumsAlgorithm)
+	newDL.Signature = overrideValue(newDL.Signature, d.Signature)
 	if d.RequiredVars != nil {
 		newDL.RequiredVars = append(newDL.RequiredVars, d.RequiredVars...)
 	}
@@ -215,12 +275,23 @@ func (d *Dependency) mustBeBuilt() {
 	}
 }
 
-func (d *Dependency) cacheKey() string {
+// cacheMetadata returns the metadata to record for cache entries created for d.
+func (d *Dependency) cacheMetadata() cache.Metadata {
+	return cache.Metadata{
+		Dependency: d.name,
+		System:     string(d.system),
+		URL:        d.url,
+		Checksum:   d.checksum,
+	}
+}
+
+// cacheKeyMaterial returns what the bin cache key of a built dependency is a hash of.
+func (d *Dependency) cacheKeyMaterial() string {
 	b, err := json.Marshal(d)
 	if err != nil {
 		panic(err)
 	}
-	return cacheKey(string(b) + d.name + d.checksum + d.url + string(d.system))
+	return string(b) + d.name + d.checksum + d.url + string(d.system)
 }
 
 const maxOverrideDepth = 10
@@ -285,6 +356,9 @@ func (d *Overrideable) applyOverrides(system System, depth int) error {
 		d.ArchivePath = overrideValue(d.ArchivePath, dependency.ArchivePath)
 		d.BinName = overrideValue(d.BinName, dependency.BinName)
 		d.URL = overrideValue(d.URL, dependency.URL)
+		d.ChecksumsURL = overrideValue(d.ChecksumsURL, dependency.ChecksumsURL)
+		d.ChecksumsAlgorithm = overrideValue(d.ChecksumsAlgorithm, dependency.ChecksumsAlgorithm)
+		d.Signature = overrideValue(d.Signature, dependency.Signature)
 		maps.Copy(d.Vars, dependency.Vars)
 	}
 	d.Overrides = nil
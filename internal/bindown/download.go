@@ -1,23 +1,22 @@
 package bindown
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
 
-	"github.com/willabides/bindown/v4/internal/cache"
+	"github.com/willabides/bindown/v4/internal/httpclient"
 )
 
-func downloadDependency(
+func (c *Config) downloadDependency(
+	ctx context.Context,
 	dep *Dependency,
-	dlCache *cache.Cache,
 	allowMissingChecksum, force bool,
 ) (cachedFile, key string, unlock func() error, errOut error) {
 	dep.mustBeBuilt()
+	dlCache := c.downloadsCache()
 	dlFile, err := urlFilename(dep.url)
 	if err != nil {
 		return "", "", nil, err
@@ -30,6 +29,9 @@ func downloadDependency(
 			err = fmt.Errorf("no checksum configured for %s %s", dep.name, dep.url)
 			return "", "", nil, err
 		}
+		if httpclient.FromContext(ctx).Offline() {
+			return "", "", nil, errNotCached(dep)
+		}
 		var tempDir string
 		tempDir, err = os.MkdirTemp("", "bindown")
 		if err != nil {
@@ -39,100 +41,148 @@ func downloadDependency(
 			return os.RemoveAll(tempDir)
 		})
 		tempFile := filepath.Join(tempDir, dlFile)
-		checksum, err = getURLChecksum(dep.url, tempFile)
+		// without a checksum to verify a mirror's file, only the original url is trusted
+		var sums *multiHasher
+		sums, err = getURLChecksums(ctx, dep.url, tempFile, DefaultChecksumAlgorithm)
 		if err != nil {
 			return "", "", nil, err
 		}
+		checksum = sums.checksum(DefaultChecksumAlgorithm)
 		downloader = func(dir string) (dlErrOut error) {
 			return copyFile(tempFile, filepath.Join(dir, dlFile))
 		}
-	} else {
+	}
+	algorithm, digest, err := parseChecksum(checksum)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("invalid checksum for %s %s: %w", dep.name, dep.url, err)
+	}
+	checksum = formatChecksum(algorithm, digest)
+	key = c.downloadCacheKey(algorithm, digest, dlFile)
+	partialFile := filepath.Join(partialDownloadsDir(dlCache), key, dlFile)
+	if downloader == nil {
 		downloader = func(dir string) error {
 			ok, dlErr := fileExistsWithChecksum(filepath.Join(dir, dlFile), checksum)
 			if dlErr != nil || ok {
 				return dlErr
 			}
-			gotSum, dlErr := downloadFile(filepath.Join(dir, dlFile), dep.url)
-			if dlErr != nil {
-				return dlErr
+			if httpclient.FromContext(ctx).Offline() {
+				return errNotCached(dep)
 			}
-			if checksum != gotSum {
-				return fmt.Errorf(`checksum mismatch in downloaded file %q 
+			return tryMirrors(dep.url, dep.mirrors, func(u string) error {
+				sums, dlErr := resumeDownload(ctx, partialFile, filepath.Join(dir, dlFile), u, algorithm)
+				if dlErr != nil {
+					return dlErr
+				}
+				gotSum := sums.checksum(algorithm)
+				if checksum != gotSum {
+					return fmt.Errorf(`checksum mismatch in downloaded file %q 
 wanted: %s
 got: %s`, dlFile, checksum, gotSum)
-			}
-			return nil
+				}
+				return nil
+			})
 		}
 	}
-	key = cacheKey(checksum)
 	if force {
+		if httpclient.FromContext(ctx).Offline() {
+			return "", "", nil, fmt.Errorf("%w: can't force downloading %s", httpclient.ErrOffline, dep.name)
+		}
 		err = dlCache.Evict(key)
 		if err != nil {
 			return "", "", nil, err
 		}
+		err = removePartialDownload(partialFile)
+		if err != nil {
+			return "", "", nil, err
+		}
 	}
 
-	validator := func(dir string) error {
-		got, sumErr := fileChecksum(filepath.Join(dir, dlFile))
-		if sumErr != nil {
-			return sumErr
-		}
-		if got != checksum {
-			return fmt.Errorf("expected checksum %s, got %s", checksum, got)
+	validate := downloadValidator(dlFile, algorithm, checksum)
+	if dep.Signature != nil {
+		// entries that are already cached are checked too, so a download that failed verification is never used
+		validateChecksum := validate
+		validate = func(dir string) error {
+			err := validateChecksum(dir)
+			if err != nil {
+				return err
+			}
+			return verifyDependencySignature(ctx, dep, filepath.Join(dir, dlFile))
 		}
-		return nil
 	}
 
-	dir, unlock, err := dlCache.Dir(key, validator, downloader)
+	meta := dep.cacheMetadata()
+	meta.Checksum = checksum
+	dir, unlock, err := dlCache.DirWithMetadata(key, &meta, validate, downloader)
 	if err != nil {
 		return "", "", nil, err
 	}
 	return filepath.Join(dir, dlFile), key, unlock, nil
 }
 
-// downloadFile downloads the file at url to targetPath. It returns the checksum of the file.
-func downloadFile(targetPath, url string) (_ string, errOut error) {
-	hasher := sha256.New()
-	err := os.MkdirAll(filepath.Dir(targetPath), 0o750)
+// downloadValidator returns a validator for a downloads cache entry that checks dlFile against checksum.
+func downloadValidator(dlFile, algorithm, checksum string) func(dir string) error {
+	return func(dir string) error {
+		got, err := fileChecksum(filepath.Join(dir, dlFile), algorithm)
+		if err != nil {
+			return err
+		}
+		if got != checksum {
+			return fmt.Errorf("expected checksum %s, got %s", checksum, got)
+		}
+		return nil
+	}
+}
+
+// errNotCached is the error for a dependency that needs to be downloaded in offline mode.
+func errNotCached(dep *Dependency) error {
+	return fmt.Errorf("%w: %s is not cached: %s", httpclient.ErrOffline, dep.name, dep.url)
+}
+
+// downloadFile downloads the file at url to targetPath. It returns the file's checksums for algorithms.
+func downloadFile(ctx context.Context, targetPath, url string, algorithms ...string) (_ *multiHasher, errOut error) {
+	hasher, err := newMultiHasher(algorithms...)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(targetPath), 0o750)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	resp, err := http.Get(url)
+	resp, err := httpclient.FromContext(ctx).Get(ctx, url)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer deferErr(&errOut, resp.Body.Close)
 	bodyReader := io.TeeReader(resp.Body, hasher)
 	if resp.StatusCode >= 300 {
-		return "", fmt.Errorf("failed downloading %s", url)
+		return nil, fmt.Errorf("failed downloading %s", url)
 	}
 	out, err := os.Create(targetPath)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer deferErr(&errOut, out.Close)
 	_, err = io.Copy(out, bodyReader)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	sum := hex.EncodeToString(hasher.Sum(nil))
-	return sum, nil
+	return hasher, nil
 }
 
-// getURLChecksum returns the checksum of the file at dlURL. If tempFile is specified
+// getURLChecksums returns the checksums of the file at dlURL for algorithms. If tempFile is specified
 // it will be used as the temporary file to download the file to and it will be the caller's
 // responsibility to clean it up. Otherwise, a temporary file will be created and cleaned up
 // automatically.
-func getURLChecksum(dlURL, tempFile string) (_ string, errOut error) {
+func getURLChecksums(ctx context.Context, dlURL, tempFile string, algorithms ...string) (_ *multiHasher, errOut error) {
 	if tempFile == "" {
 		downloadDir, err := os.MkdirTemp("", "bindown")
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		tempFile = filepath.Join(downloadDir, "download")
 		defer deferErr(&errOut, func() error {
 			return os.RemoveAll(downloadDir)
 		})
 	}
-	return downloadFile(tempFile, dlURL)
+	return downloadFile(ctx, tempFile, dlURL, algorithms...)
 }
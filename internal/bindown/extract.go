@@ -1,6 +1,7 @@
 package bindown
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,14 +13,14 @@ import (
 func extractDependencyToCache(
 	archivePath, cacheDir, key string,
 	exCache *cache.Cache,
+	meta cache.Metadata,
 	force bool,
 ) (extractDir string, unlock func() error, _ error) {
-	extractSumsDir := filepath.Join(cacheDir, ".extract_sums")
-	err := os.MkdirAll(extractSumsDir, 0o755)
+	extractSumFile := extractSumFile(cacheDir, key)
+	err := os.MkdirAll(filepath.Dir(extractSumFile), 0o755)
 	if err != nil {
 		return "", nil, err
 	}
-	extractSumFile := filepath.Join(extractSumsDir, key+".sum")
 
 	extractor := func(dir string) error {
 		exErr := extract(archivePath, dir)
@@ -39,7 +40,31 @@ func extractDependencyToCache(
 			return "", nil, err
 		}
 	}
-	return exCache.Dir(key, nil, extractor)
+	return exCache.DirWithMetadata(key, &meta, extractValidator(extractSumFile), extractor)
+}
+
+// extractSumFile is where the checksum of the extracted directory for key is recorded.
+func extractSumFile(cacheDir, key string) string {
+	return filepath.Join(cacheDir, ".extract_sums", key+".sum")
+}
+
+// extractValidator returns a validator for an extracted directory that compares it to the checksum recorded in
+// sumFile when it was extracted.
+func extractValidator(sumFile string) func(dir string) error {
+	return func(dir string) error {
+		want, err := os.ReadFile(sumFile)
+		if err != nil {
+			return err
+		}
+		got, err := directoryChecksum(dir)
+		if err != nil {
+			return err
+		}
+		if got != strings.TrimSpace(string(want)) {
+			return fmt.Errorf("extracted files in %s have changed since they were extracted", dir)
+		}
+		return nil
+	}
 }
 
 // extract extracts an archive
@@ -0,0 +1,388 @@
+package bindown
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"slices"
+)
+
+const (
+	sectionDependencies    = "dependencies"
+	sectionTemplates       = "templates"
+	sectionTemplateSources = "template_sources"
+	sectionURLChecksums    = "url_checksums"
+	sectionSystems         = "systems"
+)
+
+// entryKey identifies a named entry in one of a config's sections.
+type entryKey struct {
+	section string
+	name    string
+}
+
+// loadImports loads the files listed in c.Imports, and the files they import, and merges them into c.
+// src is the location c was loaded from. It is used to resolve relative imports.
+//
+// Entries from an importing file take precedence over entries from the files it imports, directly or indirectly. It
+// is an error for two files that don't import each other to define the same entry with different values.
+func (c *Config) loadImports(ctx context.Context, src string) error {
+	if len(c.Imports) == 0 {
+		return nil
+	}
+	graph := &importGraph{
+		configs: map[string]*Config{},
+		imports: map[string][]string{},
+	}
+	err := graph.load(ctx, src, c.Imports, []string{src})
+	if err != nil {
+		return err
+	}
+	for _, impSrc := range graph.mergeOrder(src) {
+		impCfg := graph.configs[impSrc]
+		c.imported = append(c.imported, impCfg)
+		err = c.mergeImported(impCfg, graph)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importGraph holds every file imported by a config and what each of them imports.
+type importGraph struct {
+	// configs are the imported files by location.
+	configs map[string]*Config
+	// imports are the resolved imports of each file, including the root config.
+	imports map[string][]string
+}
+
+func (g *importGraph) load(ctx context.Context, src string, imports, stack []string) error {
+	for _, imp := range imports {
+		impSrc, err := resolveImport(src, imp)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(stack, impSrc) {
+			return fmt.Errorf("import cycle: %s imports %s", src, impSrc)
+		}
+		g.imports[src] = append(g.imports[src], impSrc)
+		if g.configs[impSrc] != nil {
+			continue
+		}
+		impCfg, err := configFromSource(ctx, impSrc)
+		if err != nil {
+			return fmt.Errorf("error importing %s: %w", impSrc, err)
+		}
+		impCfg.Filename = impSrc
+		g.configs[impSrc] = impCfg
+		err = g.load(ctx, impSrc, impCfg.Imports, append(stack, impSrc))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeOrder returns the files imported by root with every file before the files it imports, so an entry is always
+// merged from the file that wins first. Otherwise, files keep the order they are listed in.
+func (g *importGraph) mergeOrder(root string) []string {
+	var order []string
+	visited := map[string]bool{root: true}
+	var visit func(file string)
+	visit = func(file string) {
+		imports := g.imports[file]
+		for i := len(imports) - 1; i >= 0; i-- {
+			if visited[imports[i]] {
+				continue
+			}
+			visited[imports[i]] = true
+			visit(imports[i])
+			order = append(order, imports[i])
+		}
+	}
+	visit(root)
+	slices.Reverse(order)
+	return order
+}
+
+// importsTransitively returns true when from imports to, directly or indirectly.
+func (g *importGraph) importsTransitively(from, to string) bool {
+	seen := map[string]bool{}
+	pending := slices.Clone(g.imports[from])
+	for len(pending) > 0 {
+		file := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if file == to {
+			return true
+		}
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		pending = append(pending, g.imports[file]...)
+	}
+	return false
+}
+
+// mergeImported merges the entries of imp into c. Entries that c already has are kept when they are equal or when
+// they come from a file that imports imp.
+func (c *Config) mergeImported(imp *Config, graph *importGraph) error {
+	if c.owners == nil {
+		c.owners = map[entryKey]string{}
+	}
+	merge := func(section string, name string, exists, equal bool, set func()) error {
+		key := entryKey{section: section, name: name}
+		if !exists {
+			c.owners[key] = imp.Filename
+			set()
+			return nil
+		}
+		owner, ok := c.owners[key]
+		if !ok || graph.importsTransitively(owner, imp.Filename) || equal {
+			return nil
+		}
+		return fmt.Errorf("%s %q is defined differently in %s and %s", section, name, owner, imp.Filename)
+	}
+	for _, name := range sortedKeys(imp.Dependencies) {
+		existing, ok := c.Dependencies[name]
+		err := merge(sectionDependencies, name, ok, ok && reflect.DeepEqual(existing, imp.Dependencies[name]), func() {
+			if c.Dependencies == nil {
+				c.Dependencies = map[string]*Dependency{}
+			}
+			c.Dependencies[name] = imp.Dependencies[name].clone()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(imp.Templates) {
+		existing, ok := c.Templates[name]
+		err := merge(sectionTemplates, name, ok, ok && reflect.DeepEqual(existing, imp.Templates[name]), func() {
+			if c.Templates == nil {
+				c.Templates = map[string]*Dependency{}
+			}
+			c.Templates[name] = imp.Templates[name].clone()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(imp.TemplateSources) {
+		existing, ok := c.TemplateSources[name]
+		err := merge(sectionTemplateSources, name, ok, existing == imp.TemplateSources[name], func() {
+			if c.TemplateSources == nil {
+				c.TemplateSources = map[string]string{}
+			}
+			c.TemplateSources[name] = imp.TemplateSources[name]
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(imp.URLChecksums) {
+		existing, ok := c.URLChecksums[name]
+		err := merge(sectionURLChecksums, name, ok, existing == imp.URLChecksums[name], func() {
+			if c.URLChecksums == nil {
+				c.URLChecksums = map[string]string{}
+			}
+			c.URLChecksums[name] = imp.URLChecksums[name]
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, system := range imp.Systems {
+		if slices.Contains(c.Systems, system) {
+			continue
+		}
+		c.owners[entryKey{section: sectionSystems, name: string(system)}] = imp.Filename
+		c.Systems = append(c.Systems, system)
+	}
+	return nil
+}
+
+// resolveImport returns the location of imp relative to src.
+func resolveImport(src, imp string) (string, error) {
+	if isHTTPURL(imp) {
+		return imp, nil
+	}
+	if isHTTPURL(src) {
+		base, err := url.Parse(src)
+		if err != nil {
+			return "", err
+		}
+		ref, err := url.Parse(filepath.ToSlash(imp))
+		if err != nil {
+			return "", err
+		}
+		return base.ResolveReference(ref).String(), nil
+	}
+	imp = filepath.FromSlash(imp)
+	if filepath.IsAbs(imp) {
+		return imp, nil
+	}
+	return filepath.Join(filepath.Dir(src), imp), nil
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+// owner returns the file an entry was imported from. Returns "" for entries that belong to the root config.
+func (c *Config) owner(section, name string) string {
+	return c.owners[entryKey{section: section, name: name}]
+}
+
+// splitImports separates c into the content of the root config file and the content of each imported file. Entries
+// that weren't loaded from an import, including entries added since loading, belong to the root config.
+func (c *Config) splitImports() (root *Config, imports []*Config) {
+	root = &Config{
+		Version:     c.Version,
+		Cache:       c.Cache,
+		SealCache:   c.SealCache,
+		InstallDir:  c.InstallDir,
+		Imports:     c.Imports,
+		URLRewrites: c.URLRewrites,
+		Hosts:       c.Hosts,
+		Filename:    c.Filename,
+		raw:         c.raw,
+	}
+	for _, system := range c.Systems {
+		if c.owner(sectionSystems, string(system)) == "" {
+			root.Systems = append(root.Systems, system)
+		}
+	}
+	for name, dep := range c.Dependencies {
+		if c.owner(sectionDependencies, name) == "" {
+			root.Dependencies = setMapValue(root.Dependencies, name, dep)
+		}
+	}
+	for name, tmpl := range c.Templates {
+		if c.owner(sectionTemplates, name) == "" {
+			root.Templates = setMapValue(root.Templates, name, tmpl)
+		}
+	}
+	for name, src := range c.TemplateSources {
+		if c.owner(sectionTemplateSources, name) == "" {
+			root.TemplateSources = setMapValue(root.TemplateSources, name, src)
+		}
+	}
+	// without a lockfile, new checksums belong to the root config. with one, only checksums that were already there stay
+	for u, sum := range c.URLChecksums {
+		if c.owner(sectionURLChecksums, u) == "" && (c.lockfile == "" || c.inlineChecksums[u]) {
+			root.URLChecksums = setMapValue(root.URLChecksums, u, sum)
+		}
+	}
+
+	imports = make([]*Config, 0, len(c.imported))
+	for _, orig := range c.imported {
+		imp := &Config{
+			Version:         orig.Version,
+			Cache:           orig.Cache,
+			SealCache:       orig.SealCache,
+			InstallDir:      orig.InstallDir,
+			Imports:         orig.Imports,
+			URLRewrites:     orig.URLRewrites,
+			Hosts:           orig.Hosts,
+			Filename:        orig.Filename,
+			Dependencies:    maps.Clone(orig.Dependencies),
+			Templates:       maps.Clone(orig.Templates),
+			TemplateSources: maps.Clone(orig.TemplateSources),
+			URLChecksums:    maps.Clone(orig.URLChecksums),
+			raw:             orig.raw,
+		}
+		for _, system := range orig.Systems {
+			owner := c.owner(sectionSystems, string(system))
+			if owner == orig.Filename && !slices.Contains(c.Systems, system) {
+				continue
+			}
+			imp.Systems = append(imp.Systems, system)
+		}
+		splitOwned(c, sectionDependencies, orig.Filename, c.Dependencies, &imp.Dependencies)
+		splitOwned(c, sectionTemplates, orig.Filename, c.Templates, &imp.Templates)
+		splitOwned(c, sectionTemplateSources, orig.Filename, c.TemplateSources, &imp.TemplateSources)
+		splitOwned(c, sectionURLChecksums, orig.Filename, c.URLChecksums, &imp.URLChecksums)
+		if orig.Filename == c.lockfile {
+			for u, sum := range c.URLChecksums {
+				if c.owner(sectionURLChecksums, u) == "" && !c.inlineChecksums[u] {
+					imp.URLChecksums = setMapValue(imp.URLChecksums, u, sum)
+				}
+			}
+		}
+		imports = append(imports, imp)
+	}
+	return root, imports
+}
+
+// splitOwned updates dst with the current values of entries in merged that are owned by filename.
+func splitOwned[V any](c *Config, section, filename string, merged map[string]V, dst *map[string]V) {
+	for key, owner := range c.owners {
+		if key.section != section || owner != filename {
+			continue
+		}
+		val, ok := merged[key.name]
+		if !ok {
+			delete(*dst, key.name)
+			continue
+		}
+		*dst = setMapValue(*dst, key.name, val)
+	}
+}
+
+// writeImports writes changes to imported entries back to the files they were imported from.
+func (c *Config) writeImports(imports []*Config) error {
+	for i, imp := range imports {
+		orig := c.imported[i]
+		if imp.Filename == c.lockfile {
+			err := c.writeLockfile(i, orig, imp)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if configEntriesEqual(orig, imp) {
+			continue
+		}
+		if isHTTPURL(imp.Filename) {
+			return fmt.Errorf("cannot write changes to imported config %s", imp.Filename)
+		}
+		err := imp.writeFile(false)
+		if err != nil {
+			return err
+		}
+		c.imported[i] = imp
+	}
+	return nil
+}
+
+// configEntriesEqual returns true if a and b have the same systems, dependencies, templates, template sources and
+// checksums.
+func configEntriesEqual(a, b *Config) bool {
+	return slices.Equal(a.Systems, b.Systems) &&
+		maps.EqualFunc(a.Dependencies, b.Dependencies, func(x, y *Dependency) bool { return reflect.DeepEqual(x, y) }) &&
+		maps.EqualFunc(a.Templates, b.Templates, func(x, y *Dependency) bool { return reflect.DeepEqual(x, y) }) &&
+		maps.Equal(a.TemplateSources, b.TemplateSources) &&
+		maps.Equal(a.URLChecksums, b.URLChecksums)
+}
+
+func setMapValue[V any](m map[string]V, key string, val V) map[string]V {
+	if m == nil {
+		m = map[string]V{}
+	}
+	m[key] = val
+	return m
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := MapKeys(m)
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,193 @@
+package bindown
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/bindown/v4/internal/testutil"
+)
+
+func writeTestFile(t *testing.T, filename, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o750))
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0o600))
+}
+
+func TestConfig_imports(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("merges imports", func(t *testing.T) {
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		writeTestFile(t, cfgFile, `
+imports: [shared/tools.yml]
+systems: [linux/amd64]
+dependencies:
+  foo:
+    url: root-foo
+`)
+		writeTestFile(t, filepath.Join(dir, "shared", "tools.yml"), `
+imports: [more.yml]
+systems: [darwin/arm64, linux/amd64]
+dependencies:
+  foo:
+    url: shared-foo
+  bar:
+    template: bar
+templates:
+  bar:
+    url: bar-url
+template_sources:
+  origin: https://example.com/origin.yml
+url_checksums:
+  bar-url: deadbeef
+`)
+		writeTestFile(t, filepath.Join(dir, "shared", "more.yml"), `
+dependencies:
+  baz:
+    url: baz-url
+`)
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.Equal(t, []System{"linux/amd64", "darwin/arm64"}, cfg.Systems)
+		require.Equal(t, []string{"bar", "baz", "foo"}, cfg.DependencyNames())
+		require.Equal(t, "root-foo", *cfg.Dependencies["foo"].URL)
+		require.Equal(t, "bar-url", *cfg.Templates["bar"].URL)
+		require.Equal(t, map[string]string{"origin": "https://example.com/origin.yml"}, cfg.TemplateSources)
+		require.Equal(t, map[string]string{"bar-url": "deadbeef"}, cfg.URLChecksums)
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		writeTestFile(t, cfgFile, `imports: [a.yml, b.yml]`)
+		writeTestFile(t, filepath.Join(dir, "a.yml"), `
+dependencies:
+  foo:
+    url: a-foo
+`)
+		writeTestFile(t, filepath.Join(dir, "b.yml"), `
+dependencies:
+  foo:
+    url: b-foo
+`)
+		_, err := NewConfig(ctx, cfgFile, true)
+		require.EqualError(t, err, `dependencies "foo" is defined differently in `+
+			filepath.Join(dir, "a.yml")+" and "+filepath.Join(dir, "b.yml"))
+	})
+
+	t.Run("importing file wins regardless of import order", func(t *testing.T) {
+		for _, imports := range []string{"[a.yml, b.yml]", "[b.yml, a.yml]"} {
+			t.Run(imports, func(t *testing.T) {
+				dir := t.TempDir()
+				cfgFile := filepath.Join(dir, "bindown.yml")
+				writeTestFile(t, cfgFile, `imports: `+imports)
+				writeTestFile(t, filepath.Join(dir, "a.yml"), `
+imports: [b.yml]
+dependencies:
+  foo:
+    url: a-foo
+`)
+				writeTestFile(t, filepath.Join(dir, "b.yml"), `
+dependencies:
+  foo:
+    url: b-foo
+  bar:
+    url: b-bar
+`)
+				cfg, err := NewConfig(ctx, cfgFile, true)
+				require.NoError(t, err)
+				require.Equal(t, "a-foo", *cfg.Dependencies["foo"].URL)
+				require.Equal(t, "b-bar", *cfg.Dependencies["bar"].URL)
+				require.Equal(t, filepath.Join(dir, "a.yml"), cfg.owner(sectionDependencies, "foo"))
+			})
+		}
+	})
+
+	t.Run("identical entries do not conflict", func(t *testing.T) {
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		writeTestFile(t, cfgFile, `imports: [a.yml, b.yml]`)
+		writeTestFile(t, filepath.Join(dir, "a.yml"), `url_checksums: {foo: deadbeef}`)
+		writeTestFile(t, filepath.Join(dir, "b.yml"), `url_checksums: {foo: deadbeef}`)
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"foo": "deadbeef"}, cfg.URLChecksums)
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		writeTestFile(t, cfgFile, `imports: [a.yml]`)
+		writeTestFile(t, filepath.Join(dir, "a.yml"), `imports: [bindown.yml]`)
+		_, err := NewConfig(ctx, cfgFile, true)
+		require.ErrorContains(t, err, "import cycle")
+	})
+
+	t.Run("writes entries to their owners", func(t *testing.T) {
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		sharedFile := filepath.Join(dir, "shared.yml")
+		writeTestFile(t, cfgFile, `
+imports: [shared.yml]
+dependencies:
+  foo:
+    url: foo-url
+`)
+		writeTestFile(t, sharedFile, `
+dependencies:
+  bar:
+    url: bar-url
+    vars:
+      version: 1.0.0
+  baz:
+    url: baz-url
+`)
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.NoError(t, cfg.SetDependencyVars("bar", map[string]string{"version": "2.0.0"}))
+		delete(cfg.Dependencies, "baz")
+		cfg.URLChecksums = map[string]string{"foo-url": "deadbeef"}
+		require.NoError(t, cfg.WriteFile(false))
+
+		got, err := os.ReadFile(cfgFile)
+		require.NoError(t, err)
+		require.Equal(t, `
+imports: [shared.yml]
+dependencies:
+  foo:
+    url: foo-url
+url_checksums:
+  foo-url: deadbeef
+`, string(got))
+		got, err = os.ReadFile(sharedFile)
+		require.NoError(t, err)
+		require.Equal(t, `
+dependencies:
+  bar:
+    url: bar-url
+    vars:
+      version: 2.0.0
+`, string(got))
+	})
+
+	t.Run("http import", func(t *testing.T) {
+		ts := testutil.ServeFile(t, filepath.Join("testdata", "configs", "ex1.yaml"), "/ex1.yaml", "")
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		writeTestFile(t, cfgFile, "imports: ["+ts.URL+"/ex1.yaml]\n")
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.Equal(t, "0.120.7", cfg.Dependencies["goreleaser"].Vars["version"])
+
+		// unchanged remote entries are left alone
+		require.NoError(t, cfg.WriteFile(false))
+
+		require.NoError(t, cfg.SetDependencyVars("goreleaser", map[string]string{"version": "1.0.0"}))
+		err = cfg.WriteFile(false)
+		require.EqualError(t, err, "cannot write changes to imported config "+ts.URL+"/ex1.yaml")
+	})
+}
@@ -1,6 +1,7 @@
 package bindown
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"os"
@@ -9,34 +10,31 @@ import (
 	"text/template"
 
 	bootstrapper "github.com/willabides/bindown/v4/internal/build-bootstrapper"
-	"github.com/willabides/bindown/v4/internal/cache"
 )
 
 //go:embed wrapper.gotmpl
 var wrapperTmplText string
 
-func install(
+func (c *Config) install(
+	ctx context.Context,
 	dep *Dependency,
-	targetPath, cacheDir string,
+	targetPath string,
 	force, toCache, missingSums bool,
 ) (_ string, errOut error) {
 	dep.mustBeBuilt()
 	if toCache {
-		instCache := &cache.Cache{Root: filepath.Join(cacheDir, "bin")}
-		key := dep.cacheKey()
-		validateFn := func(dir string) error {
-			filename := filepath.Join(dir, dep.binName())
-			if !FileExists(filename) {
-				return fmt.Errorf("file %q does not exist", filename)
-			}
-			return nil
-		}
+		key := c.binCacheKey(dep)
+		meta := dep.cacheMetadata()
 		popFn := func(dir string) error {
 			filename := filepath.Join(dir, dep.binName())
-			_, err := install(dep, filename, cacheDir, force, false, missingSums)
+			_, err := c.install(ctx, dep, filename, force, false, missingSums)
+			if err != nil {
+				return err
+			}
+			meta.ContentChecksum, err = fileChecksum(filename, DefaultChecksumAlgorithm)
 			return err
 		}
-		dir, unlock, err := instCache.Dir(key, validateFn, popFn)
+		dir, unlock, err := c.binCache().DirWithMetadata(key, &meta, binValidator(dep), popFn)
 		if err != nil {
 			return "", err
 		}
@@ -47,15 +45,13 @@ func install(
 		return filepath.Join(dir, dep.binName()), nil
 	}
 
-	dlCache := cache.Cache{Root: filepath.Join(cacheDir, "downloads")}
-	dlFile, key, dlUnlock, err := downloadDependency(dep, &dlCache, missingSums, force)
+	dlFile, key, dlUnlock, err := c.downloadDependency(ctx, dep, missingSums, force)
 	if err != nil {
 		return "", err
 	}
 	defer deferErr(&errOut, dlUnlock)
 
-	extractsCache := cache.Cache{Root: filepath.Join(cacheDir, "extracts")}
-	extractDir, exUnlock, err := extractDependencyToCache(dlFile, cacheDir, key, &extractsCache, force)
+	extractDir, exUnlock, err := extractDependencyToCache(dlFile, c.cacheDir(), key, c.extractsCache(), dep.cacheMetadata(), force)
 	if err != nil {
 		return "", err
 	}
@@ -94,13 +90,47 @@ func install(
 	if err != nil {
 		return "", err
 	}
-	err = os.Chmod(targetPath, addExec(targetStat.Mode()))
+	// the extracted file may be sealed, but the installed copy is the user's to change
+	err = os.Chmod(targetPath, addExec(targetStat.Mode())|0o200)
 	if err != nil {
 		return "", err
 	}
 	return targetPath, nil
 }
 
+// binValidator returns a validator for a bin cache entry that checks that dep's bin exists.
+func binValidator(dep *Dependency) func(dir string) error {
+	return func(dir string) error {
+		filename := filepath.Join(dir, dep.binName())
+		if !FileExists(filename) {
+			return fmt.Errorf("file %q does not exist", filename)
+		}
+		return nil
+	}
+}
+
+// binChecksumValidator validates a bin cache entry against the checksum recorded when it was populated.
+func binChecksumValidator(dep *Dependency, checksum string) (func(dir string) error, error) {
+	algorithm, err := checksumAlgorithm(checksum)
+	if err != nil {
+		return nil, err
+	}
+	return func(dir string) error {
+		err := binValidator(dep)(dir)
+		if err != nil {
+			return err
+		}
+		got, err := fileChecksum(filepath.Join(dir, dep.binName()), algorithm)
+		if err != nil {
+			return err
+		}
+		if !checksumsEqual(got, checksum) {
+			return fmt.Errorf("expected checksum %s, got %s", checksum, got)
+		}
+		return nil
+	}, nil
+}
+
 type wrapperTmplVars struct {
 	DependencyName string
 	BindownExec    string
@@ -110,7 +140,12 @@ type wrapperTmplVars struct {
 
 var wrapperTmpl = template.Must(template.New("wrapper").Parse(wrapperTmplText))
 
-func createWrapper(name, target, bindownExec, cacheDir, configFile string, missingSums bool) (string, error) {
+// createWrapper writes a wrapper script for name to target. When sharedCache is true, cacheDir is the shared cache and
+// defaultSharedCache is whether it is the default one.
+func createWrapper(
+	name, target, bindownExec, cacheDir, configFile string,
+	sharedCache, defaultSharedCache, missingSums bool,
+) (string, error) {
 	wrapperDir := filepath.Dir(target)
 	err := os.MkdirAll(wrapperDir, 0o750)
 	if err != nil {
@@ -142,15 +177,27 @@ func createWrapper(name, target, bindownExec, cacheDir, configFile string, missi
 	}
 	addFlagArg("--configfile", configFile)
 
-	err = os.MkdirAll(cacheDir, 0o750)
-	if err != nil {
-		return "", err
-	}
-	cacheDir, err = relPath(wrapperDir, cacheDir)
-	if err != nil {
-		return "", err
+	switch {
+	case sharedCache && defaultSharedCache:
+		// the default shared cache's location depends on the user running the wrapper
+		flagArgs += " \\\n    --shared-cache"
+	case sharedCache:
+		cacheDir, err = filepath.Abs(cacheDir)
+		if err != nil {
+			return "", err
+		}
+		addFlagArg("--shared-cache-dir", filepath.ToSlash(cacheDir))
+	default:
+		err = os.MkdirAll(cacheDir, 0o750)
+		if err != nil {
+			return "", err
+		}
+		cacheDir, err = relPath(wrapperDir, cacheDir)
+		if err != nil {
+			return "", err
+		}
+		addFlagArg("--cache", cacheDir)
 	}
-	addFlagArg("--cache", cacheDir)
 
 	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o750)
 	if err != nil {
@@ -173,7 +220,7 @@ func createWrapper(name, target, bindownExec, cacheDir, configFile string, missi
 	return target, nil
 }
 
-func createBindownWrapper(target, cacheDir, tag, baseURL string) (string, error) {
+func createBindownWrapper(ctx context.Context, target, cacheDir, tag, baseURL string) (string, error) {
 	wrapperDir := filepath.Dir(target)
 	err := os.MkdirAll(wrapperDir, 0o750)
 	if err != nil {
@@ -188,7 +235,7 @@ func createBindownWrapper(target, cacheDir, tag, baseURL string) (string, error)
 	if err != nil {
 		return "", err
 	}
-	content, err := bootstrapper.Build(tag, &bootstrapper.BuildOpts{
+	content, err := bootstrapper.Build(ctx, tag, &bootstrapper.BuildOpts{
 		BinDir:  binDir,
 		Wrap:    true,
 		BaseURL: baseURL,
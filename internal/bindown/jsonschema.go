@@ -1,9 +1,12 @@
 package bindown
 
 import (
+	"cmp"
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/santhosh-tekuri/jsonschema/v5"
 	"gopkg.in/yaml.v3"
@@ -12,20 +15,66 @@ import (
 //go:embed bindown.schema.json
 var jsonSchemaText string
 
-// validateConfig checks whether cfg meets the json schema.
-func validateConfig(ctx context.Context, cfg []byte) error {
+// validateConfig checks whether cfg meets the json schema. Each problem is reported as a *ConfigError with the
+// position of the invalid value. filename is only used in errors.
+func validateConfig(ctx context.Context, filename string, cfg []byte) error {
 	var val any
 	err := yaml.Unmarshal(cfg, &val)
 	if err != nil {
-		return fmt.Errorf("config is not valid yaml (or json)")
+		return &ConfigError{
+			File: filename,
+			Line: yamlErrorLine(err),
+			Err:  fmt.Errorf("config is not valid yaml (or json): %w", err),
+		}
 	}
 	schema, err := jsonschema.CompileString("", jsonSchemaText)
 	if err != nil {
 		return err
 	}
 	err = schema.Validate(val)
-	if err != nil {
-		return fmt.Errorf("invalid config: %w", err)
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+	var errs []*ConfigError
+	seen := map[string]bool{}
+	var addLeaves func(ve *jsonschema.ValidationError)
+	addLeaves = func(ve *jsonschema.ValidationError) {
+		for _, cause := range ve.Causes {
+			addLeaves(cause)
+		}
+		if len(ve.Causes) > 0 {
+			return
+		}
+		key := ve.InstanceLocation + "\n" + ve.Message
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		ptr := ve.InstanceLocation
+		msg := ve.Message
+		if ptr != "" {
+			msg = ptr + ": " + msg
+		}
+		line, col := configPosition(filename, cfg, ptr)
+		errs = append(errs, &ConfigError{
+			File:   filename,
+			Line:   line,
+			Column: col,
+			Path:   ptr,
+			Err:    fmt.Errorf("invalid config: %s", msg),
+		})
+	}
+	addLeaves(validationErr)
+	slices.SortStableFunc(errs, func(a, b *ConfigError) int {
+		if a.Line != b.Line {
+			return cmp.Compare(a.Line, b.Line)
+		}
+		return cmp.Compare(a.Column, b.Column)
+	})
+	joined := make([]error, len(errs))
+	for i := range errs {
+		joined[i] = errs[i]
 	}
-	return nil
+	return errors.Join(joined...)
 }
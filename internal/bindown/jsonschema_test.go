@@ -16,7 +16,7 @@ func TestValidateConfig(t *testing.T) {
 	t.Run("valid yaml", func(t *testing.T) {
 		cfg, err := os.ReadFile(filepath.Join("testdata", "configs", "ex1.yaml"))
 		require.NoError(t, err)
-		err = validateConfig(ctx, cfg)
+		err = validateConfig(ctx, "", cfg)
 		require.NoError(t, err)
 	})
 
@@ -25,13 +25,13 @@ func TestValidateConfig(t *testing.T) {
 		require.NoError(t, err)
 		cfg, err := yaml2json(cfgContent)
 		require.NoError(t, err)
-		err = validateConfig(ctx, cfg)
+		err = validateConfig(ctx, "", cfg)
 		require.NoError(t, err)
 	})
 
 	t.Run("empty", func(t *testing.T) {
 		cfg := []byte("")
-		err := validateConfig(ctx, cfg)
+		err := validateConfig(ctx, "", cfg)
 		require.Error(t, err)
 	})
 
@@ -47,7 +47,7 @@ url_checksums:
   foo: deadbeef
   bar: []
 `)
-		err := validateConfig(ctx, cfg)
+		err := validateConfig(ctx, "", cfg)
 		require.Error(t, err)
 	})
 
@@ -70,7 +70,7 @@ url_checksums:
     ]
   }
 }`)
-		err := validateConfig(ctx, cfg)
+		err := validateConfig(ctx, "", cfg)
 		require.Error(t, err)
 	})
 }
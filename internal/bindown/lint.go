@@ -0,0 +1,397 @@
+package bindown
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Severity is how serious a lint diagnostic is.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+var severityNames = []string{"info", "warning", "error"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return "unknown"
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity returns the Severity named s.
+func ParseSeverity(s string) (Severity, error) {
+	i := slices.Index(severityNames, s)
+	if i == -1 {
+		return 0, fmt.Errorf("invalid severity %q. must be one of %s", s, strings.Join(severityNames, ", "))
+	}
+	return Severity(i), nil
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	var err error
+	*s, err = ParseSeverity(string(text))
+	return err
+}
+
+// Lint rules
+const (
+	LintInvalidTemplate     = "invalid-template"
+	LintMissingTemplate     = "missing-template"
+	LintUnusedTemplate      = "unused-template"
+	LintUnusedTemplateSrc   = "unused-template-source"
+	LintUnusedVar           = "unused-var"
+	LintUndefinedVar        = "undefined-var"
+	LintMissingRequiredVar  = "missing-required-var"
+	LintUnmatchableOverride = "unmatchable-override"
+)
+
+// Diagnostic is a problem found by Lint.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Rule     string   `json:"rule"`
+	// Path is a JSON pointer to the value with the problem.
+	Path string `json:"path"`
+	// File, Line and Column are where Path is defined. Line and Column are 1-based and are 0 when unknown.
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	msg := fmt.Sprintf("%s: %s: %s (%s)", d.Severity, d.Path, d.Message, d.Rule)
+	return (&ConfigError{File: d.File, Line: d.Line, Column: d.Column, Err: errors.New(msg)}).Error()
+}
+
+// Lint checks c for problems that the json schema can't catch. It doesn't download anything.
+func (c *Config) Lint() []Diagnostic {
+	l := &linter{cfg: c}
+	l.lintTemplateUsage()
+	for _, name := range sortedKeys(c.Dependencies) {
+		l.lintDependency(name)
+	}
+	for _, name := range sortedKeys(c.Templates) {
+		l.lintTemplateVars(name)
+	}
+	for i := range l.diagnostics {
+		d := &l.diagnostics[i]
+		d.File, d.Line, d.Column = c.position(d.Path)
+	}
+	return l.diagnostics
+}
+
+type linter struct {
+	cfg         *Config
+	diagnostics []Diagnostic
+}
+
+func (l *linter) add(severity Severity, rule, path, format string, args ...any) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{
+		Severity: severity,
+		Rule:     rule,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// templateUsers returns the names of dependencies that use tmplName directly or through other templates.
+func (l *linter) templateUsers(tmplName string) []string {
+	var users []string
+	for _, depName := range sortedKeys(l.cfg.Dependencies) {
+		tmpl := l.cfg.Dependencies[depName].Template
+		for depth := 0; tmpl != nil && depth < maxTemplateDepth; depth++ {
+			if *tmpl == tmplName {
+				users = append(users, depName)
+				break
+			}
+			next := l.cfg.Templates[*tmpl]
+			if next == nil {
+				break
+			}
+			tmpl = next.Template
+		}
+	}
+	return users
+}
+
+func (l *linter) lintTemplateUsage() {
+	for _, name := range sortedKeys(l.cfg.Templates) {
+		if len(l.templateUsers(name)) == 0 {
+			l.add(SeverityWarning, LintUnusedTemplate, jsonPointer(sectionTemplates, name),
+				"template %q isn't used by any dependency", name)
+		}
+		tmpl := l.cfg.Templates[name].Template
+		if tmpl != nil && *tmpl != "" && l.cfg.Templates[*tmpl] == nil {
+			l.add(SeverityError, LintMissingTemplate, jsonPointer(sectionTemplates, name, "template"),
+				"no template named %q", *tmpl)
+		}
+	}
+	for _, src := range sortedKeys(l.cfg.TemplateSources) {
+		prefix := src + "#"
+		used := slices.ContainsFunc(MapKeys(l.cfg.Templates), func(name string) bool {
+			return strings.HasPrefix(name, prefix)
+		})
+		for _, dep := range l.cfg.Dependencies {
+			if dep.Template != nil && strings.HasPrefix(*dep.Template, prefix) {
+				used = true
+			}
+		}
+		if !used {
+			l.add(SeverityInfo, LintUnusedTemplateSrc, jsonPointer(sectionTemplateSources, src),
+				"no templates come from template source %q", src)
+		}
+	}
+}
+
+func (l *linter) lintDependency(name string) {
+	ptr := jsonPointer(sectionDependencies, name)
+	dep := l.cfg.Dependencies[name].clone()
+	if dep.Template != nil && *dep.Template != "" && l.cfg.Templates[*dep.Template] == nil {
+		l.add(SeverityError, LintMissingTemplate, ptr+"/template", "no template named %q", *dep.Template)
+		return
+	}
+	err := dep.applyTemplate(l.cfg.Templates, 0)
+	if err != nil {
+		l.add(SeverityError, LintMissingTemplate, ptr+"/template", "%v", err)
+		return
+	}
+	refs, ok := l.varRefs(ptr, &l.cfg.Dependencies[name].Overrideable)
+	if !ok {
+		return
+	}
+	tmplRefs, _ := l.varRefs("", &dep.Overrideable)
+	for k := range tmplRefs {
+		refs[k] = true
+	}
+	l.lintUnusedVars(ptr, &l.cfg.Dependencies[name].Overrideable, refs)
+
+	systems, err := l.cfg.DependencySystems(name)
+	if err != nil || len(systems) == 0 || (len(l.cfg.Systems) == 0 && len(dep.Systems) == 0) {
+		return
+	}
+	l.lintOverrideMatchers(ptr, dep.Vars, l.cfg.Dependencies[name].Overrides, systems)
+
+	missingRequired := map[string][]string{}
+	undefined := map[string][]string{}
+	for _, system := range systems {
+		built := dep.clone()
+		if built.Vars == nil {
+			built.Vars = map[string]string{}
+		}
+		err = built.applyOverrides(system, 0)
+		if err != nil {
+			continue
+		}
+		vars := varsWithSubstitutions(built.Vars, built.Substitutions)
+		for _, v := range built.RequiredVars {
+			if _, ok := vars[v]; !ok {
+				missingRequired[v] = append(missingRequired[v], string(system))
+			}
+		}
+		used, _ := l.varRefs("", &Overrideable{
+			URL:          built.URL,
+			ArchivePath:  built.ArchivePath,
+			BinName:      built.BinName,
+			ChecksumsURL: built.ChecksumsURL,
+			Signature:    built.Signature,
+		})
+		for v := range used {
+			if _, ok := vars[v]; !ok && v != "os" && v != "arch" {
+				undefined[v] = append(undefined[v], string(system))
+			}
+		}
+	}
+	for _, v := range sortedKeys(missingRequired) {
+		l.add(SeverityError, LintMissingRequiredVar, ptr+"/required_vars",
+			"required var %q isn't set for %s", v, strings.Join(missingRequired[v], ", "))
+	}
+	for _, v := range sortedKeys(undefined) {
+		l.add(SeverityError, LintUndefinedVar, ptr,
+			"var %q is used but isn't set for %s", v, strings.Join(undefined[v], ", "))
+	}
+}
+
+// lintTemplateVars reports vars in a template that aren't used by the template or the dependencies that use it.
+func (l *linter) lintTemplateVars(name string) {
+	ptr := jsonPointer(sectionTemplates, name)
+	tmpl := l.cfg.Templates[name]
+	refs, ok := l.varRefs(ptr, &tmpl.Overrideable)
+	if !ok {
+		return
+	}
+	merged := tmpl.clone()
+	if merged.applyTemplate(l.cfg.Templates, 0) == nil {
+		mergedRefs, _ := l.varRefs("", &merged.Overrideable)
+		for k := range mergedRefs {
+			refs[k] = true
+		}
+	}
+	for _, depName := range l.templateUsers(name) {
+		dep := l.cfg.Dependencies[depName].clone()
+		if dep.applyTemplate(l.cfg.Templates, 0) != nil {
+			continue
+		}
+		depRefs, _ := l.varRefs("", &dep.Overrideable)
+		for k := range depRefs {
+			refs[k] = true
+		}
+	}
+	l.lintUnusedVars(ptr, &tmpl.Overrideable, refs)
+	if len(l.cfg.Systems) > 0 {
+		l.lintOverrideMatchers(ptr, tmpl.Vars, tmpl.Overrides, l.cfg.Systems)
+	}
+}
+
+// lintUnusedVars reports vars in o and its overrides that aren't in refs.
+func (l *linter) lintUnusedVars(ptr string, o *Overrideable, refs map[string]bool) {
+	for _, k := range sortedKeys(o.Vars) {
+		if !refs[k] {
+			l.add(SeverityWarning, LintUnusedVar, ptr+"/vars/"+escapeJSONPointer(k),
+				"var %q isn't used by url, archive_path, bin or checksums_url", k)
+		}
+	}
+	for i := range o.Overrides {
+		l.lintUnusedVars(ptr+"/overrides/"+strconv.Itoa(i)+"/dependency", &o.Overrides[i].Dependency, refs)
+	}
+}
+
+// varRefs returns the names of vars that are read by url, archive_path, bin and checksums_url templates in o and its
+// overrides or used by override matchers. Invalid templates are reported with ptr unless ptr is "". Returns false if
+// any templates are invalid.
+func (l *linter) varRefs(ptr string, o *Overrideable) (map[string]bool, bool) {
+	refs := map[string]bool{}
+	ok := true
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"url", o.URL},
+		{"archive_path", o.ArchivePath},
+		{"bin", o.BinName},
+		{"checksums_url", o.ChecksumsURL},
+	}
+	if o.Signature != nil {
+		fields = append(fields, struct {
+			name  string
+			value *string
+		}{"signature/url", &o.Signature.URL})
+	}
+	for _, field := range fields {
+		if field.value == nil {
+			continue
+		}
+		tmpl, err := template.New("").Parse(*field.value)
+		if err != nil {
+			ok = false
+			if ptr != "" {
+				l.add(SeverityError, LintInvalidTemplate, ptr+"/"+field.name, "%q is not a valid template", *field.value)
+			}
+			continue
+		}
+		if tmpl.Tree != nil {
+			templateFieldRefs(tmpl.Tree.Root, refs)
+		}
+	}
+	for i := range o.Overrides {
+		for k := range o.Overrides[i].OverrideMatcher {
+			refs[k] = true
+		}
+		overridePtr := ""
+		if ptr != "" {
+			overridePtr = ptr + "/overrides/" + strconv.Itoa(i) + "/dependency"
+		}
+		overrideRefs, overrideOK := l.varRefs(overridePtr, &o.Overrides[i].Dependency)
+		ok = ok && overrideOK
+		for k := range overrideRefs {
+			refs[k] = true
+		}
+	}
+	return refs, ok
+}
+
+// templateFieldRefs adds the names of top-level fields read by a parsed template to refs.
+func templateFieldRefs(node parse.Node, refs map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			templateFieldRefs(child, refs)
+		}
+	case *parse.ActionNode:
+		templateFieldRefs(n.Pipe, refs)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			templateFieldRefs(cmd, refs)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			templateFieldRefs(arg, refs)
+		}
+	case *parse.FieldNode:
+		refs[n.Ident[0]] = true
+	case *parse.ChainNode:
+		templateFieldRefs(n.Node, refs)
+	case *parse.IfNode:
+		templateFieldRefs(&n.BranchNode, refs)
+	case *parse.RangeNode:
+		templateFieldRefs(&n.BranchNode, refs)
+	case *parse.WithNode:
+		templateFieldRefs(&n.BranchNode, refs)
+	case *parse.BranchNode:
+		templateFieldRefs(n.Pipe, refs)
+		templateFieldRefs(n.List, refs)
+		templateFieldRefs(n.ElseList, refs)
+	case *parse.TemplateNode:
+		templateFieldRefs(n.Pipe, refs)
+	}
+}
+
+// lintOverrideMatchers reports overrides with os or arch matchers that don't match any of systems.
+func (l *linter) lintOverrideMatchers(ptr string, vars map[string]string, overrides []DependencyOverride, systems []System) {
+	for i, override := range overrides {
+		overridePtr := ptr + "/overrides/" + strconv.Itoa(i)
+		matcher := override.OverrideMatcher
+		osPatterns, hasOS := matcher["os"]
+		archPatterns, hasArch := matcher["arch"]
+		_, osVar := vars["os"]
+		_, archVar := vars["arch"]
+		if (!hasOS || osVar) && (!hasArch || archVar) {
+			continue
+		}
+		matches := slices.ContainsFunc(systems, func(system System) bool {
+			return (!hasOS || osVar || slices.Contains(osPatterns, system.OS())) &&
+				(!hasArch || archVar || slices.Contains(archPatterns, system.Arch()))
+		})
+		if !matches {
+			l.add(SeverityWarning, LintUnmatchableOverride, overridePtr+"/matcher",
+				"override doesn't match any of the systems %s", joinSystems(systems))
+		}
+	}
+}
+
+func joinSystems(systems []System) string {
+	names := make([]string, len(systems))
+	for i, system := range systems {
+		names[i] = string(system)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,138 @@
+package bindown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Lint(t *testing.T) {
+	t.Run("clean", func(t *testing.T) {
+		cfg := mustConfigFromYAML(t, `
+systems: [linux/amd64, darwin/arm64]
+template_sources:
+  origin: https://example.com/bindown.yml
+dependencies:
+  foo:
+    template: origin#foo
+    vars:
+      version: 1.2.3
+templates:
+  origin#foo:
+    url: https://example.com/foo-{{.version}}-{{.os}}-{{.arch}}{{.suffix}}
+    required_vars: [version]
+    vars:
+      suffix: .tar.gz
+    overrides:
+      - matcher:
+          os: [darwin]
+        dependency:
+          vars:
+            suffix: .zip
+`)
+		require.Empty(t, cfg.Lint())
+	})
+
+	t.Run("findings", func(t *testing.T) {
+		cfg := mustConfigFromYAML(t, `
+systems: [linux/amd64, darwin/arm64]
+template_sources:
+  unused: https://example.com/bindown.yml
+dependencies:
+  foo:
+    url: https://example.com/foo-{{.version}}-{{.os}}
+    required_vars: [version]
+    vars:
+      extra: x
+    overrides:
+      - matcher:
+          os: [windows]
+        dependency:
+          url: https://example.com/foo.exe
+      - matcher:
+          os: [linux]
+        dependency:
+          vars:
+            version: 1.0.0
+  bar:
+    template: missing
+  baz:
+    url: https://example.com/{{.bad
+templates:
+  lonely:
+    url: https://example.com/lonely
+`)
+		require.Equal(t, []Diagnostic{
+			{
+				Severity: SeverityWarning,
+				Rule:     LintUnusedTemplate,
+				Path:     "/templates/lonely",
+				Message:  `template "lonely" isn't used by any dependency`,
+			},
+			{
+				Severity: SeverityInfo,
+				Rule:     LintUnusedTemplateSrc,
+				Path:     "/template_sources/unused",
+				Message:  `no templates come from template source "unused"`,
+			},
+			{
+				Severity: SeverityError,
+				Rule:     LintMissingTemplate,
+				Path:     "/dependencies/bar/template",
+				Message:  `no template named "missing"`,
+			},
+			{
+				Severity: SeverityError,
+				Rule:     LintInvalidTemplate,
+				Path:     "/dependencies/baz/url",
+				Message:  `"https://example.com/{{.bad" is not a valid template`,
+			},
+			{
+				Severity: SeverityWarning,
+				Rule:     LintUnusedVar,
+				Path:     "/dependencies/foo/vars/extra",
+				Message:  `var "extra" isn't used by url, archive_path, bin or checksums_url`,
+			},
+			{
+				Severity: SeverityWarning,
+				Rule:     LintUnmatchableOverride,
+				Path:     "/dependencies/foo/overrides/0/matcher",
+				Message:  "override doesn't match any of the systems linux/amd64, darwin/arm64",
+			},
+			{
+				Severity: SeverityError,
+				Rule:     LintMissingRequiredVar,
+				Path:     "/dependencies/foo/required_vars",
+				Message:  `required var "version" isn't set for darwin/arm64`,
+			},
+			{
+				Severity: SeverityError,
+				Rule:     LintUndefinedVar,
+				Path:     "/dependencies/foo",
+				Message:  `var "version" is used but isn't set for darwin/arm64`,
+			},
+		}, cfg.Lint())
+	})
+
+	t.Run("no systems", func(t *testing.T) {
+		cfg := mustConfigFromYAML(t, `
+dependencies:
+  foo:
+    url: https://example.com/foo
+    overrides:
+      - matcher:
+          os: [plan9]
+        dependency:
+          url: https://example.com/foo-plan9
+`)
+		require.Empty(t, cfg.Lint())
+	})
+}
+
+func TestParseSeverity(t *testing.T) {
+	s, err := ParseSeverity("warning")
+	require.NoError(t, err)
+	require.Equal(t, SeverityWarning, s)
+	_, err = ParseSeverity("fatal")
+	require.EqualError(t, err, `invalid severity "fatal". must be one of info, warning, error`)
+}
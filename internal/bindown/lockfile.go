@@ -0,0 +1,123 @@
+package bindown
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const lockfileHeader = "# This file is generated by bindown. Do not edit it by hand.\n"
+
+// LockFilename returns the name of the lockfile for a config file. The lockfile is bindown.lock in the config file's
+// directory.
+func LockFilename(cfgFile string) string {
+	return filepath.Join(filepath.Dir(cfgFile), "bindown.lock")
+}
+
+// Lockfile returns the name of the lockfile c reads checksums from. Returns "" when c keeps checksums in
+// url_checksums.
+func (c *Config) Lockfile() string {
+	return c.lockfile
+}
+
+// loadLockfile merges checksums from the lockfile next to c's file if it exists. Checksums in c take precedence.
+func (c *Config) loadLockfile(ctx context.Context) error {
+	filename := LockFilename(c.Filename)
+	info, err := os.Stat(filename)
+	if err != nil || info.IsDir() {
+		return nil
+	}
+	lock, err := configFromSource(ctx, filename)
+	if err != nil {
+		return fmt.Errorf("error loading lockfile %s: %w", filename, err)
+	}
+	if !configEntriesEqual(lock, &Config{URLChecksums: lock.URLChecksums}) || len(lock.Imports) > 0 ||
+		lock.Cache != "" || lock.InstallDir != "" {
+		return fmt.Errorf("lockfile %s can only contain url_checksums", filename)
+	}
+	lock.Filename = filename
+	c.lockfile = filename
+	for u := range c.URLChecksums {
+		if c.owner(sectionURLChecksums, u) == "" {
+			c.inlineChecksums = setMapValue(c.inlineChecksums, u, true)
+		}
+	}
+	c.imported = append(c.imported, lock)
+	return c.mergeImported(lock, &importGraph{})
+}
+
+// UseLockfile moves the checksums in the root config's url_checksums to a lockfile. Checksums added later are also
+// kept in the lockfile. Changes are written by WriteFile.
+//
+// Without UseLockfile, checksums that were in the root config when it was loaded stay there even when it has a
+// lockfile.
+func (c *Config) UseLockfile() {
+	if c.lockfile == "" {
+		c.lockfile = LockFilename(c.Filename)
+		c.imported = append(c.imported, &Config{Filename: c.lockfile})
+	}
+	if c.owners == nil {
+		c.owners = map[entryKey]string{}
+	}
+	// checksums for urls only the overlay uses stay in the overlay
+	c.claimOverlayChecksums()
+	c.inlineChecksums = nil
+	for u := range c.URLChecksums {
+		key := entryKey{section: sectionURLChecksums, name: u}
+		if c.owners[key] == "" {
+			c.owners[key] = c.lockfile
+		}
+	}
+	c.removeLockfile = ""
+}
+
+// InlineChecksums moves the checksums from the lockfile to the root config's url_checksums. WriteFile writes the
+// checksums to the config file and deletes the lockfile.
+func (c *Config) InlineChecksums() {
+	if c.lockfile == "" {
+		return
+	}
+	for key, owner := range c.owners {
+		if owner == c.lockfile {
+			delete(c.owners, key)
+		}
+	}
+	for i, imp := range c.imported {
+		if imp.Filename == c.lockfile {
+			c.imported = append(c.imported[:i], c.imported[i+1:]...)
+			break
+		}
+	}
+	c.removeLockfile = c.lockfile
+	c.lockfile = ""
+	c.inlineChecksums = nil
+}
+
+// writeLockfile writes lock to the lockfile if it differs from orig, the content c.imported[i] was loaded with. A new
+// lockfile is written even when it's empty, so the lockfile layout is kept.
+func (c *Config) writeLockfile(i int, orig, lock *Config) error {
+	_, err := os.Stat(lock.Filename)
+	if err == nil && configEntriesEqual(orig, lock) {
+		return nil
+	}
+	var buf bytes.Buffer
+	buf.WriteString(lockfileHeader)
+	if len(lock.URLChecksums) == 0 {
+		// an empty document isn't a valid config
+		buf.WriteString("url_checksums: {}\n")
+	} else {
+		err = EncodeYaml(&buf, &Config{URLChecksums: lock.URLChecksums})
+		if err != nil {
+			return err
+		}
+	}
+	err = writeFileAtomic(lock.Filename, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	lock.raw = buf.Bytes()
+	c.imported[i] = lock
+	return nil
+}
@@ -0,0 +1,147 @@
+package bindown
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockFilename(t *testing.T) {
+	require.Equal(t, filepath.Join("foo", "bindown.lock"), LockFilename(filepath.Join("foo", ".bindown.yaml")))
+}
+
+func TestConfig_lockfile(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reads checksums from lockfile", func(t *testing.T) {
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		writeTestFile(t, cfgFile, `
+dependencies:
+  foo:
+    url: https://example.com/foo-{{.os}}
+url_checksums:
+  https://example.com/foo-darwin: inline
+`)
+		writeTestFile(t, filepath.Join(dir, "bindown.lock"), `
+url_checksums:
+  https://example.com/foo-linux: locked
+  https://example.com/foo-darwin: ignored
+`)
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(dir, "bindown.lock"), cfg.Lockfile())
+		dep, err := cfg.BuildDependency("foo", "linux/amd64")
+		require.NoError(t, err)
+		require.Equal(t, "locked", dep.checksum)
+		dep, err = cfg.BuildDependency("foo", "darwin/amd64")
+		require.NoError(t, err)
+		require.Equal(t, "inline", dep.checksum)
+	})
+
+	t.Run("lockfile with other content", func(t *testing.T) {
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		writeTestFile(t, cfgFile, `systems: [linux/amd64]`)
+		writeTestFile(t, filepath.Join(dir, "bindown.lock"), `systems: [linux/amd64]`)
+		_, err := NewConfig(ctx, cfgFile, true)
+		require.EqualError(t, err, "lockfile "+filepath.Join(dir, "bindown.lock")+" can only contain url_checksums")
+	})
+
+	t.Run("migrate", func(t *testing.T) {
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		lockFile := filepath.Join(dir, "bindown.lock")
+		writeTestFile(t, cfgFile, `# my tools
+dependencies:
+  foo:
+    url: foo-url
+
+url_checksums:
+  foo-url: deadbeef
+`)
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		cfg.UseLockfile()
+		require.NoError(t, cfg.WriteFile(false))
+		requireFileContent(t, cfgFile, `# my tools
+dependencies:
+  foo:
+    url: foo-url
+
+`)
+		requireFileContent(t, lockFile, lockfileHeader+`url_checksums:
+  foo-url: deadbeef
+`)
+
+		cfg, err = NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		cfg.URLChecksums["bar-url"] = "beefdead"
+		require.NoError(t, cfg.WriteFile(false))
+		requireFileContent(t, lockFile, lockfileHeader+`url_checksums:
+  bar-url: beefdead
+  foo-url: deadbeef
+`)
+
+		cfg.InlineChecksums()
+		require.NoError(t, cfg.WriteFile(false))
+		require.NoFileExists(t, lockFile)
+		requireFileContent(t, cfgFile, `# my tools
+dependencies:
+  foo:
+    url: foo-url
+url_checksums:
+  bar-url: beefdead
+  foo-url: deadbeef
+
+`)
+	})
+
+	t.Run("keeps inline checksums", func(t *testing.T) {
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		lockFile := filepath.Join(dir, "bindown.lock")
+		cfgContent := `dependencies:
+  foo:
+    url: foo-url
+url_checksums:
+  foo-url: deadbeef
+`
+		writeTestFile(t, cfgFile, cfgContent)
+		writeTestFile(t, lockFile, lockfileHeader+"url_checksums: {}\n")
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		cfg.URLChecksums["bar-url"] = "beefdead"
+		require.NoError(t, cfg.WriteFile(false))
+		requireFileContent(t, cfgFile, cfgContent)
+		requireFileContent(t, lockFile, lockfileHeader+`url_checksums:
+  bar-url: beefdead
+`)
+
+		cfg.UseLockfile()
+		require.NoError(t, cfg.WriteFile(false))
+		requireFileContent(t, cfgFile, `dependencies:
+  foo:
+    url: foo-url
+`)
+		requireFileContent(t, lockFile, lockfileHeader+`url_checksums:
+  bar-url: beefdead
+  foo-url: deadbeef
+`)
+	})
+
+	t.Run("empty lockfile", func(t *testing.T) {
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		writeTestFile(t, cfgFile, `systems: [linux/amd64]`)
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		cfg.UseLockfile()
+		require.NoError(t, cfg.WriteFile(false))
+		cfg, err = NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(dir, "bindown.lock"), cfg.Lockfile())
+	})
+}
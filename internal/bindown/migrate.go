@@ -0,0 +1,96 @@
+package bindown
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentConfigVersion is the newest config format version supported by this version of bindown.
+const CurrentConfigVersion = 1
+
+// configMigration upgrades a config from the previous version to version.
+type configMigration struct {
+	version     int
+	description string
+	migrate     func(c *Config) error
+}
+
+// configMigrations are the steps to upgrade a config to CurrentConfigVersion. They are sorted by version with one
+// migration per version.
+var configMigrations = []configMigration{
+	{
+		version:     1,
+		description: "default the cache directory to .bindown",
+		migrate:     migrateLegacyCacheDir,
+	},
+}
+
+// migrateLegacyCacheDir sets cache to .cache for configs that use the .cache directory because v4 mistakenly made it
+// the default. From version 1, the default is always .bindown.
+func migrateLegacyCacheDir(c *Config) error {
+	if c.Cache != "" || c.Filename == "" {
+		return nil
+	}
+	cfgDir := filepath.Dir(c.Filename)
+	cacheDir, err := findCacheDir(cfgDir)
+	if err != nil {
+		return err
+	}
+	if cacheDir == filepath.Join(cfgDir, ".cache") {
+		c.Cache = ".cache"
+	}
+	return nil
+}
+
+// Migrate upgrades c to CurrentConfigVersion one version at a time. It returns a description of each migration
+// that was applied. Changes are written by WriteFile.
+func (c *Config) Migrate() ([]string, error) {
+	if c.Version > CurrentConfigVersion {
+		return nil, newerConfigVersionError(c.Version)
+	}
+	var applied []string
+	for _, m := range configMigrations {
+		if m.version <= c.Version {
+			continue
+		}
+		err := m.migrate(c)
+		if err != nil {
+			return nil, fmt.Errorf("error migrating config to version %d: %w", m.version, err)
+		}
+		c.Version = m.version
+		applied = append(applied, fmt.Sprintf("version %d: %s", m.version, m.description))
+	}
+	return applied, nil
+}
+
+// checkConfigVersion returns an error if data is a config with a version newer than CurrentConfigVersion. It is
+// checked before validating the config so the error isn't a confusing schema error.
+func checkConfigVersion(filename string, data []byte) error {
+	var cfg struct {
+		Version any `yaml:"version"`
+	}
+	err := yaml.Unmarshal(data, &cfg)
+	if err != nil {
+		// let validation report invalid yaml
+		return nil
+	}
+	version, ok := cfg.Version.(int)
+	if ok && version > CurrentConfigVersion {
+		line, col := configPosition(filename, data, "/version")
+		return &ConfigError{
+			File:   filename,
+			Line:   line,
+			Column: col,
+			Path:   "/version",
+			Err:    newerConfigVersionError(version),
+		}
+	}
+	return nil
+}
+
+func newerConfigVersionError(version int) error {
+	return fmt.Errorf("config version %d is newer than the latest version supported by this bindown (%d). "+
+		"upgrade bindown to use this config", version, CurrentConfigVersion)
+}
@@ -0,0 +1,80 @@
+package bindown
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Migrate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("legacy cache dir", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(dir, ".git"), 0o750))
+		writeTestFile(t, filepath.Join(dir, ".gitignore"), "/.cache\n")
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		writeTestFile(t, cfgFile, "systems: [linux/amd64] # just linux\n")
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		applied, err := cfg.Migrate()
+		require.NoError(t, err)
+		require.Equal(t, []string{"version 1: default the cache directory to .bindown"}, applied)
+		diff, err := cfg.Diff(false)
+		require.NoError(t, err)
+		require.Equal(t, `--- `+cfgFile+`
++++ `+cfgFile+`
+@@ -1 +1,3 @@
++version: 1
++cache: .cache
+ systems: [linux/amd64] # just linux
+`, diff)
+		require.NoError(t, cfg.WriteFile(false))
+
+		cfg, err = NewConfig(ctx, cfgFile, false)
+		require.NoError(t, err)
+		require.Equal(t, 1, cfg.Version)
+		require.Equal(t, ".cache", cfg.Cache)
+		applied, err = cfg.Migrate()
+		require.NoError(t, err)
+		require.Empty(t, applied)
+	})
+
+	t.Run("default cache dir", func(t *testing.T) {
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		writeTestFile(t, cfgFile, "systems: [linux/amd64]\n")
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		_, err = cfg.Migrate()
+		require.NoError(t, err)
+		require.NoError(t, cfg.WriteFile(false))
+		requireFileContent(t, cfgFile, "version: 1\nsystems: [linux/amd64]\n")
+	})
+
+	t.Run("newer version", func(t *testing.T) {
+		_, err := ConfigFromYAML(ctx, []byte("version: 99\nsomething_new: true\n"))
+		require.EqualError(t, err, "1:10: config version 99 is newer than the latest version supported by this bindown (1). "+
+			"upgrade bindown to use this config")
+	})
+}
+
+func TestNewConfig_versionedCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".git"), 0o750))
+	writeTestFile(t, filepath.Join(dir, ".gitignore"), "/.cache\n")
+	cfgFile := filepath.Join(dir, "bindown.yml")
+
+	writeTestFile(t, cfgFile, "{}")
+	cfg, err := NewConfig(context.Background(), cfgFile, false)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, ".cache"), cfg.Cache)
+
+	writeTestFile(t, cfgFile, "version: 1")
+	cfg, err = NewConfig(context.Background(), cfgFile, false)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, ".bindown"), cfg.Cache)
+}
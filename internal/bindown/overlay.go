@@ -0,0 +1,350 @@
+package bindown
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// OverlayFilename returns the name of the local overlay file for a config file. The overlay for bindown.yml is
+// bindown.local.yml.
+func OverlayFilename(cfgFile string) string {
+	ext := filepath.Ext(cfgFile)
+	return strings.TrimSuffix(cfgFile, ext) + ".local" + ext
+}
+
+// LoadOverlay deep-merges the config file at filename over c. Values from the overlay take precedence.
+//
+// Dependencies and templates that exist in both configs are merged field by field. Vars and substitutions are
+// merged by key, overrides from the overlay are applied after the existing overrides and required_vars are combined.
+// Systems, template_sources, url_checksums and hosts are merged by key. url_rewrites from the overlay are tried before
+// the config's.
+//
+// WriteFile never writes values from the overlay to c's own files. Entries that only exist in the overlay are written
+// back to the overlay.
+func (c *Config) LoadOverlay(ctx context.Context, filename string) error {
+	if c.overlay != nil {
+		return fmt.Errorf("config already has an overlay")
+	}
+	overlay, err := configFromSource(ctx, filename)
+	if err != nil {
+		return err
+	}
+	if len(overlay.Imports) > 0 {
+		return fmt.Errorf("overlay %s can't have imports", filename)
+	}
+	overlay.Filename = filename
+	c.base = c.entriesClone()
+	c.overlay = overlay
+	c.imported = append(c.imported, overlay)
+	if c.owners == nil {
+		c.owners = map[entryKey]string{}
+	}
+	setOwner := func(section, name string) {
+		c.owners[entryKey{section: section, name: name}] = filename
+	}
+
+	if overlay.Cache != "" {
+		c.Cache = overlay.Cache
+	}
+	c.SealCache = overrideValue(c.SealCache, overlay.SealCache)
+	if overlay.InstallDir != "" {
+		c.InstallDir = overlay.InstallDir
+	}
+	// the overlay's rewrites are tried first
+	c.URLRewrites = append(slices.Clip(overlay.URLRewrites), c.URLRewrites...)
+	for host, hostConfig := range overlay.Hosts {
+		c.Hosts = setMapValue(c.Hosts, host, hostConfig)
+	}
+	for _, system := range overlay.Systems {
+		if !slices.Contains(c.Systems, system) {
+			setOwner(sectionSystems, string(system))
+			c.Systems = append(c.Systems, system)
+		}
+	}
+	for name, dep := range overlay.Dependencies {
+		if c.Dependencies[name] == nil {
+			setOwner(sectionDependencies, name)
+			c.Dependencies = setMapValue(c.Dependencies, name, dep.clone())
+			continue
+		}
+		c.Dependencies[name].applyOverlay(dep)
+	}
+	for name, tmpl := range overlay.Templates {
+		if c.Templates[name] == nil {
+			setOwner(sectionTemplates, name)
+			c.Templates = setMapValue(c.Templates, name, tmpl.clone())
+			continue
+		}
+		c.Templates[name].applyOverlay(tmpl)
+	}
+	for name, src := range overlay.TemplateSources {
+		if _, ok := c.TemplateSources[name]; !ok {
+			setOwner(sectionTemplateSources, name)
+		}
+		c.TemplateSources = setMapValue(c.TemplateSources, name, src)
+	}
+	for u, sum := range overlay.URLChecksums {
+		if _, ok := c.URLChecksums[u]; !ok {
+			setOwner(sectionURLChecksums, u)
+		}
+		c.URLChecksums = setMapValue(c.URLChecksums, u, sum)
+	}
+	return nil
+}
+
+// entriesClone returns a deep copy of c's exported fields.
+func (c *Config) entriesClone() *Config {
+	clone := &Config{
+		Version:         c.Version,
+		Cache:           c.Cache,
+		SealCache:       clonePointer(c.SealCache),
+		InstallDir:      c.InstallDir,
+		Imports:         slices.Clone(c.Imports),
+		URLRewrites:     slices.Clone(c.URLRewrites),
+		Hosts:           maps.Clone(c.Hosts),
+		Systems:         slices.Clone(c.Systems),
+		TemplateSources: maps.Clone(c.TemplateSources),
+		URLChecksums:    maps.Clone(c.URLChecksums),
+		Filename:        c.Filename,
+	}
+	for name, dep := range c.Dependencies {
+		clone.Dependencies = setMapValue(clone.Dependencies, name, dep.clone())
+	}
+	for name, tmpl := range c.Templates {
+		clone.Templates = setMapValue(clone.Templates, name, tmpl.clone())
+	}
+	return clone
+}
+
+// splitFiles is splitImports for c without its overlay.
+func (c *Config) splitFiles() (root *Config, imports []*Config) {
+	c.claimOverlayChecksums()
+	return c.withoutOverlay().splitImports()
+}
+
+// claimOverlayChecksums makes the overlay the owner of checksums added since it was loaded for urls that are only
+// used because of the overlay, so they are written to the overlay instead of the config file or lockfile.
+func (c *Config) claimOverlayChecksums() {
+	if c.overlay == nil {
+		return
+	}
+	var added []string
+	for u := range c.URLChecksums {
+		_, ok := c.base.URLChecksums[u]
+		if !ok && c.owner(sectionURLChecksums, u) == "" {
+			added = append(added, u)
+		}
+	}
+	if len(added) == 0 {
+		return
+	}
+	// base is c without the overlay or the entries that only exist in the overlay
+	base := c.withoutOverlay()
+	overlayOwned := func(section, name string) bool {
+		return c.owner(section, name) == c.overlay.Filename
+	}
+	base.Systems = slices.DeleteFunc(slices.Clone(c.Systems), func(system System) bool {
+		return overlayOwned(sectionSystems, string(system))
+	})
+	maps.DeleteFunc(base.Dependencies, func(name string, _ *Dependency) bool {
+		return overlayOwned(sectionDependencies, name)
+	})
+	maps.DeleteFunc(base.Templates, func(name string, _ *Dependency) bool {
+		return overlayOwned(sectionTemplates, name)
+	})
+	baseURLs := base.dependencyURLs()
+	urls := c.dependencyURLs()
+	for _, u := range added {
+		if urls[u] && !baseURLs[u] {
+			c.owners[entryKey{section: sectionURLChecksums, name: u}] = c.overlay.Filename
+		}
+	}
+}
+
+// dependencyURLs returns the url of every dependency on each of its systems. Dependencies that can't be built are
+// skipped.
+func (c *Config) dependencyURLs() map[string]bool {
+	urls := map[string]bool{}
+	for name := range c.Dependencies {
+		systems, err := c.DependencySystems(name)
+		if err != nil {
+			continue
+		}
+		for _, system := range systems {
+			dep, err := c.BuildDependency(name, system)
+			if err == nil {
+				urls[dep.url] = true
+			}
+		}
+	}
+	return urls
+}
+
+// withoutOverlay returns a copy of c with values from the overlay replaced by the values they overlaid. Values that
+// were changed after the overlay was applied are kept.
+func (c *Config) withoutOverlay() *Config {
+	if c.overlay == nil {
+		return c
+	}
+	result := *c
+	if c.overlay.Cache != "" && c.Cache == c.overlay.Cache {
+		result.Cache = c.base.Cache
+	}
+	result.SealCache = withoutOverlayValue(c.SealCache, c.overlay.SealCache, c.base.SealCache)
+	if c.overlay.InstallDir != "" && c.InstallDir == c.overlay.InstallDir {
+		result.InstallDir = c.base.InstallDir
+	}
+	if len(c.overlay.URLRewrites) > 0 {
+		result.URLRewrites = c.base.URLRewrites
+	}
+	if len(c.overlay.Hosts) > 0 {
+		result.Hosts = c.base.Hosts
+	}
+	result.Dependencies = maps.Clone(c.Dependencies)
+	for name, dep := range c.overlay.Dependencies {
+		if c.base.Dependencies[name] == nil || result.Dependencies[name] == nil {
+			continue
+		}
+		result.Dependencies[name] = result.Dependencies[name].withoutOverlay(dep, c.base.Dependencies[name])
+	}
+	result.Templates = maps.Clone(c.Templates)
+	for name, tmpl := range c.overlay.Templates {
+		if c.base.Templates[name] == nil || result.Templates[name] == nil {
+			continue
+		}
+		result.Templates[name] = result.Templates[name].withoutOverlay(tmpl, c.base.Templates[name])
+	}
+	result.TemplateSources = withoutOverlayEntries(c.TemplateSources, c.overlay.TemplateSources, c.base.TemplateSources)
+	result.URLChecksums = withoutOverlayEntries(c.URLChecksums, c.overlay.URLChecksums, c.base.URLChecksums)
+	return &result
+}
+
+// applyOverlay deep-merges o over d.
+func (d *Dependency) applyOverlay(o *Dependency) {
+	d.Homepage = overrideValue(d.Homepage, o.Homepage)
+	d.Description = overrideValue(d.Description, o.Description)
+	d.Template = overrideValue(d.Template, o.Template)
+	d.URL = overrideValue(d.URL, o.URL)
+	d.ArchivePath = overrideValue(d.ArchivePath, o.ArchivePath)
+	d.BinName = overrideValue(d.BinName, o.BinName)
+	d.Link = overrideValue(d.Link, o.Link)
+	d.ChecksumsURL = overrideValue(d.ChecksumsURL, o.ChecksumsURL)
+	d.ChecksumsAlgorithm = overrideValue(d.ChecksumsAlgorithm, o.ChecksumsAlgorithm)
+	d.Signature = overrideValue(d.Signature, o.Signature)
+	for k, v := range o.Vars {
+		d.Vars = setMapValue(d.Vars, k, v)
+	}
+	for k, subs := range o.Substitutions {
+		if d.Substitutions == nil {
+			d.Substitutions = map[string]map[string]string{}
+		}
+		for from, to := range subs {
+			d.Substitutions[k] = setMapValue(d.Substitutions[k], from, to)
+		}
+	}
+	d.Overrides = append(d.Overrides, o.clone().Overrides...)
+	if len(o.Systems) > 0 {
+		d.Systems = slices.Clone(o.Systems)
+	}
+	for _, v := range o.RequiredVars {
+		if !slices.Contains(d.RequiredVars, v) {
+			d.RequiredVars = append(d.RequiredVars, v)
+		}
+	}
+}
+
+// withoutOverlay returns a copy of d with the values set by overlay o replaced by the values from base.
+func (d *Dependency) withoutOverlay(o, base *Dependency) *Dependency {
+	result := d.clone()
+	result.Homepage = withoutOverlayValue(result.Homepage, o.Homepage, base.Homepage)
+	result.Description = withoutOverlayValue(result.Description, o.Description, base.Description)
+	result.Template = withoutOverlayValue(result.Template, o.Template, base.Template)
+	result.URL = withoutOverlayValue(result.URL, o.URL, base.URL)
+	result.ArchivePath = withoutOverlayValue(result.ArchivePath, o.ArchivePath, base.ArchivePath)
+	result.BinName = withoutOverlayValue(result.BinName, o.BinName, base.BinName)
+	result.Link = withoutOverlayValue(result.Link, o.Link, base.Link)
+	result.ChecksumsURL = withoutOverlayValue(result.ChecksumsURL, o.ChecksumsURL, base.ChecksumsURL)
+	result.ChecksumsAlgorithm = withoutOverlayValue(result.ChecksumsAlgorithm, o.ChecksumsAlgorithm, base.ChecksumsAlgorithm)
+	result.Signature = withoutOverlayValue(result.Signature, o.Signature, base.Signature)
+	result.Vars = withoutOverlayValues(result.Vars, o.Vars, base.Vars)
+	for k, subs := range o.Substitutions {
+		if result.Substitutions[k] == nil {
+			continue
+		}
+		result.Substitutions[k] = withoutOverlayValues(result.Substitutions[k], subs, base.Substitutions[k])
+		if result.Substitutions[k] == nil {
+			delete(result.Substitutions, k)
+		}
+	}
+	if len(result.Substitutions) == 0 && base.Substitutions == nil {
+		result.Substitutions = nil
+	}
+	n := len(o.Overrides)
+	if n > 0 && len(result.Overrides) >= n && reflect.DeepEqual(result.Overrides[len(result.Overrides)-n:], o.Overrides) {
+		result.Overrides = slices.Clip(result.Overrides[:len(result.Overrides)-n])
+		if len(result.Overrides) == 0 && base.Overrides == nil {
+			result.Overrides = nil
+		}
+	}
+	if len(o.Systems) > 0 && slices.Equal(result.Systems, o.Systems) {
+		result.Systems = slices.Clone(base.Systems)
+	}
+	result.RequiredVars = slices.DeleteFunc(result.RequiredVars, func(v string) bool {
+		return slices.Contains(o.RequiredVars, v) && !slices.Contains(base.RequiredVars, v)
+	})
+	if len(result.RequiredVars) == 0 && base.RequiredVars == nil {
+		result.RequiredVars = nil
+	}
+	return result
+}
+
+// withoutOverlayValue returns the base value if the current value is the one set by the overlay.
+func withoutOverlayValue[T comparable](current, overlay, base *T) *T {
+	if overlay == nil || current == nil || *current != *overlay {
+		return current
+	}
+	return clonePointer(base)
+}
+
+// withoutOverlayEntries restores the base value of entries that the overlay changed. Entries that only exist in the
+// overlay are kept.
+func withoutOverlayEntries(current, overlay, base map[string]string) map[string]string {
+	result := maps.Clone(current)
+	for k, v := range overlay {
+		baseVal, ok := base[k]
+		if ok && result[k] == v {
+			result[k] = baseVal
+		}
+	}
+	return result
+}
+
+// withoutOverlayValues replaces values in current that were set by overlay with their value in base. Returns nil
+// if the result would be empty and base is nil.
+func withoutOverlayValues(current, overlay, base map[string]string) map[string]string {
+	if len(overlay) == 0 {
+		return current
+	}
+	result := maps.Clone(current)
+	for k, v := range overlay {
+		cur, ok := result[k]
+		if !ok || cur != v {
+			continue
+		}
+		baseVal, ok := base[k]
+		if !ok {
+			delete(result, k)
+			continue
+		}
+		result[k] = baseVal
+	}
+	if len(result) == 0 && base == nil {
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,175 @@
+package bindown
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverlayFilename(t *testing.T) {
+	require.Equal(t, "bindown.local.yml", OverlayFilename("bindown.yml"))
+	require.Equal(t, filepath.Join("foo", ".bindown.local.json"), OverlayFilename(filepath.Join("foo", ".bindown.json")))
+}
+
+func TestConfig_LoadOverlay(t *testing.T) {
+	ctx := context.Background()
+	setup := func(t *testing.T) (cfgFile, overlayFile string) {
+		t.Helper()
+		dir := t.TempDir()
+		cfgFile = filepath.Join(dir, "bindown.yml")
+		overlayFile = filepath.Join(dir, "bindown.local.yml")
+		writeTestFile(t, cfgFile, `systems:
+  - linux/amd64
+dependencies:
+  foo:
+    url: https://example.com/foo-{{.version}}
+    vars:
+      version: 1.0.0
+      suffix: .tar.gz
+    overrides:
+      - matcher:
+          os: [windows]
+        dependency:
+          vars:
+            suffix: .zip
+url_checksums:
+  https://example.com/foo-1.0.0: deadbeef
+`)
+		writeTestFile(t, overlayFile, `systems:
+  - darwin/arm64
+dependencies:
+  foo:
+    url: https://mirror.example.com/foo-{{.version}}
+    vars:
+      version: 2.0.0
+    overrides:
+      - matcher:
+          os: [darwin]
+        dependency:
+          vars:
+            suffix: .pkg
+  mytool:
+    url: https://example.com/mytool
+url_checksums:
+  https://mirror.example.com/foo-2.0.0: beefdead
+hosts:
+  mirror.example.com:
+    token_env: MIRROR_TOKEN
+`)
+		return cfgFile, overlayFile
+	}
+
+	t.Run("merges", func(t *testing.T) {
+		cfgFile, overlayFile := setup(t)
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.NoError(t, cfg.LoadOverlay(ctx, overlayFile))
+		require.Equal(t, []System{"linux/amd64", "darwin/arm64"}, cfg.Systems)
+		require.Equal(t, []string{"foo", "mytool"}, cfg.DependencyNames())
+		foo := cfg.Dependencies["foo"]
+		require.Equal(t, "https://mirror.example.com/foo-{{.version}}", *foo.URL)
+		require.Equal(t, map[string]string{"version": "2.0.0", "suffix": ".tar.gz"}, foo.Vars)
+		require.Len(t, foo.Overrides, 2)
+		require.Equal(t, map[string]string{
+			"https://example.com/foo-1.0.0":        "deadbeef",
+			"https://mirror.example.com/foo-2.0.0": "beefdead",
+		}, cfg.URLChecksums)
+		require.Equal(t, map[string]*HostConfig{"mirror.example.com": {TokenEnv: "MIRROR_TOKEN"}}, cfg.Hosts)
+
+		sources := cfg.Sources()
+		require.Equal(t, cfgFile, sources["/systems/0"])
+		require.Equal(t, overlayFile, sources["/systems/1"])
+		require.Equal(t, overlayFile, sources["/dependencies/foo/url"])
+		require.Equal(t, overlayFile, sources["/dependencies/foo/vars/version"])
+		require.Equal(t, cfgFile, sources["/dependencies/foo/vars/suffix"])
+		require.Equal(t, cfgFile, sources["/dependencies/foo/overrides/0"])
+		require.Equal(t, overlayFile, sources["/dependencies/foo/overrides/1"])
+		require.Equal(t, overlayFile, sources["/dependencies/mytool"])
+		require.Equal(t, cfgFile, sources["/url_checksums/https:~1~1example.com~1foo-1.0.0"])
+
+		var buf bytes.Buffer
+		require.NoError(t, cfg.EncodeEffectiveYaml(&buf))
+		require.Contains(t, buf.String(), "version: 2.0.0 # from "+overlayFile)
+		require.Contains(t, buf.String(), "suffix: .tar.gz # from "+cfgFile)
+	})
+
+	t.Run("does not write overlay values to the config file", func(t *testing.T) {
+		cfgFile, overlayFile := setup(t)
+		wantOverlay, err := os.ReadFile(overlayFile)
+		require.NoError(t, err)
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.NoError(t, cfg.LoadOverlay(ctx, overlayFile))
+		require.NoError(t, cfg.SetDependencyVars("foo", map[string]string{"suffix": ".tgz"}))
+		require.NoError(t, cfg.WriteFile(false))
+		got, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.Equal(t, []System{"linux/amd64"}, got.Systems)
+		require.Equal(t, []string{"foo"}, got.DependencyNames())
+		foo := got.Dependencies["foo"]
+		require.Equal(t, "https://example.com/foo-{{.version}}", *foo.URL)
+		require.Equal(t, map[string]string{"version": "1.0.0", "suffix": ".tgz"}, foo.Vars)
+		require.Len(t, foo.Overrides, 1)
+		require.Equal(t, map[string]string{"https://example.com/foo-1.0.0": "deadbeef"}, got.URLChecksums)
+		require.Nil(t, got.Hosts)
+		gotOverlay, err := os.ReadFile(overlayFile)
+		require.NoError(t, err)
+		require.Equal(t, string(wantOverlay), string(gotOverlay))
+	})
+
+	t.Run("writes overlay-only entries to the overlay", func(t *testing.T) {
+		cfgFile, overlayFile := setup(t)
+		wantConfig, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.NoError(t, cfg.LoadOverlay(ctx, overlayFile))
+		require.NoError(t, cfg.SetDependencyVars("mytool", map[string]string{"version": "1.2.3"}))
+		require.NoError(t, cfg.WriteFile(false))
+		got, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.Equal(t, wantConfig.Dependencies, got.Dependencies)
+		overlay, err := NewConfig(ctx, overlayFile, true)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"version": "1.2.3"}, overlay.Dependencies["mytool"].Vars)
+	})
+
+	t.Run("writes checksums for overlay-only urls to the overlay", func(t *testing.T) {
+		cfgFile, overlayFile := setup(t)
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.NoError(t, cfg.LoadOverlay(ctx, overlayFile))
+		cfg.URLChecksums["https://example.com/mytool"] = "cafebabe"
+		cfg.URLChecksums["https://mirror.example.com/foo-2.0.0"] = "feedface"
+		require.NoError(t, cfg.WriteFile(false))
+		got, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"https://example.com/foo-1.0.0": "deadbeef"}, got.URLChecksums)
+		overlay, err := NewConfig(ctx, overlayFile, true)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			"https://example.com/mytool":           "cafebabe",
+			"https://mirror.example.com/foo-2.0.0": "feedface",
+		}, overlay.URLChecksums)
+	})
+	t.Run("turns off seal_cache", func(t *testing.T) {
+		dir := t.TempDir()
+		cfgFile := filepath.Join(dir, "bindown.yml")
+		overlayFile := filepath.Join(dir, "bindown.local.yml")
+		writeTestFile(t, cfgFile, "seal_cache: true\nsystems:\n  - linux/amd64\n")
+		writeTestFile(t, overlayFile, "seal_cache: false\n")
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.NoError(t, cfg.LoadOverlay(ctx, overlayFile))
+		require.False(t, *cfg.SealCache)
+		require.False(t, cfg.downloadsCache().ReadOnly)
+		cfg.Systems = append(cfg.Systems, "darwin/amd64")
+		require.NoError(t, cfg.WriteFile(false))
+		requireFileContent(t, cfgFile, "seal_cache: true\nsystems:\n  - linux/amd64\n  - darwin/amd64\n")
+		requireFileContent(t, overlayFile, "seal_cache: false\n")
+	})
+}
@@ -0,0 +1,313 @@
+package bindown
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/willabides/bindown/v4/internal/cache"
+	"github.com/willabides/bindown/v4/internal/httpclient"
+)
+
+// partialDownload describes a partially downloaded file. It is saved next to the partial file so the download can be
+// resumed with a Range request as long as the file at URL hasn't changed.
+type partialDownload struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// validator returns the value for an If-Range header or "" if the server didn't give a way to tell whether the file
+// changed.
+func (p *partialDownload) validator() string {
+	// weak etags can't be used with If-Range
+	if p.ETag != "" && !strings.HasPrefix(p.ETag, "W/") {
+		return p.ETag
+	}
+	return p.LastModified
+}
+
+// errCantResume means a partial download can't be resumed and must start over.
+var errCantResume = errors.New("can't resume download")
+
+// resumeDownload downloads the file at url to targetPath like downloadFile. The download is kept in partialFile until
+// it is complete. When a download fails, the next call continues from the end of partialFile if the server supports
+// Range requests and the file's ETag or Last-Modified hasn't changed. partialFile is removed once the download
+// completes or when it can't be resumed.
+func resumeDownload(ctx context.Context, partialFile, targetPath, url string, algorithms ...string) (*multiHasher, error) {
+	hasher, err := resumePartialDownload(ctx, partialFile, url, algorithms)
+	if errors.Is(err, errCantResume) {
+		err = removePartialDownload(partialFile)
+		if err != nil {
+			return nil, err
+		}
+		hasher, err = resumePartialDownload(ctx, partialFile, url, algorithms)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(targetPath), 0o750)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Rename(partialFile, targetPath)
+	if err != nil {
+		return nil, err
+	}
+	return hasher, removePartialDownload(partialFile)
+}
+
+func resumePartialDownload(ctx context.Context, partialFile, url string, algorithms []string) (_ *multiHasher, errOut error) {
+	hasher, err := newMultiHasher(algorithms...)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(partialFile), 0o750)
+	if err != nil {
+		return nil, err
+	}
+	partial, offset, err := readPartialDownload(partialFile, url)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", partial.validator())
+	}
+	resp, err := httpclient.FromContext(ctx).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer deferErr(&errOut, resp.Body.Close)
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if contentRangeStart(resp.Header.Get("Content-Range")) != offset {
+			return nil, errCantResume
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		return nil, errCantResume
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("failed downloading %s", url)
+	default:
+		// the server sent the whole file
+		offset = 0
+	}
+	discard := false
+	defer func() {
+		if discard {
+			errOut = errors.Join(errOut, removePartialDownload(partialFile))
+		}
+	}()
+	flag := os.O_RDWR | os.O_CREATE
+	if offset == 0 {
+		flag |= os.O_TRUNC
+		partial = &partialDownload{
+			URL:          url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		}
+		err = writePartialDownload(partialFile, partial)
+		if err != nil {
+			return nil, err
+		}
+	}
+	out, err := os.OpenFile(partialFile, flag, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	defer deferErr(&errOut, out.Close)
+	// the bytes already downloaded need to be hashed too
+	_, err = io.Copy(hasher, io.LimitReader(out, offset))
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(io.MultiWriter(out, hasher), resp.Body)
+	if err != nil {
+		// without a validator there is no way to tell whether the file changes before the next attempt
+		discard = partial.validator() == ""
+		return nil, err
+	}
+	return hasher, nil
+}
+
+// partialDownloadsDir is where dlCache keeps partial downloads. Keys that start with a dot are reserved for internal
+// use, so it can't collide with a cache entry.
+func partialDownloadsDir(dlCache *cache.Cache) string {
+	return filepath.Join(dlCache.Root, ".partial")
+}
+
+func partialDownloadMetaFile(partialFile string) string {
+	return partialFile + ".json"
+}
+
+// readPartialDownload returns the description of partialFile and the number of bytes that can be resumed from. It
+// returns 0 when there is nothing to resume.
+func readPartialDownload(partialFile, url string) (*partialDownload, int64, error) {
+	data, err := os.ReadFile(partialDownloadMetaFile(partialFile))
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	var partial partialDownload
+	err = json.Unmarshal(data, &partial)
+	if err != nil || partial.URL != url || partial.validator() == "" {
+		return nil, 0, nil
+	}
+	info, err := os.Stat(partialFile)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return &partial, info.Size(), nil
+}
+
+func writePartialDownload(partialFile string, partial *partialDownload) error {
+	data, err := json.Marshal(partial)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(partialDownloadMetaFile(partialFile), data, 0o640)
+}
+
+func removePartialDownload(partialFile string) error {
+	err := os.Remove(partialFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = os.Remove(partialDownloadMetaFile(partialFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// the download's directory under partialDownloadsDir is only needed while it has files
+	dir := filepath.Dir(partialFile)
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) > 0 {
+		return nil
+	}
+	err = os.Remove(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// partialDownloadEntries returns the partial downloads in dlCache as cache entries with keys like .partial/<key>. Their
+// LastUsed is when they were last written to.
+func partialDownloadEntries(dlCache *cache.Cache) ([]CacheEntry, error) {
+	dir := partialDownloadsDir(dlCache)
+	dirEntries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result []CacheEntry
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, dirEntry.Name())
+		size, lastUsed, err := partialDownloadUsage(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, CacheEntry{
+			Cache:      "downloads",
+			Path:       path,
+			partialKey: dirEntry.Name(),
+			Entry: cache.Entry{
+				Key:      ".partial/" + dirEntry.Name(),
+				Metadata: cache.Metadata{Size: size, LastUsed: lastUsed},
+			},
+		})
+	}
+	return result, nil
+}
+
+// partialDownloadUsage returns the size of the files in a partial download's directory and when the directory or its
+// files were last written.
+func partialDownloadUsage(dir string) (size int64, lastUsed time.Time, _ error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	lastUsed = info.ModTime()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	for _, entry := range entries {
+		info, err = entry.Info()
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		size += info.Size()
+		if info.ModTime().After(lastUsed) {
+			lastUsed = info.ModTime()
+		}
+	}
+	return size, lastUsed, nil
+}
+
+// evictPartialDownload removes the partial download for key from dlCache unless it was written to after lastUsed. It
+// holds key's lock so a download that is in progress isn't removed. It reports whether the partial download was
+// removed.
+func evictPartialDownload(dlCache *cache.Cache, key string, lastUsed time.Time) (bool, error) {
+	removed := false
+	err := dlCache.Locked(key, func() error {
+		dir := filepath.Join(partialDownloadsDir(dlCache), key)
+		_, current, err := partialDownloadUsage(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if current.After(lastUsed) {
+			return nil
+		}
+		removed = true
+		return os.RemoveAll(dir)
+	})
+	return removed, err
+}
+
+// contentRangeStart returns the first byte position from a Content-Range header like "bytes 100-199/200" or -1.
+func contentRangeStart(contentRange string) int64 {
+	rng, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return -1
+	}
+	start, _, ok := strings.Cut(rng, "-")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,136 @@
+package bindown
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// resumeServer serves content with http.ServeContent. When interrupt is set, the next response is cut off halfway.
+type resumeServer struct {
+	mu        sync.Mutex
+	content   []byte
+	etag      string
+	interrupt bool
+	ranges    []string
+}
+
+func (s *resumeServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	content, etag, interrupt := s.content, s.etag, s.interrupt
+	s.interrupt = false
+	s.ranges = append(s.ranges, req.Header.Get("Range"))
+	s.mu.Unlock()
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !interrupt {
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(content))
+		return
+	}
+	w.Header().Set("Content-Length", "100000")
+	_, _ = w.Write(content[:len(content)/2])
+	w.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+func (s *resumeServer) update(fn func(s *resumeServer)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s)
+}
+
+func Test_resumeDownload(t *testing.T) {
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	wantSum := mustHashContent(t, content)
+
+	setup := func(t *testing.T, etag string) (srv *resumeServer, dlURL, partialFile, target string) {
+		t.Helper()
+		srv = &resumeServer{content: content, etag: etag, interrupt: true}
+		ts := httptest.NewServer(srv)
+		t.Cleanup(ts.Close)
+		dir := t.TempDir()
+		return srv, ts.URL + "/foo.tar.gz", filepath.Join(dir, ".partial", "foo.tar.gz"), filepath.Join(dir, "foo", "foo.tar.gz")
+	}
+
+	t.Run("resumes", func(t *testing.T) {
+		srv, dlURL, partialFile, target := setup(t, `"v1"`)
+		_, err := resumeDownload(ctx, partialFile, target, dlURL, ChecksumSHA256)
+		require.Error(t, err)
+		require.FileExists(t, partialFile)
+		require.NoFileExists(t, target)
+
+		sums, err := resumeDownload(ctx, partialFile, target, dlURL, ChecksumSHA256)
+		require.NoError(t, err)
+		require.Equal(t, wantSum, sums.checksum(ChecksumSHA256))
+		got, err := os.ReadFile(target)
+		require.NoError(t, err)
+		require.Equal(t, content, got)
+		require.Equal(t, []string{"", "bytes=50000-"}, srv.ranges)
+		require.NoFileExists(t, partialFile)
+		require.NoFileExists(t, partialDownloadMetaFile(partialFile))
+		require.NoDirExists(t, filepath.Dir(partialFile))
+	})
+
+	t.Run("starts over when the file changed", func(t *testing.T) {
+		srv, dlURL, partialFile, target := setup(t, `"v1"`)
+		_, err := resumeDownload(ctx, partialFile, target, dlURL, ChecksumSHA256)
+		require.Error(t, err)
+		newContent := bytes.Repeat([]byte("abcdefghij"), 10000)
+		srv.update(func(s *resumeServer) {
+			s.content = newContent
+			s.etag = `"v2"`
+		})
+
+		sums, err := resumeDownload(ctx, partialFile, target, dlURL, ChecksumSHA256)
+		require.NoError(t, err)
+		require.Equal(t, mustHashContent(t, newContent), sums.checksum(ChecksumSHA256))
+		got, err := os.ReadFile(target)
+		require.NoError(t, err)
+		require.Equal(t, newContent, got)
+	})
+
+	t.Run("discards partial download without a validator", func(t *testing.T) {
+		srv, dlURL, partialFile, target := setup(t, "")
+		_, err := resumeDownload(ctx, partialFile, target, dlURL, ChecksumSHA256)
+		require.Error(t, err)
+		require.NoFileExists(t, partialFile)
+
+		sums, err := resumeDownload(ctx, partialFile, target, dlURL, ChecksumSHA256)
+		require.NoError(t, err)
+		require.Equal(t, wantSum, sums.checksum(ChecksumSHA256))
+		require.Equal(t, []string{"", ""}, srv.ranges)
+	})
+
+	t.Run("starts over when the range isn't satisfiable", func(t *testing.T) {
+		srv, dlURL, partialFile, target := setup(t, `"v1"`)
+		_, err := resumeDownload(ctx, partialFile, target, dlURL, ChecksumSHA256)
+		require.Error(t, err)
+		srv.update(func(s *resumeServer) {
+			s.content = content[:100]
+		})
+
+		sums, err := resumeDownload(ctx, partialFile, target, dlURL, ChecksumSHA256)
+		require.NoError(t, err)
+		require.Equal(t, mustHashContent(t, content[:100]), sums.checksum(ChecksumSHA256))
+		require.Equal(t, []string{"", "bytes=50000-", ""}, srv.ranges)
+	})
+}
+
+func mustHashContent(t *testing.T, content []byte) string {
+	t.Helper()
+	hasher, err := newMultiHasher(ChecksumSHA256)
+	require.NoError(t, err)
+	_, err = hasher.Write(content)
+	require.NoError(t, err)
+	return hasher.checksum(ChecksumSHA256)
+}
@@ -0,0 +1,133 @@
+package bindown
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// URLRewrite rewrites download urls to a mirror. It has either a prefix or a regex.
+type URLRewrite struct {
+	// Urls that start with prefix are rewritten by replacing prefix with replacement.
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+
+	// Urls that match this regular expression are rewritten by replacing the match with replacement. replacement
+	// can refer to submatches like $1.
+	Regex string `json:"regex,omitempty" yaml:"regex,omitempty"`
+
+	// The replacement for prefix or regex.
+	Replacement string `json:"replacement" yaml:"replacement"`
+
+	// re is Regex compiled by compile.
+	re *regexp.Regexp
+}
+
+// ParseURLRewrite parses a rewrite from a string like "<prefix>=<replacement>" or "regex:<regex>=<replacement>". The
+// prefix or regex can't contain "=".
+func ParseURLRewrite(s string) (URLRewrite, error) {
+	from, replacement, ok := strings.Cut(s, "=")
+	if !ok || from == "" {
+		return URLRewrite{}, fmt.Errorf("invalid url rewrite %q. must be <prefix>=<replacement> or regex:<regex>=<replacement>", s)
+	}
+	rewrite := URLRewrite{Prefix: from, Replacement: replacement}
+	if pattern, isRegex := strings.CutPrefix(from, "regex:"); isRegex {
+		rewrite = URLRewrite{Regex: pattern, Replacement: replacement}
+	}
+	err := rewrite.compile()
+	if err != nil {
+		return URLRewrite{}, err
+	}
+	return rewrite, nil
+}
+
+// compile checks r and compiles its regex, so it is only compiled once and a bad regex is reported when the config
+// is loaded.
+func (r *URLRewrite) compile() error {
+	re, err := r.regexp()
+	if err != nil {
+		return err
+	}
+	r.re = re
+	return nil
+}
+
+// regexp returns r's compiled regex or nil for a prefix rewrite. Rewrites that weren't compiled, like ones in a
+// Config built in code, are compiled on each call.
+func (r *URLRewrite) regexp() (*regexp.Regexp, error) {
+	if (r.Prefix == "") == (r.Regex == "") {
+		return nil, errors.New("url rewrite must have exactly one of prefix or regex")
+	}
+	if r.Prefix != "" || r.re != nil {
+		return r.re, nil
+	}
+	re, err := regexp.Compile(r.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url rewrite regex %q: %w", r.Regex, err)
+	}
+	return re, nil
+}
+
+// rewrite returns the rewritten u and whether the rule matched u.
+func (r *URLRewrite) rewrite(u string) (string, bool, error) {
+	re, err := r.regexp()
+	if err != nil {
+		return "", false, err
+	}
+	if re == nil {
+		rest, ok := strings.CutPrefix(u, r.Prefix)
+		if !ok {
+			return "", false, nil
+		}
+		return r.Replacement + rest, true, nil
+	}
+	if !re.MatchString(u) {
+		return "", false, nil
+	}
+	return re.ReplaceAllString(u, r.Replacement), true, nil
+}
+
+// AddURLRewrites adds rewrites that are tried before the config's url_rewrites. They aren't written to the config
+// file. This is for rewrites from the environment.
+func (c *Config) AddURLRewrites(rewrites ...URLRewrite) {
+	c.extraURLRewrites = append(slices.Clip(rewrites), c.extraURLRewrites...)
+}
+
+// mirrorURLs returns the urls that rewrites produce for dlURL in the order they should be tried. It doesn't include
+// dlURL.
+func (c *Config) mirrorURLs(dlURL string) ([]string, error) {
+	var mirrors []string
+	for _, rewrites := range [][]URLRewrite{c.extraURLRewrites, c.URLRewrites} {
+		for i := range rewrites {
+			mirror, ok, err := rewrites[i].rewrite(dlURL)
+			if err != nil {
+				return nil, err
+			}
+			if ok && mirror != dlURL && !slices.Contains(mirrors, mirror) {
+				mirrors = append(mirrors, mirror)
+			}
+		}
+	}
+	return mirrors, nil
+}
+
+// tryMirrors calls fn with each of mirrors and then dlURL until it succeeds. It returns the errors from every attempt
+// when none succeed.
+func tryMirrors(dlURL string, mirrors []string, fn func(u string) error) error {
+	var errs []error
+	for _, u := range append(slices.Clip(mirrors), dlURL) {
+		err := fn(u)
+		if err == nil {
+			return nil
+		}
+		if u != dlURL {
+			err = fmt.Errorf("mirror %s: %w", u, err)
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
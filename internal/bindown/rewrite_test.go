@@ -0,0 +1,254 @@
+package bindown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/bindown/v4/internal/testutil"
+)
+
+func TestParseURLRewrite(t *testing.T) {
+	got, err := ParseURLRewrite("https://github.com/=https://proxy.example.com/github/")
+	require.NoError(t, err)
+	require.Equal(t, URLRewrite{Prefix: "https://github.com/", Replacement: "https://proxy.example.com/github/"}, got)
+
+	got, err = ParseURLRewrite(`regex:^https://([^/]+)/(.*)$=https://proxy.example.com/$1/$2?a=b`)
+	require.NoError(t, err)
+	require.Equal(t, `^https://([^/]+)/(.*)$`, got.Regex)
+	require.Equal(t, "https://proxy.example.com/$1/$2?a=b", got.Replacement)
+	require.Empty(t, got.Prefix)
+	require.NotNil(t, got.re)
+
+	_, err = ParseURLRewrite("https://github.com/")
+	require.ErrorContains(t, err, "invalid url rewrite")
+
+	_, err = ParseURLRewrite("regex:(=foo")
+	require.ErrorContains(t, err, "invalid url rewrite regex")
+}
+
+func TestConfig_urlRewritesInvalidRegex(t *testing.T) {
+	_, err := ConfigFromYAML(context.Background(), []byte(`
+url_rewrites:
+  - prefix: https://github.com/
+    replacement: https://mirror.example.com/
+  - regex: "(foo"
+    replacement: bar
+`))
+	var cfgErr *ConfigError
+	require.ErrorAs(t, err, &cfgErr)
+	require.Equal(t, "/url_rewrites/1", cfgErr.Path)
+	require.Equal(t, 5, cfgErr.Line)
+	require.ErrorContains(t, err, "invalid url rewrite regex")
+}
+
+func TestConfig_mirrorURLs(t *testing.T) {
+	cfg := &Config{URLRewrites: []URLRewrite{
+		{Prefix: "https://github.com/", Replacement: "https://mirror1.example.com/"},
+		{Regex: `^https://github\.com/(.*)$`, Replacement: "https://mirror2.example.com/gh/$1"},
+		{Prefix: "https://example.com/", Replacement: "https://mirror3.example.com/"},
+	}}
+	cfg.AddURLRewrites(URLRewrite{Prefix: "https://", Replacement: "https://ci-proxy.example.com/"})
+	got, err := cfg.mirrorURLs("https://github.com/me/foo/releases/download/v1.0.0/foo.tar.gz")
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"https://ci-proxy.example.com/github.com/me/foo/releases/download/v1.0.0/foo.tar.gz",
+		"https://mirror1.example.com/me/foo/releases/download/v1.0.0/foo.tar.gz",
+		"https://mirror2.example.com/gh/me/foo/releases/download/v1.0.0/foo.tar.gz",
+	}, got)
+
+	cfg.URLRewrites = append(cfg.URLRewrites, URLRewrite{Replacement: "x"})
+	_, err = cfg.mirrorURLs("https://github.com/foo")
+	require.EqualError(t, err, "url rewrite must have exactly one of prefix or regex")
+}
+
+func Test_tryMirrors(t *testing.T) {
+	var tried []string
+	err := tryMirrors("orig", []string{"m1", "m2"}, func(u string) error {
+		tried = append(tried, u)
+		if u == "m2" {
+			return nil
+		}
+		return errors.New("failed")
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"m1", "m2"}, tried)
+
+	err = tryMirrors("orig", []string{"m1"}, func(string) error {
+		return errors.New("failed")
+	})
+	require.EqualError(t, err, "mirror m1: failed\nfailed")
+
+	err = tryMirrors("orig", nil, func(string) error {
+		return errors.New("failed")
+	})
+	require.EqualError(t, err, "failed")
+}
+
+func TestConfig_InstallDependencies_urlRewrites(t *testing.T) {
+	ctx := context.Background()
+	foo := filepath.Join("testdata", "downloadables", "foo.tar.gz")
+	mirror := testutil.ServeFile(t, foo, "/mirror/foo/foo.tar.gz", "")
+
+	install := func(t *testing.T, depURL, rewrites string) error {
+		t.Helper()
+		dir := t.TempDir()
+		cfg := mustConfigFromYAML(t, fmt.Sprintf(`
+install_dir: %q
+cache: %q
+url_checksums:
+  %s: %s
+url_rewrites:
+%s
+dependencies:
+  foo:
+    url: %s
+    archive_path: bin/foo.txt
+`, filepath.Join(dir, "bin"), filepath.Join(dir, "cache"), depURL, fooChecksum, rewrites, depURL))
+		return cfg.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", nil)
+	}
+
+	t.Run("uses mirror", func(t *testing.T) {
+		upstream := testutil.ServeFile(t, foo, "/foo/foo.tar.gz", "")
+		upstream.Close()
+		err := install(t, upstream.URL+"/foo/foo.tar.gz", fmt.Sprintf(`
+  - prefix: %s/
+    replacement: %s/mirror/
+`, upstream.URL, mirror.URL))
+		require.NoError(t, err)
+	})
+
+	t.Run("falls back to the original url", func(t *testing.T) {
+		upstream := testutil.ServeFile(t, foo, "/foo/foo.tar.gz", "")
+		err := install(t, upstream.URL+"/foo/foo.tar.gz", fmt.Sprintf(`
+  - regex: ^http://[^/]+/(.*)$
+    replacement: %s/missing/$1
+`, mirror.URL))
+		require.NoError(t, err)
+	})
+
+	t.Run("reports every failure", func(t *testing.T) {
+		upstream := testutil.ServeFile(t, foo, "/foo/foo.tar.gz", "")
+		upstream.Close()
+		err := install(t, upstream.URL+"/foo/foo.tar.gz", fmt.Sprintf(`
+  - prefix: %s/
+    replacement: %s/missing/
+`, upstream.URL, mirror.URL))
+		require.ErrorContains(t, err, fmt.Sprintf("mirror %s/missing/foo/foo.tar.gz: failed downloading", mirror.URL))
+		require.ErrorContains(t, err, upstream.URL+"/foo/foo.tar.gz")
+	})
+}
+
+func TestConfig_AddChecksums_urlRewrites(t *testing.T) {
+	ctx := context.Background()
+	foo := filepath.Join("testdata", "downloadables", "foo.tar.gz")
+	upstream := testutil.ServeFile(t, foo, "/foo/foo.tar.gz", "")
+	stale := testutil.ServeFile(t, filepath.Join("testdata", "downloadables", "fooinroot.tar.gz"), "/mirror/foo/foo.tar.gz", "")
+	fooURL := upstream.URL + "/foo/foo.tar.gz"
+	config := func(t *testing.T, urlChecksums string) *Config {
+		t.Helper()
+		return mustConfigFromYAML(t, fmt.Sprintf(`
+url_rewrites:
+  - prefix: %s/
+    replacement: %s/mirror/
+url_checksums: %s
+dependencies:
+  foo:
+    url: %s
+`, upstream.URL, stale.URL, urlChecksums, fooURL))
+	}
+
+	t.Run("new checksums come from the original url", func(t *testing.T) {
+		cfg := config(t, "{}")
+		err := cfg.AddChecksums(ctx, []string{"foo"}, []System{"darwin/amd64"})
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{fooURL: fooChecksum}, cfg.URLChecksums)
+	})
+
+	t.Run("existing checksums skip mismatched mirrors", func(t *testing.T) {
+		cfg := config(t, fmt.Sprintf("{%q: %s}", fooURL, fooChecksum))
+		err := cfg.AddChecksumsWithAlgorithm(ctx, []string{"foo"}, []System{"darwin/amd64"}, ChecksumSHA512)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(cfg.URLChecksums[fooURL], "sha512:"))
+	})
+}
+
+func TestConfig_urlRewrites_relatedFiles(t *testing.T) {
+	ctx := context.Background()
+	foo, err := os.ReadFile(filepath.Join("testdata", "downloadables", "foo.tar.gz"))
+	require.NoError(t, err)
+	signer := newCosignSigner(t)
+	manifest := []byte(fooChecksum + "  foo.tar.gz\n")
+	files := map[string][]byte{
+		"/mirror/foo.tar.gz":     foo,
+		"/mirror/SHA256SUMS":     manifest,
+		"/mirror/SHA256SUMS.sig": signer.sign(manifest),
+	}
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		content, ok := files[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	t.Cleanup(mirror.Close)
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstream.Close()
+
+	// config returns a config for foo from upstream, which is down, with a rewrite to mirror
+	config := func(t *testing.T, urlChecksums string) *Config {
+		t.Helper()
+		dir := t.TempDir()
+		return mustConfigFromYAML(t, fmt.Sprintf(`
+install_dir: %q
+cache: %q
+url_rewrites:
+  - prefix: %s/
+    replacement: %s/mirror/
+url_checksums: %s
+dependencies:
+  foo:
+    url: %s/foo.tar.gz
+    archive_path: bin/foo.txt
+    checksums_url: %s/SHA256SUMS
+    signature:
+      url: %s/SHA256SUMS.sig
+      type: cosign
+      target: checksums
+      public_key: %q
+`, filepath.Join(dir, "bin"), filepath.Join(dir, "cache"), upstream.URL, mirror.URL, urlChecksums,
+			upstream.URL, upstream.URL, upstream.URL, signer.publicKey))
+	}
+	fooURL := upstream.URL + "/foo.tar.gz"
+	withChecksum := fmt.Sprintf("{%q: %s}", fooURL, fooChecksum)
+
+	t.Run("signature and checksums_url", func(t *testing.T) {
+		cfg := config(t, withChecksum)
+		err := cfg.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("add checksums ignores mirrors", func(t *testing.T) {
+		cfg := config(t, "{}")
+		err := cfg.AddChecksums(ctx, []string{"foo"}, []System{"darwin/amd64"})
+		require.ErrorContains(t, err, upstream.URL+"/SHA256SUMS")
+		require.Empty(t, cfg.URLChecksums)
+	})
+
+	t.Run("verify checksums ignores mirrors", func(t *testing.T) {
+		cfg := config(t, withChecksum)
+		got, err := cfg.VerifyChecksums(ctx, []string{"foo"}, []System{"darwin/amd64"})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		require.Equal(t, fooURL, got[0].URL)
+		require.Equal(t, ChecksumUnavailable, got[0].Status)
+	})
+}
@@ -0,0 +1,83 @@
+package bindown
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SharedCacheDir returns the default root of the cache that is shared by every project on the machine. It is
+// "bindown/cache" in the user cache directory, which is $XDG_CACHE_HOME or ~/.cache on linux.
+func SharedCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("can't find the user cache directory for the shared cache: %w", err)
+	}
+	return filepath.Join(dir, "bindown", "cache"), nil
+}
+
+// UseSharedCache makes c use the shared cache in dir instead of a cache for the project. Downloads and extracts are
+// keyed by their content's checksum, so projects that download the same file share one copy. c.Cache is left as it
+// is, so writing the config doesn't record the shared cache's machine-specific path.
+func (c *Config) UseSharedCache(dir string) {
+	c.sharedCacheDir = dir
+	c.defaultSharedCache = false
+}
+
+// UseDefaultSharedCache is UseSharedCache with the directory from SharedCacheDir. Wrappers created afterward find the
+// shared cache of the user running them instead of using this directory.
+func (c *Config) UseDefaultSharedCache() error {
+	dir, err := SharedCacheDir()
+	if err != nil {
+		return err
+	}
+	c.UseSharedCache(dir)
+	c.defaultSharedCache = true
+	return nil
+}
+
+// cacheDir returns the root of the cache c uses.
+func (c *Config) cacheDir() string {
+	if c.sharedCacheDir != "" {
+		return c.sharedCacheDir
+	}
+	return c.Cache
+}
+
+// downloadCacheKey returns the downloads and extracts cache key for a file with the given checksum and name. Project
+// caches keep the keys they had before shared caches so their entries aren't downloaded again.
+func (c *Config) downloadCacheKey(algorithm, digest, filename string) string {
+	if c.sharedCacheDir != "" {
+		return contentCacheKey(algorithm, digest, filename)
+	}
+	return cacheKey(formatChecksum(algorithm, digest))
+}
+
+// binCacheKey returns the bin cache key for built dependency dep. Shared caches use sha256 so keys from different
+// projects don't collide.
+func (c *Config) binCacheKey(dep *Dependency) string {
+	material := dep.cacheKeyMaterial()
+	if c.sharedCacheDir == "" {
+		return cacheKey(material)
+	}
+	hasher := sha256.New()
+	mustWriteToHash(hasher, []byte(material))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// UsesSharedCache returns true when c uses a shared cache.
+func (c *Config) UsesSharedCache() bool {
+	return c.sharedCacheDir != ""
+}
+
+// contentCacheKey returns the downloads and extracts cache key for a file with the given checksum and name. The key
+// starts with the hex digest, prefixed with the algorithm unless it is sha256. The name is part of the key because
+// extracting a file that isn't an archive depends on its name.
+func contentCacheKey(algorithm, digest, filename string) string {
+	if algorithm != ChecksumSHA256 {
+		digest = algorithm + "-" + digest
+	}
+	return digest + "-" + filename
+}
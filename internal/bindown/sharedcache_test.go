@@ -0,0 +1,123 @@
+package bindown
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedCacheDir(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("XDG_CACHE_HOME is only used on linux")
+	}
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	got, err := SharedCacheDir()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "bindown", "cache"), got)
+}
+
+func Test_contentCacheKey(t *testing.T) {
+	require.Equal(t, fooChecksum+"-foo.tar.gz", contentCacheKey(ChecksumSHA256, fooChecksum, "foo.tar.gz"))
+	require.Equal(t, "sha512-abc-foo", contentCacheKey(ChecksumSHA512, "abc", "foo"))
+}
+
+func TestConfig_downloadCacheKey(t *testing.T) {
+	cfg := &Config{}
+	// project caches keep the keys from before shared caches
+	require.Equal(t, "001c6b959150d25e", cfg.downloadCacheKey(ChecksumSHA256, fooChecksum, "foo.tar.gz"))
+	require.Equal(t, cacheKey("sha512:abc"), cfg.downloadCacheKey(ChecksumSHA512, "abc", "foo"))
+
+	cfg.UseSharedCache(t.TempDir())
+	require.Equal(t, fooChecksum+"-foo.tar.gz", cfg.downloadCacheKey(ChecksumSHA256, fooChecksum, "foo.tar.gz"))
+}
+
+func TestConfig_binCacheKey(t *testing.T) {
+	cfg := mustConfigFromYAML(t, `
+dependencies:
+  foo:
+    url: https://example.com/foo.tar.gz
+`)
+	dep, err := cfg.BuildDependency("foo", "darwin/amd64")
+	require.NoError(t, err)
+	require.Equal(t, cacheKey(dep.cacheKeyMaterial()), cfg.binCacheKey(dep))
+	cfg.UseSharedCache(t.TempDir())
+	require.Len(t, cfg.binCacheKey(dep), 64)
+}
+
+func TestConfig_UseSharedCache(t *testing.T) {
+	ctx := context.Background()
+	foo, err := os.ReadFile(filepath.Join("testdata", "downloadables", "foo.tar.gz"))
+	require.NoError(t, err)
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write(foo)
+	}))
+	t.Cleanup(ts.Close)
+	sharedDir := t.TempDir()
+
+	// projects are different configs for the same file from different urls
+	project := func(t *testing.T, depURL string) *Config {
+		t.Helper()
+		cfg := mustConfigFromYAML(t, fmt.Sprintf(`
+install_dir: %q
+systems: [darwin/amd64]
+url_checksums:
+  %s: %s
+dependencies:
+  foo:
+    url: %s
+    archive_path: bin/foo.txt
+`, filepath.Join(t.TempDir(), "bin"), depURL, fooChecksum, depURL))
+		cfg.UseSharedCache(sharedDir)
+		require.Empty(t, cfg.Cache)
+		return cfg
+	}
+	projects := []*Config{
+		project(t, ts.URL+"/a/foo.tar.gz"),
+		project(t, ts.URL+"/b/foo.tar.gz"),
+		project(t, ts.URL+"/c/foo.tar.gz"),
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(projects))
+	for i, cfg := range projects {
+		wg.Add(1)
+		go func(i int, cfg *Config) {
+			defer wg.Done()
+			errs[i] = cfg.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", nil)
+		}(i, cfg)
+	}
+	wg.Wait()
+	for i, cfg := range projects {
+		require.NoError(t, errs[i])
+		require.FileExists(t, filepath.Join(cfg.InstallDir, "foo"))
+	}
+	require.Equal(t, int32(1), requests.Load())
+
+	entries, err := projects[0].CacheEntries()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		require.Equal(t, fooChecksum+"-foo.tar.gz", entry.Key)
+	}
+
+	_, err = projects[0].PruneCache(&ConfigPruneCacheOpts{Unreachable: true})
+	require.EqualError(t, err, "can't prune unreachable entries from a shared cache because other projects use it")
+
+	err = projects[0].ClearCache()
+	require.EqualError(t, err, "can't clear a shared cache because other projects use it")
+	require.DirExists(t, sharedDir)
+	require.NoError(t, projects[0].ClearSharedCache())
+	require.NoDirExists(t, sharedDir)
+}
@@ -0,0 +1,340 @@
+package bindown
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Signature types
+const (
+	SignatureCosign   = "cosign"
+	SignatureMinisign = "minisign"
+	SignatureGPG      = "gpg"
+)
+
+// SignatureTypes are the supported signature types.
+var SignatureTypes = []string{SignatureCosign, SignatureMinisign, SignatureGPG}
+
+// Signature targets
+const (
+	SignatureTargetFile      = "file"
+	SignatureTargetChecksums = "checksums"
+)
+
+type Signature struct {
+	// The url of a detached signature. It is a go template like url.
+	URL string `json:"url" yaml:"url"`
+
+	// The type of signature. "cosign" is a signature from `cosign sign-blob --key`. "minisign" is a minisign or
+	// signify compatible signature. "gpg" is an armored or binary OpenPGP signature.
+	Type string `json:"type" yaml:"type" jsonschema:"enum=cosign,enum=minisign,enum=gpg"`
+
+	// What the signature signs. "file" is the downloaded file. "checksums" is the file at checksums_url, and the
+	// downloaded file's checksum must be listed in it. Default is "file".
+	Target string `json:"target,omitempty" yaml:"target,omitempty" jsonschema:"enum=file,enum=checksums"`
+
+	// The public key to verify the signature with. For cosign this is a PEM encoded public key. For minisign it is
+	// the base64 key or the content of a minisign public key file. For gpg it is an armored public key.
+	PublicKey string `json:"public_key,omitempty" yaml:"public_key,omitempty"`
+
+	// A file containing the public key. Relative paths are relative to the config file that defines it.
+	PublicKeyFile string `json:"public_key_file,omitempty" yaml:"public_key_file,omitempty"`
+}
+
+// validate checks that s has everything needed to verify a signature.
+func (s *Signature) validate() error {
+	if s.URL == "" {
+		return errors.New("signature has no url")
+	}
+	if !slices.Contains(SignatureTypes, s.Type) {
+		return fmt.Errorf("unknown signature type %q. must be one of %s", s.Type, strings.Join(SignatureTypes, ", "))
+	}
+	if s.Target != "" && s.Target != SignatureTargetFile && s.Target != SignatureTargetChecksums {
+		return fmt.Errorf("unknown signature target %q. must be %s or %s", s.Target, SignatureTargetFile, SignatureTargetChecksums)
+	}
+	if (s.PublicKey == "") == (s.PublicKeyFile == "") {
+		return errors.New("signature must have exactly one of public_key or public_key_file")
+	}
+	return nil
+}
+
+// publicKey returns the content of PublicKey or PublicKeyFile.
+func (s *Signature) publicKey() ([]byte, error) {
+	if s.PublicKey != "" {
+		return []byte(s.PublicKey), nil
+	}
+	return os.ReadFile(s.PublicKeyFile)
+}
+
+// verifyDependencySignature verifies the signature of dep's downloaded file at filename. It does nothing when dep has
+// no signature.
+func verifyDependencySignature(ctx context.Context, dep *Dependency, filename string) error {
+	dep.mustBeBuilt()
+	sig := dep.Signature
+	if sig == nil {
+		return nil
+	}
+	sigData, err := downloadMirroredBytes(ctx, sig.URL, dep.signatureMirrors, "signature")
+	if err != nil {
+		return err
+	}
+	if sig.Target != SignatureTargetChecksums {
+		err = verifySignatureFile(sig, filename, sigData)
+		if err != nil {
+			return fmt.Errorf("invalid signature for %s: %w", dep.url, err)
+		}
+		return nil
+	}
+	if dep.ChecksumsURL == nil || *dep.ChecksumsURL == "" {
+		return fmt.Errorf("dependency %q has a signature for checksums but no checksums_url", dep.name)
+	}
+	manifest, err := downloadMirroredBytes(ctx, *dep.ChecksumsURL, dep.checksumsMirrors, "checksums file")
+	if err != nil {
+		return err
+	}
+	err = verifySignature(sig, manifest, sigData)
+	if err != nil {
+		return fmt.Errorf("invalid signature for %s: %w", *dep.ChecksumsURL, err)
+	}
+	want, err := manifestChecksum(parseChecksumManifest(manifest, dep.checksumsAlgorithm()), dep.url)
+	if err != nil {
+		return err
+	}
+	if want == "" {
+		return fmt.Errorf("checksums file %s has no checksum for %s", *dep.ChecksumsURL, dep.url)
+	}
+	algorithm, err := checksumAlgorithm(want)
+	if err != nil {
+		return err
+	}
+	got, err := fileChecksum(filename, algorithm)
+	if err != nil {
+		return err
+	}
+	if !checksumsEqual(want, got) {
+		return fmt.Errorf("checksum mismatch for %s in signed checksums file %s\nwanted: %s\ngot: %s",
+			dep.url, *dep.ChecksumsURL, want, got)
+	}
+	return nil
+}
+
+// verifySignatureFile verifies that sigData is a valid signature of the file at filename.
+func verifySignatureFile(sig *Signature, filename string, sigData []byte) (errOut error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer deferErr(&errOut, f.Close)
+	return verifySignatureReader(sig, f, sigData)
+}
+
+// verifySignature verifies that sigData is a valid signature of data.
+func verifySignature(sig *Signature, data, sigData []byte) error {
+	return verifySignatureReader(sig, bytes.NewReader(data), sigData)
+}
+
+func verifySignatureReader(sig *Signature, data io.Reader, sigData []byte) error {
+	err := sig.validate()
+	if err != nil {
+		return err
+	}
+	key, err := sig.publicKey()
+	if err != nil {
+		return err
+	}
+	switch sig.Type {
+	case SignatureCosign:
+		return verifyCosign(key, data, sigData)
+	case SignatureMinisign:
+		return verifyMinisign(key, data, sigData)
+	default:
+		return verifyGPG(key, data, sigData)
+	}
+}
+
+// verifyCosign verifies a signature created with `cosign sign-blob --key`. The signature is base64 encoded.
+func verifyCosign(key []byte, data io.Reader, sigData []byte) error {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return errors.New("cosign public key is not PEM encoded")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid cosign public key: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigData)))
+	if err != nil {
+		return fmt.Errorf("cosign signature is not base64 encoded: %w", err)
+	}
+	if edKey, ok := pub.(ed25519.PublicKey); ok {
+		msg, err := io.ReadAll(data)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(edKey, msg, sig) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	}
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, data)
+	if err != nil {
+		return err
+	}
+	digest := hasher.Sum(nil)
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, sig) {
+			return errors.New("signature verification failed")
+		}
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, sig)
+		if err != nil {
+			return errors.New("signature verification failed")
+		}
+	default:
+		return fmt.Errorf("unsupported cosign public key type %T", pub)
+	}
+	return nil
+}
+
+// verifyMinisign verifies a minisign signature. It checks both the signature of the data and the signature of the
+// trusted comment.
+func verifyMinisign(key []byte, data io.Reader, sigData []byte) error {
+	pub, err := minisignKeyData(key, 42)
+	if err != nil {
+		return fmt.Errorf("invalid minisign public key: %w", err)
+	}
+	if string(pub[:2]) != "Ed" {
+		return errors.New("invalid minisign public key: unsupported algorithm")
+	}
+	keyID, edKey := pub[2:10], ed25519.PublicKey(pub[10:])
+
+	lines := strings.Split(strings.ReplaceAll(string(sigData), "\r\n", "\n"), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("invalid minisign signature")
+	}
+	sig, err := minisignKeyData([]byte(lines[1]), 74)
+	if err != nil {
+		return fmt.Errorf("invalid minisign signature: %w", err)
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errors.New("invalid minisign signature: bad trusted comment signature")
+	}
+	if !bytes.Equal(sig[2:10], keyID) {
+		return errors.New("signature was made with a different key")
+	}
+
+	var msg []byte
+	switch string(sig[:2]) {
+	case "Ed":
+		msg, err = io.ReadAll(data)
+	case "ED":
+		hasher, _ := blake2b.New512(nil)
+		_, err = io.Copy(hasher, data)
+		msg = hasher.Sum(nil)
+	default:
+		return errors.New("invalid minisign signature: unsupported algorithm")
+	}
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(edKey, msg, sig[10:]) {
+		return errors.New("signature verification failed")
+	}
+	trustedComment := strings.TrimPrefix(lines[2], "trusted comment: ")
+	if !ed25519.Verify(edKey, append(slices.Clip(sig[10:]), trustedComment...), globalSig) {
+		return errors.New("trusted comment signature verification failed")
+	}
+	return nil
+}
+
+// minisignKeyData decodes a base64 minisign key or signature of length size. data may be the base64 line alone or
+// the content of a minisign file with a comment line before it.
+func minisignKeyData(data []byte, size int) ([]byte, error) {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	line := strings.TrimSpace(lines[len(lines)-1])
+	if len(lines) > 1 {
+		line = strings.TrimSpace(lines[1])
+	}
+	decoded, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) != size {
+		return nil, fmt.Errorf("expected %d bytes but got %d", size, len(decoded))
+	}
+	return decoded, nil
+}
+
+// verifyGPG verifies an armored or binary OpenPGP detached signature with an armored or binary public key.
+func verifyGPG(key []byte, data io.Reader, sigData []byte) error {
+	var keyring openpgp.EntityList
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(key), []byte("-----BEGIN")) {
+		keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	} else {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(key))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid gpg public key: %w", err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(sigData), []byte("-----BEGIN")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(keyring, data, bytes.NewReader(sigData), nil)
+	} else {
+		_, err = openpgp.CheckDetachedSignature(keyring, data, bytes.NewReader(sigData), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+	return nil
+}
+
+// resolveSignatureKeyFile makes a relative PublicKeyFile relative to the directory of the config file at filename.
+func resolveSignatureKeyFile(sig *Signature, filename string) {
+	if sig == nil || sig.PublicKeyFile == "" || filepath.IsAbs(sig.PublicKeyFile) || filename == "" ||
+		isHTTPURL(filename) {
+		return
+	}
+	sig.PublicKeyFile = filepath.Join(filepath.Dir(filename), filepath.FromSlash(sig.PublicKeyFile))
+}
+
+// rebaseSignatureKeyFiles rewrites the relative PublicKeyFile values in o and its overrides, which are relative to the
+// config file at from, to be relative to the config file at to. It is used when a template is copied between files.
+func rebaseSignatureKeyFiles(o *Overrideable, from, to string) {
+	if isHTTPURL(from) {
+		return
+	}
+	sig := o.Signature
+	if sig != nil && sig.PublicKeyFile != "" && !filepath.IsAbs(sig.PublicKeyFile) {
+		resolveSignatureKeyFile(sig, from)
+		if to != "" && !isHTTPURL(to) {
+			rel, err := filepath.Rel(filepath.Dir(to), sig.PublicKeyFile)
+			if err == nil {
+				sig.PublicKeyFile = filepath.ToSlash(rel)
+			}
+		}
+	}
+	for i := range o.Overrides {
+		rebaseSignatureKeyFiles(&o.Overrides[i].Dependency, from, to)
+	}
+}
@@ -0,0 +1,285 @@
+package bindown
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+// testSigner creates signatures of a type with a key generated for the test.
+type testSigner struct {
+	publicKey string
+	sign      func(data []byte) []byte
+}
+
+func newCosignSigner(t *testing.T) *testSigner {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	return &testSigner{
+		publicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		sign: func(data []byte) []byte {
+			digest := sha256.Sum256(data)
+			sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+			require.NoError(t, err)
+			return []byte(base64.StdEncoding.EncodeToString(sig))
+		},
+	}
+}
+
+func newMinisignSigner(t *testing.T, prehashed bool) *testSigner {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyID := []byte("12345678")
+	pubData := append(append([]byte("Ed"), keyID...), pub...)
+	return &testSigner{
+		publicKey: "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(pubData) + "\n",
+		sign: func(data []byte) []byte {
+			alg := "Ed"
+			if prehashed {
+				alg = "ED"
+				digest := blake2b.Sum512(data)
+				data = digest[:]
+			}
+			sig := ed25519.Sign(priv, data)
+			sigData := append(append([]byte(alg), keyID...), sig...)
+			trustedComment := "timestamp:1700000000\tfile:foo.tar.gz"
+			globalSig := ed25519.Sign(priv, append(sig, trustedComment...))
+			return []byte(fmt.Sprintf("untrusted comment: signature\n%s\ntrusted comment: %s\n%s\n",
+				base64.StdEncoding.EncodeToString(sigData), trustedComment, base64.StdEncoding.EncodeToString(globalSig)))
+		},
+	}
+}
+
+func newGPGSigner(t *testing.T) *testSigner {
+	t.Helper()
+	cfg := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", cfg)
+	require.NoError(t, err)
+	var pub bytes.Buffer
+	w, err := armor.Encode(&pub, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+	return &testSigner{
+		publicKey: pub.String(),
+		sign: func(data []byte) []byte {
+			var sig bytes.Buffer
+			require.NoError(t, openpgp.ArmoredDetachSign(&sig, entity, bytes.NewReader(data), cfg))
+			return sig.Bytes()
+		},
+	}
+}
+
+func Test_verifySignature(t *testing.T) {
+	data := []byte("hello world")
+	for _, td := range []struct {
+		name      string
+		sigType   string
+		newSigner func(t *testing.T) *testSigner
+	}{
+		{name: "cosign", sigType: SignatureCosign, newSigner: newCosignSigner},
+		{name: "minisign", sigType: SignatureMinisign, newSigner: func(t *testing.T) *testSigner {
+			return newMinisignSigner(t, false)
+		}},
+		{name: "minisign prehashed", sigType: SignatureMinisign, newSigner: func(t *testing.T) *testSigner {
+			return newMinisignSigner(t, true)
+		}},
+		{name: "gpg", sigType: SignatureGPG, newSigner: newGPGSigner},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			signer := td.newSigner(t)
+			sig := &Signature{URL: "https://example.com/sig", Type: td.sigType, PublicKey: signer.publicKey}
+			require.NoError(t, verifySignature(sig, data, signer.sign(data)))
+
+			err := verifySignature(sig, []byte("goodbye world"), signer.sign(data))
+			require.ErrorContains(t, err, "signature verification failed")
+
+			other := td.newSigner(t)
+			err = verifySignature(sig, data, other.sign(data))
+			require.Error(t, err)
+
+			keyFile := filepath.Join(t.TempDir(), "key.pub")
+			writeTestFile(t, keyFile, signer.publicKey)
+			sig = &Signature{URL: "https://example.com/sig", Type: td.sigType, PublicKeyFile: keyFile}
+			require.NoError(t, verifySignature(sig, data, signer.sign(data)))
+		})
+	}
+
+	t.Run("invalid settings", func(t *testing.T) {
+		sig := &Signature{URL: "https://example.com/sig", Type: "x509", PublicKey: "key"}
+		err := verifySignature(sig, data, nil)
+		require.EqualError(t, err, `unknown signature type "x509". must be one of cosign, minisign, gpg`)
+		sig = &Signature{URL: "https://example.com/sig", Type: SignatureCosign}
+		err = verifySignature(sig, data, nil)
+		require.EqualError(t, err, "signature must have exactly one of public_key or public_key_file")
+	})
+}
+
+func TestConfig_InstallDependencies_signature(t *testing.T) {
+	ctx := context.Background()
+	foo, err := os.ReadFile(filepath.Join("testdata", "downloadables", "foo.tar.gz"))
+	require.NoError(t, err)
+	signer := newCosignSigner(t)
+	manifest := []byte(fooChecksum + "  foo.tar.gz\n")
+	files := map[string][]byte{
+		"/foo.tar.gz":         foo,
+		"/foo.tar.gz.sig":     signer.sign(foo),
+		"/checksums.txt":      manifest,
+		"/checksums.txt.sig":  signer.sign(manifest),
+		"/bad/foo.tar.gz":     foo,
+		"/bad/foo.tar.gz.sig": signer.sign([]byte("something else")),
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		content, ok := files[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	t.Cleanup(ts.Close)
+
+	keyFile := filepath.Join("keys", "cosign.pub")
+	newConfig := func(t *testing.T, depYAML string) *Config {
+		t.Helper()
+		dir := t.TempDir()
+		writeTestFile(t, filepath.Join(dir, keyFile), signer.publicKey)
+		cfgFile := filepath.Join(dir, "bindown.yaml")
+		writeTestFile(t, cfgFile, fmt.Sprintf(`
+install_dir: %q
+cache: %q
+url_checksums:
+  %s/foo.tar.gz: %s
+  %s/bad/foo.tar.gz: %s
+dependencies:
+  foo:
+%s`, filepath.Join(dir, "bin"), filepath.Join(dir, "cache"), ts.URL, fooChecksum, ts.URL, fooChecksum, depYAML))
+		cfg, err := NewConfig(ctx, cfgFile, false)
+		require.NoError(t, err)
+		return cfg
+	}
+	install := func(t *testing.T, depYAML string) error {
+		t.Helper()
+		cfg := newConfig(t, depYAML)
+		return cfg.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{})
+	}
+
+	t.Run("file", func(t *testing.T) {
+		err := install(t, fmt.Sprintf(`
+    url: %s/foo.tar.gz
+    archive_path: bin/foo.txt
+    signature:
+      url: "{{.url}}.sig"
+      type: cosign
+      public_key_file: %s
+    vars:
+      url: %s/foo.tar.gz
+`, ts.URL, filepath.ToSlash(keyFile), ts.URL))
+		require.NoError(t, err)
+	})
+
+	t.Run("checksums", func(t *testing.T) {
+		err := install(t, fmt.Sprintf(`
+    url: %s/foo.tar.gz
+    archive_path: bin/foo.txt
+    checksums_url: %s/checksums.txt
+    checksums_algorithm: sha256
+    signature:
+      url: %s/checksums.txt.sig
+      type: cosign
+      target: checksums
+      public_key: %q
+`, ts.URL, ts.URL, ts.URL, signer.publicKey))
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		cfg := newConfig(t, fmt.Sprintf(`
+    url: %s/bad/foo.tar.gz
+    archive_path: bin/foo.txt
+    signature:
+      url: %s/bad/foo.tar.gz.sig
+      type: cosign
+      public_key_file: %s
+`, ts.URL, ts.URL, filepath.ToSlash(keyFile)))
+		// the second install must not use the download that failed verification
+		for i := 0; i < 2; i++ {
+			err := cfg.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{})
+			require.ErrorContains(t, err, fmt.Sprintf("invalid signature for %s/bad/foo.tar.gz: signature verification failed", ts.URL))
+		}
+		require.NoFileExists(t, filepath.Join(cfg.InstallDir, "foo"))
+	})
+
+	t.Run("missing signature", func(t *testing.T) {
+		err := install(t, fmt.Sprintf(`
+    url: %s/foo.tar.gz
+    archive_path: bin/foo.txt
+    signature:
+      url: %s/missing.sig
+      type: cosign
+      public_key_file: %s
+`, ts.URL, ts.URL, filepath.ToSlash(keyFile)))
+		require.ErrorContains(t, err, fmt.Sprintf("failed downloading signature %s/missing.sig", ts.URL))
+	})
+
+	t.Run("public_key_file in an import", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestFile(t, filepath.Join(dir, "shared", "cosign.pub"), signer.publicKey)
+		writeTestFile(t, filepath.Join(dir, "shared", "shared.yaml"), fmt.Sprintf(`
+templates:
+  signed:
+    url: %s/foo.tar.gz
+    archive_path: bin/foo.txt
+    signature:
+      url: %s/foo.tar.gz.sig
+      type: cosign
+      public_key_file: cosign.pub
+dependencies:
+  bar:
+    template: signed
+`, ts.URL, ts.URL))
+		cfgFile := filepath.Join(dir, "bindown.yaml")
+		writeTestFile(t, cfgFile, fmt.Sprintf(`
+install_dir: %q
+cache: %q
+imports: [shared/shared.yaml]
+url_checksums:
+  %s/foo.tar.gz: %s
+dependencies:
+  foo:
+    template: signed
+`, filepath.Join(dir, "bin"), filepath.Join(dir, "cache"), ts.URL, fooChecksum))
+		cfg, err := NewConfig(ctx, cfgFile, false)
+		require.NoError(t, err)
+		for _, depName := range []string{"foo", "bar"} {
+			dep, err := cfg.BuildDependency(depName, "darwin/amd64")
+			require.NoError(t, err)
+			require.Equal(t, filepath.Join(dir, "shared", "cosign.pub"), dep.Signature.PublicKeyFile)
+		}
+		err = cfg.InstallDependencies(ctx, []string{"foo"}, "darwin/amd64", &ConfigInstallDependenciesOpts{})
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,190 @@
+package bindown
+
+import (
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Sources returns the file each value in the config came from. Keys are JSON pointers (RFC 6901) to values in the
+// config. Values are file names or URLs. Values from the root config are attributed to c.Filename.
+//
+// Entries from imports are attributed as a whole. When a dependency or template has been merged with an overlay,
+// each of its fields is attributed separately, and vars and substitutions are attributed by key.
+func (c *Config) Sources() map[string]string {
+	sources := map[string]string{}
+	rootFile := c.Filename
+	overlay := c.overlay
+	if overlay == nil {
+		overlay = &Config{}
+	}
+	ownerOrRoot := func(section, name string) string {
+		owner := c.owner(section, name)
+		if owner == "" {
+			return rootFile
+		}
+		return owner
+	}
+	if c.Cache != "" {
+		sources["/cache"] = rootFile
+		if overlay.Cache != "" {
+			sources["/cache"] = overlay.Filename
+		}
+	}
+	if c.SealCache != nil {
+		sources["/seal_cache"] = rootFile
+		if overlay.SealCache != nil {
+			sources["/seal_cache"] = overlay.Filename
+		}
+	}
+	if c.InstallDir != "" {
+		sources["/install_dir"] = rootFile
+		if overlay.InstallDir != "" {
+			sources["/install_dir"] = overlay.Filename
+		}
+	}
+	if len(c.Imports) > 0 {
+		sources["/imports"] = rootFile
+	}
+	for i, system := range c.Systems {
+		sources[jsonPointer(sectionSystems, strconv.Itoa(i))] = ownerOrRoot(sectionSystems, string(system))
+	}
+	depSources := func(section string, deps, overlayDeps map[string]*Dependency) {
+		for name, dep := range deps {
+			owner := ownerOrRoot(section, name)
+			o := overlayDeps[name]
+			if o == nil || owner == overlay.Filename {
+				sources[jsonPointer(section, name)] = owner
+				continue
+			}
+			dependencySources(sources, jsonPointer(section, name), dep, o, owner, overlay.Filename)
+		}
+	}
+	depSources(sectionDependencies, c.Dependencies, overlay.Dependencies)
+	depSources(sectionTemplates, c.Templates, overlay.Templates)
+	for name := range c.TemplateSources {
+		sources[jsonPointer(sectionTemplateSources, name)] = ownerOrRoot(sectionTemplateSources, name)
+		if _, ok := overlay.TemplateSources[name]; ok {
+			sources[jsonPointer(sectionTemplateSources, name)] = overlay.Filename
+		}
+	}
+	for u := range c.URLChecksums {
+		sources[jsonPointer(sectionURLChecksums, u)] = ownerOrRoot(sectionURLChecksums, u)
+		if _, ok := overlay.URLChecksums[u]; ok {
+			sources[jsonPointer(sectionURLChecksums, u)] = overlay.Filename
+		}
+	}
+	return sources
+}
+
+// dependencySources adds sources for the fields of dep, which is the result of merging overlay o over a dependency
+// from owner.
+func dependencySources(sources map[string]string, ptr string, dep, o *Dependency, owner, overlayFile string) {
+	source := func(fromOverlay bool) string {
+		if fromOverlay {
+			return overlayFile
+		}
+		return owner
+	}
+	fields := []struct {
+		name        string
+		set         bool
+		fromOverlay bool
+	}{
+		{"homepage", dep.Homepage != nil, o.Homepage != nil},
+		{"description", dep.Description != nil, o.Description != nil},
+		{"template", dep.Template != nil, o.Template != nil},
+		{"url", dep.URL != nil, o.URL != nil},
+		{"archive_path", dep.ArchivePath != nil, o.ArchivePath != nil},
+		{"bin", dep.BinName != nil, o.BinName != nil},
+		{"link", dep.Link != nil, o.Link != nil},
+		{"checksums_url", dep.ChecksumsURL != nil, o.ChecksumsURL != nil},
+		{"checksums_algorithm", dep.ChecksumsAlgorithm != nil, o.ChecksumsAlgorithm != nil},
+		{"signature", dep.Signature != nil, o.Signature != nil},
+		{"systems", len(dep.Systems) > 0, len(o.Systems) > 0},
+	}
+	for _, f := range fields {
+		if f.set {
+			sources[ptr+"/"+f.name] = source(f.fromOverlay)
+		}
+	}
+	for k := range dep.Vars {
+		_, ok := o.Vars[k]
+		sources[ptr+"/vars/"+escapeJSONPointer(k)] = source(ok)
+	}
+	for k, subs := range dep.Substitutions {
+		for from := range subs {
+			_, ok := o.Substitutions[k][from]
+			sources[ptr+"/substitutions/"+escapeJSONPointer(k)+"/"+escapeJSONPointer(from)] = source(ok)
+		}
+	}
+	baseOverrides := len(dep.Overrides) - len(o.Overrides)
+	for i := range dep.Overrides {
+		sources[ptr+"/overrides/"+strconv.Itoa(i)] = source(i >= baseOverrides)
+	}
+	for i, v := range dep.RequiredVars {
+		sources[ptr+"/required_vars/"+strconv.Itoa(i)] = source(slices.Contains(o.RequiredVars, v))
+	}
+}
+
+func jsonPointer(tokens ...string) string {
+	var sb strings.Builder
+	for _, token := range tokens {
+		sb.WriteString("/")
+		sb.WriteString(escapeJSONPointer(token))
+	}
+	return sb.String()
+}
+
+func escapeJSONPointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+func unescapeJSONPointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
+
+// EncodeEffectiveYaml writes the config as yaml with comments showing the file each value came from.
+func (c *Config) EncodeEffectiveYaml(w io.Writer) error {
+	var node yaml.Node
+	err := node.Encode(c)
+	if err != nil {
+		return err
+	}
+	annotateSources(&node, "", c.Sources())
+	return EncodeYaml(w, &node)
+}
+
+func annotateSources(node *yaml.Node, ptr string, sources map[string]string) {
+	annotate := func(key, val *yaml.Node, ptr string) {
+		src, ok := sources[ptr]
+		if !ok {
+			annotateSources(val, ptr, sources)
+			return
+		}
+		comment := "from " + src
+		if val.Kind == yaml.ScalarNode {
+			val.LineComment = comment
+			return
+		}
+		if key != nil {
+			key.LineComment = comment
+			return
+		}
+		val.HeadComment = comment
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, val := node.Content[i], node.Content[i+1]
+			annotate(key, val, ptr+"/"+escapeJSONPointer(key.Value))
+		}
+	case yaml.SequenceNode:
+		for i, val := range node.Content {
+			annotate(nil, val, ptr+"/"+strconv.Itoa(i))
+		}
+	}
+}
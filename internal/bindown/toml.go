@@ -0,0 +1,96 @@
+package bindown
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// isTOMLFile returns true when filename is a file or URL with a .toml extension.
+func isTOMLFile(filename string) bool {
+	if isHTTPURL(filename) {
+		u, err := url.Parse(filename)
+		if err == nil {
+			return strings.EqualFold(path.Ext(u.Path), ".toml")
+		}
+	}
+	return strings.EqualFold(filepath.Ext(filename), ".toml")
+}
+
+// configPosition is yamlPosition for the content of a config file. TOML files don't have positions.
+func configPosition(filename string, data []byte, ptr string) (line, col int) {
+	if isTOMLFile(filename) {
+		return 0, 0
+	}
+	return yamlPosition(data, ptr)
+}
+
+// tomlToJSON converts TOML config content to JSON, so it can be validated and decoded the same way as yaml and json.
+// filename is only used in errors.
+func tomlToJSON(filename string, data []byte) ([]byte, error) {
+	var val map[string]any
+	err := toml.Unmarshal(data, &val)
+	if err != nil {
+		cfgErr := &ConfigError{File: filename, Err: err}
+		var decodeErr *toml.DecodeError
+		if errors.As(err, &decodeErr) {
+			cfgErr.Line, cfgErr.Column = decodeErr.Position()
+			cfgErr.Err = errors.New("config is not valid toml: " + decodeErr.Error())
+		}
+		return nil, cfgErr
+	}
+	if val == nil {
+		val = map[string]any{}
+	}
+	return json.Marshal(val)
+}
+
+// encodeTOML returns c encoded as TOML.
+func encodeTOML(c *Config) ([]byte, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var val map[string]any
+	err = decoder.Decode(&val)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := toml.NewEncoder(&buf)
+	err = encoder.Encode(tomlValue(val))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tomlValue converts the json.Number values in a value decoded from json to int64 or float64 for the TOML encoder.
+func tomlValue(val any) any {
+	switch v := val.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = tomlValue(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = tomlValue(item)
+		}
+	case json.Number:
+		i, err := v.Int64()
+		if err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return val
+}
@@ -0,0 +1,100 @@
+package bindown
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_toml(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("load and write", func(t *testing.T) {
+		cfgFile := filepath.Join(t.TempDir(), "bindown.toml")
+		writeTestFile(t, cfgFile, `
+version = 1
+systems = ["linux/amd64", "darwin/arm64"]
+
+[dependencies.foo]
+url = "https://example.com/foo-{{.version}}-{{.os}}"
+
+[dependencies.foo.vars]
+version = "1.2.3"
+
+[[dependencies.foo.overrides]]
+matcher = { os = ["darwin"] }
+dependency = { url = "https://example.com/foo-{{.version}}-macos" }
+`)
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.Equal(t, 1, cfg.Version)
+		dep, err := cfg.BuildDependency("foo", "darwin/arm64")
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com/foo-1.2.3-macos", dep.url)
+
+		cfg.URLChecksums = map[string]string{dep.url: "deadbeef"}
+		require.NoError(t, cfg.WriteFile(false))
+		requireFileContent(t, cfgFile, `systems = ['darwin/arm64', 'linux/amd64']
+version = 1
+
+[dependencies]
+[dependencies.foo]
+url = 'https://example.com/foo-{{.version}}-{{.os}}'
+
+[[dependencies.foo.overrides]]
+[dependencies.foo.overrides.dependency]
+url = 'https://example.com/foo-{{.version}}-macos'
+
+[dependencies.foo.overrides.matcher]
+os = ['darwin']
+
+[dependencies.foo.vars]
+version = '1.2.3'
+
+[url_checksums]
+'https://example.com/foo-1.2.3-macos' = 'deadbeef'
+`)
+		got, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.Equal(t, cfg.Dependencies, got.Dependencies)
+		require.Equal(t, cfg.URLChecksums, got.URLChecksums)
+	})
+
+	t.Run("invalid toml", func(t *testing.T) {
+		cfgFile := filepath.Join(t.TempDir(), "bindown.toml")
+		writeTestFile(t, cfgFile, "systems = [\"linux/amd64\"\ncache = 1\n")
+		_, err := NewConfig(ctx, cfgFile, true)
+		require.ErrorContains(t, err, cfgFile+":2:1: config is not valid toml: ")
+	})
+
+	t.Run("schema error", func(t *testing.T) {
+		cfgFile := filepath.Join(t.TempDir(), "bindown.toml")
+		writeTestFile(t, cfgFile, "cache = 1\n")
+		_, err := NewConfig(ctx, cfgFile, true)
+		require.EqualError(t, err, cfgFile+": invalid config: /cache: expected string, but got number")
+	})
+
+	t.Run("newer version", func(t *testing.T) {
+		cfgFile := filepath.Join(t.TempDir(), "bindown.toml")
+		writeTestFile(t, cfgFile, "version = 99\n")
+		_, err := NewConfig(ctx, cfgFile, true)
+		require.ErrorContains(t, err, cfgFile+": config version 99 is newer")
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		cfgFile := filepath.Join(t.TempDir(), "bindown.toml")
+		writeTestFile(t, cfgFile, "")
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.NoError(t, cfg.WriteFile(false))
+		requireFileContent(t, cfgFile, "")
+	})
+}
+
+func Test_isTOMLFile(t *testing.T) {
+	require.True(t, isTOMLFile(filepath.Join("foo", "bindown.toml")))
+	require.True(t, isTOMLFile("https://example.com/bindown.toml?ref=main"))
+	require.False(t, isTOMLFile("bindown.yml"))
+}
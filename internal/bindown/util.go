@@ -2,7 +2,6 @@ package bindown
 
 import (
 	"bytes"
-	"crypto/sha256"
 	_ "embed"
 	"encoding/hex"
 	"fmt"
@@ -104,17 +103,6 @@ func mustWriteToHash(hasher hash.Hash, data []byte) {
 	}
 }
 
-// fileChecksum returns the hex checksum of a file
-func fileChecksum(filename string) (string, error) {
-	fileBytes, err := os.ReadFile(filename)
-	if err != nil {
-		return "", err
-	}
-	hasher := sha256.New()
-	mustWriteToHash(hasher, fileBytes)
-	return hex.EncodeToString(hasher.Sum(nil)), nil
-}
-
 // FileExists asserts that a file exist or symlink exists.
 // Returns false for symlinks pointing to non-existent files.
 func FileExists(path string) bool {
@@ -131,18 +119,6 @@ func dirExists(path string) bool {
 	return info.IsDir()
 }
 
-// fileExistsWithChecksum returns true if the file both exists and has a matching checksum
-func fileExistsWithChecksum(filename, checksum string) (bool, error) {
-	if !FileExists(filename) {
-		return false, nil
-	}
-	got, err := fileChecksum(filename)
-	if err != nil {
-		return false, err
-	}
-	return checksum == got, nil
-}
-
 // copyFile copies file from src to dst
 // modeTrans is a function for setting the destination FileMode. It accepts the source FileMode. If nil, the unmodified
 // source FileMode is used.
@@ -0,0 +1,149 @@
+package bindown
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/willabides/bindown/v4/internal/httpclient"
+)
+
+// ChecksumStatus is the result of verifying a url checksum.
+type ChecksumStatus string
+
+// Checksum statuses
+const (
+	// ChecksumOK means the file at the url matches its checksum.
+	ChecksumOK ChecksumStatus = "ok"
+	// ChecksumMismatch means the file at the url doesn't match its checksum.
+	ChecksumMismatch ChecksumStatus = "mismatch"
+	// ChecksumUnavailable means the url couldn't be downloaded.
+	ChecksumUnavailable ChecksumStatus = "unavailable"
+	// ChecksumMissing means a dependency uses the url but it has no checksum.
+	ChecksumMissing ChecksumStatus = "missing"
+	// ChecksumUnused means the url has a checksum but no dependency uses it.
+	ChecksumUnused ChecksumStatus = "unused"
+)
+
+// ChecksumVerification is the result of verifying the checksum for one url.
+type ChecksumVerification struct {
+	URL    string         `json:"url"`
+	Status ChecksumStatus `json:"status"`
+	// Dependencies and Systems are the dependencies and systems that use URL.
+	Dependencies []string `json:"dependencies,omitempty"`
+	Systems      []System `json:"systems,omitempty"`
+	// Want is the configured checksum.
+	Want string `json:"want,omitempty"`
+	// Got is the checksum of the file at URL when it was downloaded.
+	Got string `json:"got,omitempty"`
+	// Error is why the url couldn't be downloaded.
+	Error string `json:"error,omitempty"`
+}
+
+// VerifyChecksums downloads the file at every url used by dependencies on systems and compares it to the configured
+// checksum. It doesn't change the config. When dependencies and systems are both empty, checksums that aren't used
+// by any dependency are reported as unused. Results are sorted by url.
+func (c *Config) VerifyChecksums(ctx context.Context, dependencies []string, systems []System) ([]ChecksumVerification, error) {
+	ctx = c.httpContext(ctx)
+	checkUnused := len(dependencies) == 0 && len(systems) == 0
+	if len(dependencies) == 0 {
+		dependencies = c.DependencyNames()
+	}
+	byURL := map[string]*ChecksumVerification{}
+	for _, depName := range dependencies {
+		if c.Dependencies[depName] == nil {
+			return nil, fmt.Errorf("no dependency configured with the name %q", depName)
+		}
+		depSystems := systems
+		if len(depSystems) == 0 {
+			var err error
+			depSystems, err = c.DependencySystems(depName)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, system := range depSystems {
+			dep, err := c.BuildDependency(depName, system)
+			if err != nil {
+				return nil, err
+			}
+			result := byURL[dep.url]
+			if result == nil {
+				result = &ChecksumVerification{URL: dep.url, Want: dep.checksum}
+				byURL[dep.url] = result
+			}
+			if !slices.Contains(result.Dependencies, depName) {
+				result.Dependencies = append(result.Dependencies, depName)
+			}
+			if !slices.Contains(result.Systems, system) {
+				result.Systems = append(result.Systems, system)
+			}
+		}
+	}
+	if checkUnused {
+		for u, checksum := range c.URLChecksums {
+			if byURL[u] == nil {
+				byURL[u] = &ChecksumVerification{URL: u, Status: ChecksumUnused, Want: checksum}
+			}
+		}
+	}
+	results := make([]ChecksumVerification, 0, len(byURL))
+	for _, u := range sortedKeys(byURL) {
+		result := byURL[u]
+		slices.Sort(result.Dependencies)
+		slices.Sort(result.Systems)
+		if result.Status == "" {
+			verifyURLChecksum(ctx, result)
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
+
+// verifyURLChecksum downloads result.URL and sets result's status. It doesn't use mirrors because a stale mirror
+// would hide a changed upstream file.
+func verifyURLChecksum(ctx context.Context, result *ChecksumVerification) {
+	if result.Want == "" {
+		result.Status = ChecksumMissing
+		return
+	}
+	algorithm, err := checksumAlgorithm(result.Want)
+	if err != nil {
+		result.Status = ChecksumMismatch
+		result.Error = err.Error()
+		return
+	}
+	sums, err := streamURLChecksums(ctx, result.URL, algorithm)
+	if err != nil {
+		result.Status = ChecksumUnavailable
+		result.Error = err.Error()
+		return
+	}
+	result.Got = sums.checksum(algorithm)
+	result.Status = ChecksumOK
+	if !checksumsEqual(result.Want, result.Got) {
+		result.Status = ChecksumMismatch
+	}
+}
+
+// streamURLChecksums returns the checksums of the file at dlURL for algorithms without saving the file.
+func streamURLChecksums(ctx context.Context, dlURL string, algorithms ...string) (_ *multiHasher, errOut error) {
+	hasher, err := newMultiHasher(algorithms...)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpclient.FromContext(ctx).Get(ctx, dlURL)
+	if err != nil {
+		return nil, err
+	}
+	defer deferErr(&errOut, resp.Body.Close)
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("failed downloading %s: %s", dlURL, resp.Status)
+	}
+	_, err = io.Copy(hasher, resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return hasher, nil
+}
@@ -0,0 +1,89 @@
+package bindown
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/willabides/bindown/v4/internal/testutil"
+)
+
+func TestConfig_VerifyChecksums(t *testing.T) {
+	ctx := context.Background()
+	ts := testutil.ServeFiles(t, map[string]string{
+		"/foo/foo.tar.gz": filepath.Join("testdata", "downloadables", "foo.tar.gz"),
+	})
+	fooURL := ts.URL + "/foo/foo.tar.gz"
+	missingURL := ts.URL + "/missing.tar.gz"
+	badSum := "0000000000000000000000000000000000000000000000000000000000000000"
+	cfg := mustConfigFromYAML(t, fmt.Sprintf(`
+systems: [darwin/amd64, linux/amd64]
+dependencies:
+  foo:
+    url: %[1]s
+  bar:
+    url: %[1]s
+    overrides:
+      - matcher: {os: [linux]}
+        dependency: {url: "%[2]s"}
+  baz:
+    url: %[1]s?v={{.os}}
+url_checksums:
+  %[1]s: %[3]q
+  %[2]s: %[4]q
+  %[1]s?v=darwin: %[4]q
+  https://example.com/unused.tar.gz: %[4]q
+`, fooURL, missingURL, fooSHA512Checksum, badSum))
+
+	got, err := cfg.VerifyChecksums(ctx, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []ChecksumVerification{
+		{
+			URL:          fooURL,
+			Status:       ChecksumOK,
+			Dependencies: []string{"bar", "foo"},
+			Systems:      []System{"darwin/amd64", "linux/amd64"},
+			Want:         fooSHA512Checksum,
+			Got:          fooSHA512Checksum,
+		},
+		{
+			URL:          fooURL + "?v=darwin",
+			Status:       ChecksumMismatch,
+			Dependencies: []string{"baz"},
+			Systems:      []System{"darwin/amd64"},
+			Want:         badSum,
+			Got:          fooChecksum,
+		},
+		{
+			URL:          fooURL + "?v=linux",
+			Status:       ChecksumMissing,
+			Dependencies: []string{"baz"},
+			Systems:      []System{"linux/amd64"},
+		},
+		{
+			URL:          missingURL,
+			Status:       ChecksumUnavailable,
+			Dependencies: []string{"bar"},
+			Systems:      []System{"linux/amd64"},
+			Want:         badSum,
+			Error:        fmt.Sprintf("failed downloading %s: 404 Not Found", missingURL),
+		},
+		{
+			URL:    "https://example.com/unused.tar.gz",
+			Status: ChecksumUnused,
+			Want:   badSum,
+		},
+	}, got)
+
+	t.Run("filtered", func(t *testing.T) {
+		got, err := cfg.VerifyChecksums(ctx, []string{"foo"}, nil)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		require.Equal(t, ChecksumOK, got[0].Status)
+
+		_, err = cfg.VerifyChecksums(ctx, []string{"nope"}, nil)
+		require.EqualError(t, err, `no dependency configured with the name "nope"`)
+	})
+}
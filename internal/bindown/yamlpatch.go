@@ -0,0 +1,561 @@
+package bindown
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// patchYaml returns src updated to hold the content of v. Only the parts of src that have different values in v
+// are rewritten, so comments, blank lines, key order and formatting are preserved everywhere else.
+//
+// Returns false when src can't be patched. This happens when src is empty, isn't a block-style yaml mapping (like
+// a json file), or when the patched document wouldn't decode to the same value as v.
+func patchYaml(src []byte, v any) ([]byte, bool) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(src, &doc)
+	if err != nil || doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 {
+		return nil, false
+	}
+	var want yaml.Node
+	err = want.Encode(v)
+	if err != nil {
+		return nil, false
+	}
+	if want.Kind == yaml.DocumentNode {
+		want = *want.Content[0]
+	}
+	p := &yamlPatcher{
+		lines: strings.SplitAfter(string(src), "\n"),
+	}
+	if !p.patchMapping(doc.Content[0], &want) {
+		return nil, false
+	}
+	out := p.apply()
+
+	// make sure the patched document decodes to the same value as v
+	got := reflect.New(reflect.TypeOf(v))
+	err = yaml.Unmarshal(out, got.Interface())
+	if err != nil {
+		return nil, false
+	}
+	var gotNode yaml.Node
+	err = gotNode.Encode(got.Elem().Interface())
+	if err != nil {
+		return nil, false
+	}
+	if gotNode.Kind == yaml.DocumentNode {
+		gotNode = *gotNode.Content[0]
+	}
+	if !yamlNodesEqual(&gotNode, &want) {
+		return nil, false
+	}
+	return out, true
+}
+
+// encodeYamlWithComments returns v encoded as yaml with the comments from src copied to the matching nodes. It is for
+// when src can't be patched, so at least its comments are kept. Mapping entries are matched by key and sequence items
+// by position or, when the length changed, by value. Returns false when src has no comments to keep.
+func encodeYamlWithComments(src []byte, v any) ([]byte, bool) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(src, &doc)
+	if err != nil || doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || !yamlHasComments(&doc) {
+		return nil, false
+	}
+	var root yaml.Node
+	err = root.Encode(v)
+	if err != nil {
+		return nil, false
+	}
+	want := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&root}}
+	copyYamlComments(&doc, want)
+	var buf bytes.Buffer
+	err = EncodeYaml(&buf, want)
+	if err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// yamlHasComments returns true when node or any node in it has a comment.
+func yamlHasComments(node *yaml.Node) bool {
+	if node.HeadComment != "" || node.LineComment != "" || node.FootComment != "" {
+		return true
+	}
+	return slices.ContainsFunc(node.Content, yamlHasComments)
+}
+
+// copyYamlComments copies the comments from orig and its children to the matching nodes in want.
+func copyYamlComments(orig, want *yaml.Node) {
+	want.HeadComment = orig.HeadComment
+	want.LineComment = orig.LineComment
+	want.FootComment = orig.FootComment
+	if orig.Kind != want.Kind {
+		return
+	}
+	switch orig.Kind {
+	case yaml.DocumentNode:
+		if len(orig.Content) == 1 && len(want.Content) == 1 {
+			copyYamlComments(orig.Content[0], want.Content[0])
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(orig.Content); i += 2 {
+			for j := 0; j+1 < len(want.Content); j += 2 {
+				if orig.Content[i].Value != want.Content[j].Value {
+					continue
+				}
+				key, val := want.Content[j], want.Content[j+1]
+				copyYamlComments(orig.Content[i], key)
+				copyYamlComments(orig.Content[i+1], val)
+				if val.Kind != yaml.ScalarNode && key.LineComment == "" {
+					// a block collection's line comment goes after its key
+					key.LineComment, val.LineComment = val.LineComment, ""
+				}
+				break
+			}
+		}
+	case yaml.SequenceNode:
+		if len(orig.Content) == len(want.Content) {
+			for i := range orig.Content {
+				copyYamlComments(orig.Content[i], want.Content[i])
+			}
+			return
+		}
+		for _, m := range lcsNodes(orig.Content, want.Content) {
+			copyYamlComments(orig.Content[m[0]], want.Content[m[1]])
+		}
+	}
+}
+
+// yamlPatcher collects line-based edits to a yaml document.
+type yamlPatcher struct {
+	lines []string
+	edits []lineEdit
+}
+
+// lineEdit replaces lines [start, end) with text. Lines are 0-indexed. start == end for insertions.
+type lineEdit struct {
+	start, end int
+	text       string
+}
+
+func (p *yamlPatcher) apply() []byte {
+	var buf bytes.Buffer
+	cursor := 0
+	// edits are added in document order, so they can be applied in a single pass
+	for _, edit := range p.edits {
+		for ; cursor < edit.start; cursor++ {
+			buf.WriteString(p.lines[cursor])
+		}
+		buf.WriteString(edit.text)
+		if edit.end > cursor {
+			cursor = edit.end
+		}
+	}
+	for ; cursor < len(p.lines); cursor++ {
+		buf.WriteString(p.lines[cursor])
+	}
+	return buf.Bytes()
+}
+
+// patchMapping adds edits that change the block mapping orig to have the content of want. Returns false without
+// adding any edits if orig can't be patched in place.
+func (p *yamlPatcher) patchMapping(orig, want *yaml.Node) bool {
+	if orig.Kind != yaml.MappingNode || want.Kind != yaml.MappingNode || orig.Style&yaml.FlowStyle != 0 ||
+		len(orig.Content) == 0 || len(want.Content) == 0 {
+		return false
+	}
+	editCount := len(p.edits)
+	ok := p.patchMappingEntries(orig, want)
+	if !ok {
+		p.edits = p.edits[:editCount]
+	}
+	return ok
+}
+
+func (p *yamlPatcher) patchMappingEntries(orig, want *yaml.Node) bool {
+	origIdx := map[string]int{}
+	for i := 0; i+1 < len(orig.Content); i += 2 {
+		origIdx[orig.Content[i].Value] = i
+	}
+	wantIdx := map[string]int{}
+	for i := 0; i+1 < len(want.Content); i += 2 {
+		wantIdx[want.Content[i].Value] = i
+	}
+	indent := orig.Content[0].Column - 1
+
+	// new entries are inserted after the preceding wanted entry that already exists in orig
+	inserts := map[int][]int{}
+	prev := -1
+	for i := 0; i+1 < len(want.Content); i += 2 {
+		j, ok := origIdx[want.Content[i].Value]
+		if ok {
+			prev = j
+			continue
+		}
+		inserts[prev] = append(inserts[prev], i)
+	}
+	insert := func(line int, wantIdxs []int) {
+		var sb strings.Builder
+		for _, i := range wantIdxs {
+			sb.WriteString(indentYaml(renderMappingEntry(want.Content[i], want.Content[i+1]), strings.Repeat(" ", indent), indent))
+		}
+		p.edits = append(p.edits, lineEdit{start: line, end: line, text: sb.String()})
+	}
+	if len(inserts[-1]) > 0 {
+		start := p.entryStart(orig.Content[0])
+		if !p.blankPrefix(orig.Content[0]) {
+			return false
+		}
+		insert(start, inserts[-1])
+	}
+	for j := 0; j+1 < len(orig.Content); j += 2 {
+		key, val := orig.Content[j], orig.Content[j+1]
+		end := p.nodeEnd(val)
+		i, ok := wantIdx[key.Value]
+		switch {
+		case !ok && emptyYamlNode(val):
+			// empty values are omitted when encoding, so removing them isn't a change
+		case !ok:
+			if !p.blankPrefix(key) {
+				return false
+			}
+			p.edits = append(p.edits, lineEdit{start: p.entryStart(key), end: end})
+		case !p.patchValue(key, val, want.Content[i+1]):
+			wantVal := *want.Content[i+1]
+			wantVal.LineComment = val.LineComment
+			if wantVal.Kind != yaml.ScalarNode {
+				wantVal.LineComment = ""
+			}
+			p.edits = append(p.edits, lineEdit{
+				start: key.Line - 1,
+				end:   end,
+				text:  indentYaml(renderMappingEntry(want.Content[i], &wantVal), p.linePrefix(key), indent),
+			})
+		}
+		if len(inserts[j]) > 0 {
+			insert(end, inserts[j])
+		}
+	}
+	return true
+}
+
+// patchValue adds edits to change orig to want in place. Returns false when the whole value needs to be replaced.
+func (p *yamlPatcher) patchValue(key, orig, want *yaml.Node) bool {
+	if yamlNodesEqual(orig, want) {
+		return true
+	}
+	if key != nil && orig.Kind != yaml.ScalarNode && orig.Line == key.Line {
+		// the value is on the same line as the key, so it is flow style or an alias
+		return false
+	}
+	switch orig.Kind {
+	case yaml.MappingNode:
+		return p.patchMapping(orig, want)
+	case yaml.SequenceNode:
+		return p.patchSequence(orig, want)
+	}
+	return false
+}
+
+// patchSequence adds edits that change the block sequence orig to have the content of want. Returns false without
+// adding any edits if orig can't be patched in place.
+func (p *yamlPatcher) patchSequence(orig, want *yaml.Node) bool {
+	if orig.Kind != yaml.SequenceNode || want.Kind != yaml.SequenceNode || orig.Style&yaml.FlowStyle != 0 ||
+		len(orig.Content) == 0 || len(want.Content) == 0 {
+		return false
+	}
+	dashCol := p.dashColumn(orig.Content[0])
+	if dashCol < 0 {
+		return false
+	}
+	editCount := len(p.edits)
+	replaceItem := func(item, wantItem *yaml.Node) {
+		prefix := p.lines[item.Line-1][:p.dashColumn(item)]
+		p.edits = append(p.edits, lineEdit{
+			start: item.Line - 1,
+			end:   p.nodeEnd(item),
+			text:  indentYaml(renderSequenceItem(wantItem), prefix, dashCol),
+		})
+	}
+
+	if len(orig.Content) == len(want.Content) {
+		for i, item := range orig.Content {
+			if p.dashColumn(item) < 0 {
+				p.edits = p.edits[:editCount]
+				return false
+			}
+			if !p.patchValue(nil, item, want.Content[i]) {
+				replaceItem(item, want.Content[i])
+			}
+		}
+		return true
+	}
+
+	matches := lcsNodes(orig.Content, want.Content)
+	origMatched := map[int]bool{}
+	for _, m := range matches {
+		origMatched[m[0]] = true
+	}
+	insert := func(line int, items []*yaml.Node) {
+		if len(items) == 0 {
+			return
+		}
+		var sb strings.Builder
+		for _, item := range items {
+			sb.WriteString(indentYaml(renderSequenceItem(item), strings.Repeat(" ", dashCol), dashCol))
+		}
+		p.edits = append(p.edits, lineEdit{start: line, end: line, text: sb.String()})
+	}
+	wantPos := 0
+	firstStart := p.entryStart(orig.Content[0])
+	if len(matches) > 0 {
+		insert(firstStart, want.Content[:matches[0][1]])
+		wantPos = matches[0][1]
+	} else {
+		insert(firstStart, want.Content)
+		wantPos = len(want.Content)
+	}
+	for i, item := range orig.Content {
+		if p.dashColumn(item) < 0 {
+			p.edits = p.edits[:editCount]
+			return false
+		}
+		end := p.nodeEnd(item)
+		if !origMatched[i] {
+			p.edits = append(p.edits, lineEdit{start: p.entryStart(item), end: end})
+			continue
+		}
+		// insert the wanted items between this match and the next one
+		wantPos++
+		next := len(want.Content)
+		for _, m := range matches {
+			if m[0] > i {
+				next = m[1]
+				break
+			}
+		}
+		insert(end, want.Content[wantPos:next])
+		wantPos = next
+	}
+	return true
+}
+
+// lcsNodes returns index pairs of the longest common subsequence of equal nodes in a and b.
+func lcsNodes(a, b []*yaml.Node) [][2]int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case yamlNodesEqual(a[i], b[j]):
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			case lengths[i+1][j] >= lengths[i][j+1]:
+				lengths[i][j] = lengths[i+1][j]
+			default:
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+	var result [][2]int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case yamlNodesEqual(a[i], b[j]):
+			result = append(result, [2]int{i, j})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return result
+}
+
+// yamlNodesEqual returns true when a and b have the same content. Scalars are compared by value regardless of tag
+// or style, so an unquoted 1.10 is equal to "1.10".
+func yamlNodesEqual(a, b *yaml.Node) bool {
+	for a.Kind == yaml.AliasNode {
+		a = a.Alias
+	}
+	for b.Kind == yaml.AliasNode {
+		b = b.Alias
+	}
+	if a.Kind != b.Kind || len(a.Content) != len(b.Content) {
+		return false
+	}
+	switch a.Kind {
+	case yaml.ScalarNode:
+		return a.Value == b.Value
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(a.Content); i += 2 {
+			found := false
+			for j := 0; j+1 < len(b.Content); j += 2 {
+				if a.Content[i].Value != b.Content[j].Value {
+					continue
+				}
+				if !yamlNodesEqual(a.Content[i+1], b.Content[j+1]) {
+					return false
+				}
+				found = true
+				break
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	default:
+		for i := range a.Content {
+			if !yamlNodesEqual(a.Content[i], b.Content[i]) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// emptyYamlNode returns true for null scalars and empty collections.
+func emptyYamlNode(node *yaml.Node) bool {
+	if node.Kind == yaml.ScalarNode {
+		return node.Tag == "!!null"
+	}
+	return len(node.Content) == 0
+}
+
+// entryStart returns the 0-indexed line where the entry starting with node begins, including comment lines directly
+// above it.
+func (p *yamlPatcher) entryStart(node *yaml.Node) int {
+	start := node.Line - 1
+	for start > 0 && strings.HasPrefix(strings.TrimSpace(p.lines[start-1]), "#") {
+		start--
+	}
+	return start
+}
+
+// blankPrefix returns true when nothing precedes node on its line.
+func (p *yamlPatcher) blankPrefix(node *yaml.Node) bool {
+	return strings.TrimSpace(p.linePrefix(node)) == ""
+}
+
+// linePrefix returns the text on node's line before node.
+func (p *yamlPatcher) linePrefix(node *yaml.Node) string {
+	return p.lines[node.Line-1][:node.Column-1]
+}
+
+// dashColumn returns the 0-indexed column of the "-" indicator of a block sequence item or -1 if it can't be found.
+func (p *yamlPatcher) dashColumn(item *yaml.Node) int {
+	prefix := p.linePrefix(item)
+	trimmed := strings.TrimRight(prefix, " ")
+	if !strings.HasSuffix(trimmed, "-") || strings.TrimSpace(trimmed) != "-" {
+		return -1
+	}
+	return len(trimmed) - 1
+}
+
+// nodeEnd returns the 0-indexed line after the last line of node.
+func (p *yamlPatcher) nodeEnd(node *yaml.Node) int {
+	end := node.Line
+	switch node.Kind {
+	case yaml.ScalarNode:
+		switch {
+		case node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+			end += len(strings.Split(strings.TrimSuffix(node.Value, "\n"), "\n"))
+		case node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0:
+			end = p.scanEnd(node)
+		}
+	case yaml.MappingNode, yaml.SequenceNode:
+		if node.Style&yaml.FlowStyle != 0 {
+			return p.scanEnd(node)
+		}
+		for _, child := range node.Content {
+			end = max(end, p.nodeEnd(child))
+		}
+	}
+	return min(end, len(p.lines))
+}
+
+// scanEnd finds the end of a quoted scalar or flow collection by scanning the source from its start.
+func (p *yamlPatcher) scanEnd(node *yaml.Node) int {
+	depth := 0
+	var quote byte
+	for line := node.Line - 1; line < len(p.lines); line++ {
+		text := p.lines[line]
+		start := 0
+		if line == node.Line-1 {
+			start = node.Column - 1
+		}
+		for i := start; i < len(text); i++ {
+			ch := text[i]
+			switch {
+			case quote == '"' && ch == '\\':
+				i++
+			case quote != 0 && ch == quote:
+				if quote == '\'' && i+1 < len(text) && text[i+1] == '\'' {
+					i++
+					continue
+				}
+				quote = 0
+				if depth == 0 {
+					return line + 1
+				}
+			case quote != 0:
+			case ch == '"' || ch == '\'':
+				quote = ch
+			case ch == '#' && (i == 0 || text[i-1] == ' '):
+				i = len(text)
+			case ch == '[' || ch == '{':
+				depth++
+			case ch == ']' || ch == '}':
+				depth--
+				if depth == 0 {
+					return line + 1
+				}
+			}
+		}
+	}
+	return len(p.lines)
+}
+
+func renderMappingEntry(key, val *yaml.Node) string {
+	return renderYamlNode(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{key, val}})
+}
+
+func renderSequenceItem(item *yaml.Node) string {
+	return renderYamlNode(&yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{item}})
+}
+
+func renderYamlNode(node *yaml.Node) string {
+	var buf bytes.Buffer
+	err := EncodeYaml(&buf, node)
+	if err != nil {
+		// encoding a node that was produced by the encoder can't fail
+		panic(err)
+	}
+	return buf.String()
+}
+
+// indentYaml prefixes the first line of text with prefix and the remaining lines with indent spaces.
+func indentYaml(text, prefix string, indent int) string {
+	lines := strings.SplitAfter(text, "\n")
+	var sb strings.Builder
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		switch {
+		case i == 0:
+			sb.WriteString(prefix)
+		case strings.TrimSpace(line) != "":
+			sb.WriteString(strings.Repeat(" ", indent))
+		}
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
@@ -0,0 +1,352 @@
+package bindown
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_WriteFile_preservesFormatting(t *testing.T) {
+	ctx := context.Background()
+	const src = `# bindown config for this repo
+systems:
+  - linux/amd64 # ci
+  - darwin/arm64
+
+dependencies:
+  # the linter
+  golangci-lint:
+    template: origin#golangci-lint
+    vars:
+      version: 1.54.2   # keep in sync with ci
+      foo: bar
+
+  shellcheck:
+    template: origin#shellcheck
+    vars: {version: 0.9.0}
+
+  yq:
+    template: origin#yq
+    overrides:
+      - matcher:
+          os: [windows]
+        dependency:
+          vars:
+            archivepathsuffix: .exe
+url_checksums:
+  https://example.com/a: aaaa
+  https://example.com/c: cccc
+`
+
+	for _, td := range []struct {
+		name   string
+		update func(t *testing.T, cfg *Config)
+		want   string
+	}{
+		{
+			name:   "no changes",
+			update: func(t *testing.T, cfg *Config) {},
+			want:   src,
+		},
+		{
+			name: "set var",
+			update: func(t *testing.T, cfg *Config) {
+				require.NoError(t, cfg.SetDependencyVars("golangci-lint", map[string]string{"version": "1.55.0"}))
+			},
+			want: `# bindown config for this repo
+systems:
+  - linux/amd64 # ci
+  - darwin/arm64
+
+dependencies:
+  # the linter
+  golangci-lint:
+    template: origin#golangci-lint
+    vars:
+      version: 1.55.0 # keep in sync with ci
+      foo: bar
+
+  shellcheck:
+    template: origin#shellcheck
+    vars: {version: 0.9.0}
+
+  yq:
+    template: origin#yq
+    overrides:
+      - matcher:
+          os: [windows]
+        dependency:
+          vars:
+            archivepathsuffix: .exe
+url_checksums:
+  https://example.com/a: aaaa
+  https://example.com/c: cccc
+`,
+		},
+		{
+			name: "set var in flow mapping",
+			update: func(t *testing.T, cfg *Config) {
+				require.NoError(t, cfg.SetDependencyVars("shellcheck", map[string]string{"version": "0.10.0"}))
+			},
+			want: `# bindown config for this repo
+systems:
+  - linux/amd64 # ci
+  - darwin/arm64
+
+dependencies:
+  # the linter
+  golangci-lint:
+    template: origin#golangci-lint
+    vars:
+      version: 1.54.2   # keep in sync with ci
+      foo: bar
+
+  shellcheck:
+    template: origin#shellcheck
+    vars:
+      version: 0.10.0
+
+  yq:
+    template: origin#yq
+    overrides:
+      - matcher:
+          os: [windows]
+        dependency:
+          vars:
+            archivepathsuffix: .exe
+url_checksums:
+  https://example.com/a: aaaa
+  https://example.com/c: cccc
+`,
+		},
+		{
+			name: "add checksum",
+			update: func(t *testing.T, cfg *Config) {
+				cfg.URLChecksums["https://example.com/b"] = "bbbb"
+				cfg.URLChecksums["https://example.com/d"] = "dddd"
+			},
+			want: `# bindown config for this repo
+systems:
+  - linux/amd64 # ci
+  - darwin/arm64
+
+dependencies:
+  # the linter
+  golangci-lint:
+    template: origin#golangci-lint
+    vars:
+      version: 1.54.2   # keep in sync with ci
+      foo: bar
+
+  shellcheck:
+    template: origin#shellcheck
+    vars: {version: 0.9.0}
+
+  yq:
+    template: origin#yq
+    overrides:
+      - matcher:
+          os: [windows]
+        dependency:
+          vars:
+            archivepathsuffix: .exe
+url_checksums:
+  https://example.com/a: aaaa
+  https://example.com/b: bbbb
+  https://example.com/c: cccc
+  https://example.com/d: dddd
+`,
+		},
+		{
+			name: "remove dependency",
+			update: func(t *testing.T, cfg *Config) {
+				delete(cfg.Dependencies, "golangci-lint")
+			},
+			want: `# bindown config for this repo
+systems:
+  - linux/amd64 # ci
+  - darwin/arm64
+
+dependencies:
+
+  shellcheck:
+    template: origin#shellcheck
+    vars: {version: 0.9.0}
+
+  yq:
+    template: origin#yq
+    overrides:
+      - matcher:
+          os: [windows]
+        dependency:
+          vars:
+            archivepathsuffix: .exe
+url_checksums:
+  https://example.com/a: aaaa
+  https://example.com/c: cccc
+`,
+		},
+		{
+			name: "systems",
+			update: func(t *testing.T, cfg *Config) {
+				cfg.Systems = []System{"linux/amd64", "darwin/arm64", "windows/amd64"}
+			},
+			want: `# bindown config for this repo
+systems:
+  - linux/amd64 # ci
+  - darwin/arm64
+  - windows/amd64
+
+dependencies:
+  # the linter
+  golangci-lint:
+    template: origin#golangci-lint
+    vars:
+      version: 1.54.2   # keep in sync with ci
+      foo: bar
+
+  shellcheck:
+    template: origin#shellcheck
+    vars: {version: 0.9.0}
+
+  yq:
+    template: origin#yq
+    overrides:
+      - matcher:
+          os: [windows]
+        dependency:
+          vars:
+            archivepathsuffix: .exe
+url_checksums:
+  https://example.com/a: aaaa
+  https://example.com/c: cccc
+`,
+		},
+		{
+			name: "nested override",
+			update: func(t *testing.T, cfg *Config) {
+				cfg.Dependencies["yq"].Overrides[0].Dependency.Vars["archivepathsuffix"] = ".EXE"
+				cfg.Dependencies["yq"].Overrides[0].OverrideMatcher["arch"] = []string{"amd64"}
+			},
+			want: `# bindown config for this repo
+systems:
+  - linux/amd64 # ci
+  - darwin/arm64
+
+dependencies:
+  # the linter
+  golangci-lint:
+    template: origin#golangci-lint
+    vars:
+      version: 1.54.2   # keep in sync with ci
+      foo: bar
+
+  shellcheck:
+    template: origin#shellcheck
+    vars: {version: 0.9.0}
+
+  yq:
+    template: origin#yq
+    overrides:
+      - matcher:
+          arch:
+            - amd64
+          os: [windows]
+        dependency:
+          vars:
+            archivepathsuffix: .EXE
+url_checksums:
+  https://example.com/a: aaaa
+  https://example.com/c: cccc
+`,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			cfgFile := filepath.Join(t.TempDir(), "bindown.yml")
+			writeTestFile(t, cfgFile, src)
+			cfg, err := NewConfig(ctx, cfgFile, true)
+			require.NoError(t, err)
+			td.update(t, cfg)
+			require.NoError(t, cfg.WriteFile(false))
+			requireFileContent(t, cfgFile, td.want)
+		})
+	}
+
+	t.Run("json content is rewritten", func(t *testing.T) {
+		cfgFile := filepath.Join(t.TempDir(), "bindown.yml")
+		writeTestFile(t, cfgFile, `{"systems": ["linux/amd64", "darwin/arm64"]}`)
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		require.NoError(t, cfg.WriteFile(false))
+		requireFileContent(t, cfgFile, `systems:
+  - darwin/arm64
+  - linux/amd64
+`)
+	})
+
+	t.Run("comments are kept when the file can't be patched", func(t *testing.T) {
+		cfgFile := filepath.Join(t.TempDir(), "bindown.yml")
+		writeTestFile(t, cfgFile, `# tools for this repo
+{
+  systems: [linux/amd64], # ci
+  url_checksums: {https://example.com/a: aaaa}
+}
+`)
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		cfg.Systems = append(cfg.Systems, "darwin/arm64")
+		require.NoError(t, cfg.WriteFile(false))
+		requireFileContent(t, cfgFile, `# tools for this repo
+systems: # ci
+  - darwin/arm64
+  - linux/amd64
+url_checksums:
+  https://example.com/a: aaaa
+`)
+	})
+
+	t.Run("DiscardFormatting", func(t *testing.T) {
+		cfgFile := filepath.Join(t.TempDir(), "bindown.yml")
+		writeTestFile(t, cfgFile, src)
+		cfg, err := NewConfig(ctx, cfgFile, true)
+		require.NoError(t, err)
+		cfg.DiscardFormatting()
+		require.NoError(t, cfg.WriteFile(false))
+		requireFileContent(t, cfgFile, `systems:
+  - darwin/arm64
+  - linux/amd64
+dependencies:
+  golangci-lint:
+    template: origin#golangci-lint
+    vars:
+      foo: bar
+      version: 1.54.2
+  shellcheck:
+    template: origin#shellcheck
+    vars:
+      version: 0.9.0
+  yq:
+    template: origin#yq
+    overrides:
+      - matcher:
+          os:
+            - windows
+        dependency:
+          vars:
+            archivepathsuffix: .exe
+url_checksums:
+  https://example.com/a: aaaa
+  https://example.com/c: cccc
+`)
+	})
+}
+
+func requireFileContent(t *testing.T, filename, want string) {
+	t.Helper()
+	got, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Equal(t, want, string(got))
+}
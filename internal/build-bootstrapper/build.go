@@ -2,6 +2,7 @@ package bootstrapper
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"errors"
 	"fmt"
@@ -10,6 +11,8 @@ import (
 	"runtime"
 	"strings"
 	"text/template"
+
+	"github.com/willabides/bindown/v4/internal/httpclient"
 )
 
 //go:embed assets/*
@@ -22,7 +25,7 @@ type BuildOpts struct {
 }
 
 // Build builds a bootstrapper for the given tag
-func Build(tag string, opts *BuildOpts) (_ string, errOut error) {
+func Build(ctx context.Context, tag string, opts *BuildOpts) (_ string, errOut error) {
 	if opts == nil {
 		opts = &BuildOpts{}
 	}
@@ -35,7 +38,7 @@ func Build(tag string, opts *BuildOpts) (_ string, errOut error) {
 		`%s/releases/download/%s/checksums.txt`,
 		repoURL, tag,
 	)
-	resp, err := http.Get(checksumsURL)
+	resp, err := httpclient.FromContext(ctx).Get(ctx, checksumsURL)
 	if err != nil {
 		return "", err
 	}
@@ -62,11 +62,11 @@ func addDependency(
 		regrouped = append(regrouped, gg...)
 	}
 	built := buildConfig(name, version, regrouped)
-	err := built.AddChecksums([]string{name}, built.Dependencies[name].Systems)
+	err := built.AddChecksums(ctx, []string{name}, built.Dependencies[name].Systems)
 	if err != nil {
 		return err
 	}
-	err = built.Validate(name, built.Systems)
+	err = built.Validate(ctx, name, built.Systems)
 	if err != nil {
 		b, e := yaml.Marshal(&bindown.Config{
 			Dependencies: built.Dependencies,
@@ -16,6 +16,7 @@ import (
 
 	"github.com/mholt/archiver/v4"
 	"github.com/willabides/bindown/v4/internal/bindown"
+	"github.com/willabides/bindown/v4/internal/httpclient"
 )
 
 type dlFile struct {
@@ -70,7 +71,7 @@ func (f *dlFile) setArchiveFiles(ctx context.Context, binName, version string) e
 	if err != nil {
 		return err
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpclient.FromContext(ctx).Do(req)
 	if err != nil {
 		return err
 	}
@@ -17,14 +17,26 @@ type (
 
 type Cache struct {
 	Root string
-	// Set to true to make the content read-only on disk.
-	// TODO: find a way to use this without the annoying side effect of requiring sudo to rm -rf the cache.
+	// Set to true to seal entries by removing write permission from their content after they are populated. Sealed
+	// entries are unsealed right before they are re-populated or removed, so they can still be re-populated, evicted
+	// and removed with RemoveRoot by any Cache.
 	ReadOnly bool
 }
 
 // Dir returns a fs.FS for the given key, populating the cache if necessary.
 // The returned fs.FS is valid until unlock is called. After that the contents may change unexpectedly.
 func (c *Cache) Dir(key string, validate validateFunc, populate populateFunc) (_ string, unlock func() error, _ error) {
+	return c.DirWithMetadata(key, &Metadata{}, validate, populate)
+}
+
+// DirWithMetadata is Dir that records meta for the entry when it is populated. Size and the times in meta are
+// ignored. populate can set fields of meta that are only known once the entry is populated, like ContentChecksum.
+func (c *Cache) DirWithMetadata(
+	key string,
+	meta *Metadata,
+	validate validateFunc,
+	populate populateFunc,
+) (_ string, unlock func() error, _ error) {
 	var err error
 	key, err = parseKey(key)
 	if err != nil {
@@ -37,6 +49,7 @@ func (c *Cache) Dir(key string, validate validateFunc, populate populateFunc) (_
 	dir := filepath.Join(c.Root, key)
 	validateErr := validateDir(dir, validate)
 	if validateErr == nil {
+		c.recordUsed(key, *meta)
 		return dir, lock.Close, nil
 	}
 	if populate == nil {
@@ -46,7 +59,7 @@ func (c *Cache) Dir(key string, validate validateFunc, populate populateFunc) (_
 	if err != nil {
 		return "", nil, err
 	}
-	err = c.populate(key, validate, populate)
+	err = c.populate(key, meta, validate, populate)
 	if err != nil {
 		return "", nil, err
 	}
@@ -61,17 +74,61 @@ func (c *Cache) Dir(key string, validate validateFunc, populate populateFunc) (_
 	return dir, lock.Close, nil
 }
 
-// Evict removes acquires a write lock and removes the cache entry for the given key.
-func (c *Cache) Evict(key string) (errOut error) {
+// Keys returns the keys of every entry in the cache in sorted order.
+func (c *Cache) Keys() ([]string, error) {
+	entries, err := os.ReadDir(c.Root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var keys []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			keys = append(keys, entry.Name())
+		}
+	}
+	return keys, nil
+}
+
+// Validate calls validate on the directory for key while holding a read lock. It returns an error when the entry
+// doesn't exist.
+func (c *Cache) Validate(key string, validate validateFunc) (errOut error) {
 	var err error
 	key, err = parseKey(key)
 	if err != nil {
 		return err
 	}
-	lock, err := c.lock(key)
+	lock, err := c.rLock(key)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		errOut = errors.Join(errOut, lock.Close())
+	}()
+	return validateDir(filepath.Join(c.Root, key), validate)
+}
+
+// Evict removes acquires a write lock and removes the cache entry for the given key.
+func (c *Cache) Evict(key string) error {
+	_, err := c.EvictIf(key, nil)
+	return err
+}
+
+// EvictIf acquires a write lock and removes the cache entry for key when remove returns true. remove is called while
+// the lock is held, so the entry can't be used between the decision and the removal. A nil remove always removes.
+// It reports whether the entry was removed.
+func (c *Cache) EvictIf(key string, remove func(entry *Entry) bool) (_ bool, errOut error) {
+	var err error
+	key, err = parseKey(key)
+	if err != nil {
+		return false, err
+	}
+	lock, err := c.lock(key)
+	if err != nil {
+		return false, err
+	}
 	unlocked := false
 	defer func() {
 		if unlocked {
@@ -83,24 +140,57 @@ func (c *Cache) Evict(key string) (errOut error) {
 	info, err := os.Stat(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil
+			return false, nil
 		}
-		return err
+		return false, err
 	}
 	if !info.IsDir() {
-		return errors.New("not a directory")
+		return false, errors.New("not a directory")
+	}
+	if remove != nil {
+		meta, _, err := c.readMetadata(key)
+		if err != nil {
+			return false, err
+		}
+		if !remove(&Entry{Key: key, Metadata: *meta}) {
+			return false, nil
+		}
 	}
-	err = os.RemoveAll(dir)
+	err = removeEntryDir(dir)
 	if err != nil {
-		return err
+		return false, err
+	}
+	err = c.removeMetadata(key)
+	if err != nil {
+		return true, err
 	}
 	// Unlock early to get around a Windows issue where you can't delete a locked file.
 	unlocked = true
 	err = lock.Close()
+	if err != nil {
+		return true, err
+	}
+	return true, os.Remove(c.lockfile(key))
+}
+
+// Locked calls fn while holding the write lock for key, so fn can change files that belong to the entry but are kept
+// outside of it, like partial downloads, without racing with a process populating the entry. The entry isn't sealed
+// when the lock is released.
+func (c *Cache) Locked(key string, fn func() error) (errOut error) {
+	var err error
+	key, err = parseKey(key)
 	if err != nil {
 		return err
 	}
-	return os.Remove(c.lockfile(key))
+	unsealed := &Cache{Root: c.Root}
+	lock, err := unsealed.lock(key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		errOut = errors.Join(errOut, lock.Close())
+	}()
+	return fn()
 }
 
 func (c *Cache) lockfile(key string) string {
@@ -126,19 +216,12 @@ func (c *Cache) lock(key string) (io.Closer, error) {
 	}
 	file, err := lockedfile.Create(c.lockfile(key))
 	if err != nil {
-		return nil, err
-	}
-	dir := filepath.Join(c.Root, key)
-	if c.ReadOnly {
-		err = unsealDir(dir)
-		if err != nil {
-			return nil, err
-		}
+		return nil, errors.Join(err, rootLock.Close())
 	}
 	return &writeLock{
 		rootLock: rootLock,
 		lock:     file,
-		dir:      dir,
+		dir:      filepath.Join(c.Root, key),
 		readOnly: c.ReadOnly,
 	}, nil
 }
@@ -197,7 +280,7 @@ func acquireLock(lockfile string) (io.Closer, error) {
 	return lockedfile.Create(lockfile)
 }
 
-func (c *Cache) populate(key string, validate validateFunc, populate populateFunc) (errOut error) {
+func (c *Cache) populate(key string, meta *Metadata, validate validateFunc, populate populateFunc) (errOut error) {
 	lock, err := c.lock(key)
 	if err != nil {
 		return err
@@ -212,7 +295,7 @@ func (c *Cache) populate(key string, validate validateFunc, populate populateFun
 		if err != nil {
 			return err
 		}
-		return populate(dir)
+		return c.populateDir(key, meta, validate, populate)
 	}
 	if err != nil {
 		return err
@@ -223,7 +306,7 @@ func (c *Cache) populate(key string, validate validateFunc, populate populateFun
 	if validateDir(dir, validate) == nil {
 		return nil
 	}
-	err = os.RemoveAll(dir)
+	err = removeEntryDir(dir)
 	if err != nil {
 		return err
 	}
@@ -231,7 +314,24 @@ func (c *Cache) populate(key string, validate validateFunc, populate populateFun
 	if err != nil {
 		return err
 	}
-	return populate(dir)
+	return c.populateDir(key, meta, validate, populate)
+}
+
+// populateDir populates the directory for key, validates it and records its metadata. The directory is removed when
+// any of those fail, so a partly populated entry is never left for the next reader.
+func (c *Cache) populateDir(key string, meta *Metadata, validate validateFunc, populate populateFunc) error {
+	dir := filepath.Join(c.Root, key)
+	err := populate(dir)
+	if err == nil {
+		err = validateDir(dir, validate)
+	}
+	if err == nil {
+		err = c.recordPopulated(key, *meta)
+	}
+	if err != nil {
+		return errors.Join(err, removeEntryDir(dir))
+	}
+	return nil
 }
 
 // RemoveRoot removes a cache root and all of its contents. This is the nuclear option.
@@ -248,11 +348,10 @@ func RemoveRoot(root string) (errOut error) {
 		}
 		errOut = errors.Join(errOut, rootLock.Close())
 	}()
-	if c.ReadOnly {
-		err = unsealDir(root)
-		if err != nil {
-			return err
-		}
+	// entries may be sealed
+	err = unsealDir(root)
+	if err != nil {
+		return err
 	}
 	// Unlock early to get around a Windows issue where you can't delete a locked file.
 	unlocked = true
@@ -263,6 +362,16 @@ func RemoveRoot(root string) (errOut error) {
 	return os.RemoveAll(root)
 }
 
+// removeEntryDir unseals and removes an entry's directory. It unseals even when the Cache removing the entry isn't
+// ReadOnly because the entry may have been sealed by a Cache that was.
+func removeEntryDir(dir string) error {
+	err := unsealDir(dir)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
 type writeLock struct {
 	rootLock io.Closer
 	lock     io.Closer
@@ -286,11 +395,20 @@ func (l *readLock) Close() (errOut error) {
 	return errors.Join(l.lock.Close(), l.rootLock.Close())
 }
 
+// errEntryNotExist is the error for an entry that doesn't exist. It matches os.ErrNotExist.
+var errEntryNotExist error = notExistError("entry does not exist")
+
+type notExistError string
+
+func (e notExistError) Error() string { return string(e) }
+
+func (e notExistError) Is(target error) bool { return target == os.ErrNotExist }
+
 func validateDir(dir string, validate validateFunc) error {
 	info, err := os.Stat(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return errors.New("entry does not exist")
+			return errEntryNotExist
 		}
 		return err
 	}
@@ -316,8 +434,8 @@ func parseKey(key string) (string, error) {
 	return key, nil
 }
 
-// sealDir removes the write permission from a directory and all its contents.
-// This is best-effort, and will not fail if the permissions cannot be changed.
+// sealDir removes the write permission from a directory and all its contents. Symlinks are skipped because chmod
+// would change their targets. This is best-effort, and will not fail if the permissions cannot be changed.
 //
 //nolint:errcheck // this is best-effort
 func sealDir(dir string) {
@@ -336,15 +454,17 @@ func sealDir(dir string) {
 		if err != nil {
 			continue
 		}
-		if stat.Mode()&0o222 == 0 {
+		if stat.Mode()&os.ModeSymlink != 0 || stat.Mode()&0o222 == 0 {
 			continue
 		}
 		_ = os.Chmod(f, stat.Mode()&^0o222)
 	}
 }
 
+// unsealDir gives the owner write permission to a directory and all its contents so they can be changed or removed.
+// Directories are unsealed before their contents are read, so this works on anything sealDir sealed.
 func unsealDir(dir string) error {
-	_, err := os.Stat(dir)
+	_, err := os.Lstat(dir)
 	if os.IsNotExist(err) {
 		return nil
 	}
@@ -352,10 +472,16 @@ func unsealDir(dir string) error {
 		if err != nil {
 			return err
 		}
+		if d.Type()&os.ModeSymlink != 0 {
+			return nil
+		}
 		info, err := d.Info()
 		if err != nil {
 			return err
 		}
-		return os.Chmod(path, info.Mode()|0o222)
+		if info.Mode()&0o200 != 0 {
+			return nil
+		}
+		return os.Chmod(path, info.Mode()|0o200)
 	})
 }
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -82,6 +85,26 @@ func TestCache_Dir(t *testing.T) {
 		require.EqualError(t, err, assert.AnError.Error())
 	})
 
+	t.Run("removes the entry when populator returns error", func(t *testing.T) {
+		cache := testCache(t)
+		_, _, err := cache.Dir("foo", nil, func(dir string) error {
+			mustWriteFile(t, filepath.Join(dir, "foo.txt"), "partial")
+			return assert.AnError
+		})
+		require.EqualError(t, err, assert.AnError.Error())
+		require.NoDirExists(t, filepath.Join(cache.Root, "foo"))
+	})
+
+	t.Run("removes the entry when populated content is invalid", func(t *testing.T) {
+		cache := testCache(t)
+		_, _, err := cache.Dir("foo", fooValidator, func(dir string) error {
+			mustWriteFile(t, filepath.Join(dir, "foo.txt"), "invalid")
+			return nil
+		})
+		require.EqualError(t, err, "invalid entry")
+		require.NoDirExists(t, filepath.Join(cache.Root, "foo"))
+	})
+
 	t.Run("errors when dir is a file", func(t *testing.T) {
 		cache := testCache(t)
 		testFile := filepath.Join(cache.Root, "foo.txt")
@@ -216,6 +239,252 @@ func TestCache_Evict(t *testing.T) {
 	})
 }
 
+func TestCache_EvictIf(t *testing.T) {
+	cache := testCache(t)
+	_, unlock, err := cache.DirWithMetadata("foo", &Metadata{Dependency: "foo"}, fooValidator, fooPopulator)
+	require.NoError(t, err)
+	mustUnlock(t, unlock)
+
+	var got *Entry
+	evicted, err := cache.EvictIf("foo", func(entry *Entry) bool {
+		got = entry
+		return false
+	})
+	require.NoError(t, err)
+	require.False(t, evicted)
+	require.Equal(t, "foo", got.Dependency)
+	require.DirExists(t, filepath.Join(cache.Root, "foo"))
+
+	// eviction waits for readers to unlock
+	_, unlock, err = cache.Dir("foo", fooValidator, nil)
+	require.NoError(t, err)
+	done := make(chan bool)
+	go func() {
+		evicted, evictErr := cache.EvictIf("foo", func(*Entry) bool { return true })
+		assert.NoError(t, evictErr)
+		done <- evicted
+	}()
+	select {
+	case <-done:
+		t.Fatal("evicted while locked")
+	case <-time.After(100 * time.Millisecond):
+	}
+	mustUnlock(t, unlock)
+	require.True(t, <-done)
+	require.NoDirExists(t, filepath.Join(cache.Root, "foo"))
+
+	evicted, err = cache.EvictIf("foo", nil)
+	require.NoError(t, err)
+	require.False(t, evicted)
+}
+
+func TestCache_Locked(t *testing.T) {
+	cache := testCache(t)
+	// Locked waits for readers to unlock
+	_, unlock, err := cache.Dir("foo", fooValidator, fooPopulator)
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		assert.NoError(t, cache.Locked("foo", func() error { return nil }))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("locked while read locked")
+	case <-time.After(100 * time.Millisecond):
+	}
+	mustUnlock(t, unlock)
+	<-done
+
+	wantErr := fmt.Errorf("fn failed")
+	require.ErrorIs(t, cache.Locked("foo", func() error { return wantErr }), wantErr)
+	require.Error(t, cache.Locked(".partial", func() error { return nil }))
+}
+
+func TestCache_ReadOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows doesn't have write permission bits")
+	}
+	nestedPopulator := func(dir string) error {
+		err := os.MkdirAll(filepath.Join(dir, "sub"), 0o755)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(filepath.Join(dir, "sub", "baz.txt"), []byte("baz"), 0o644)
+		if err != nil {
+			return err
+		}
+		return fooPopulator(dir)
+	}
+
+	t.Run("seals populated entries", func(t *testing.T) {
+		cache := testCache(t)
+		cache.ReadOnly = true
+		outside := filepath.Join(t.TempDir(), "outside.txt")
+		mustWriteFile(t, outside, "outside")
+		outsideInfo, err := os.Stat(outside)
+		require.NoError(t, err)
+		dir, unlock, err := cache.Dir("foo", fooValidator, func(dir string) error {
+			err := nestedPopulator(dir)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(outside, filepath.Join(dir, "link"))
+		})
+		require.NoError(t, err)
+		mustUnlock(t, unlock)
+		assertSealed(t, dir, true)
+		// the symlink's target isn't sealed
+		info, err := os.Stat(outside)
+		require.NoError(t, err)
+		require.Equal(t, outsideInfo.Mode(), info.Mode())
+
+		require.NoError(t, cache.Evict("foo"))
+		require.NoDirExists(t, dir)
+	})
+
+	t.Run("concurrent readers", func(t *testing.T) {
+		cache := testCache(t)
+		cache.ReadOnly = true
+		_, unlock, err := cache.Dir("foo", fooValidator, nestedPopulator)
+		require.NoError(t, err)
+		mustUnlock(t, unlock)
+
+		const readers = 8
+		unlocks := make(chan func() error, readers)
+		var wg sync.WaitGroup
+		for i := 0; i < readers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				dir, unlock, err := cache.Dir("foo", fooValidator, nestedPopulator)
+				if !assert.NoError(t, err) {
+					return
+				}
+				assertFile(t, dir, "foo.txt", "bar")
+				assertFile(t, filepath.Join(dir, "sub"), "baz.txt", "baz")
+				assertSealed(t, dir, true)
+				unlocks <- unlock
+			}()
+		}
+		wg.Wait()
+		close(unlocks)
+
+		// the entry stays sealed until every reader unlocks
+		done := make(chan error)
+		go func() {
+			done <- cache.Evict("foo")
+		}()
+		select {
+		case err = <-done:
+			t.Fatalf("evicted while locked: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		assertSealed(t, filepath.Join(cache.Root, "foo"), true)
+		for unlock := range unlocks {
+			mustUnlock(t, unlock)
+		}
+		require.NoError(t, <-done)
+		require.NoDirExists(t, filepath.Join(cache.Root, "foo"))
+	})
+
+	t.Run("writers without ReadOnly keep entries sealed", func(t *testing.T) {
+		sealed := testCache(t)
+		sealed.ReadOnly = true
+		dir, unlock, err := sealed.Dir("foo", fooValidator, nestedPopulator)
+		require.NoError(t, err)
+		mustUnlock(t, unlock)
+		assertSealed(t, dir, true)
+
+		cache := &Cache{Root: sealed.Root}
+		evicted, err := cache.EvictIf("foo", func(*Entry) bool { return false })
+		require.NoError(t, err)
+		require.False(t, evicted)
+		assertSealed(t, dir, true)
+
+		// populate finds the entry valid when another process populated it first
+		err = cache.populate("foo", &Metadata{}, fooValidator, nestedPopulator)
+		require.NoError(t, err)
+		assertSealed(t, dir, true)
+
+		_, unlock, err = cache.Dir("foo", fileValidator("foo.txt", "new"), filePopulator("foo.txt", "new"))
+		require.NoError(t, err)
+		mustUnlock(t, unlock)
+		assertSealed(t, dir, false)
+		assertFileNotExist(t, dir, "sub")
+
+		_, unlock, err = sealed.Dir("foo", fooValidator, nestedPopulator)
+		require.NoError(t, err)
+		mustUnlock(t, unlock)
+		assertSealed(t, dir, true)
+		require.NoError(t, cache.Evict("foo"))
+		require.NoDirExists(t, dir)
+	})
+
+	t.Run("RemoveRoot", func(t *testing.T) {
+		cache := testCache(t)
+		cache.ReadOnly = true
+		_, unlock, err := cache.Dir("foo", fooValidator, nestedPopulator)
+		require.NoError(t, err)
+		mustUnlock(t, unlock)
+		require.NoError(t, RemoveRoot(cache.Root))
+		require.NoDirExists(t, cache.Root)
+	})
+}
+
+// assertSealed checks whether everything in dir except symlinks is without write permission.
+func assertSealed(t testing.TB, dir string, want bool) {
+	t.Helper()
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.Type()&os.ModeSymlink != 0 {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if want {
+			assert.Zero(t, info.Mode()&0o222, "%s is writable", path)
+		} else {
+			assert.NotZero(t, info.Mode()&0o200, "%s is not writable", path)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestCache_Keys(t *testing.T) {
+	cache := testCache(t)
+	keys, err := cache.Keys()
+	require.NoError(t, err)
+	require.Empty(t, keys)
+
+	for _, key := range []string{"foo", "bar"} {
+		_, unlock, err := cache.Dir(key, nil, fooPopulator)
+		require.NoError(t, err)
+		mustUnlock(t, unlock)
+	}
+	mustWriteFile(t, filepath.Join(cache.Root, "file.txt"), "not an entry")
+	keys, err = cache.Keys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"bar", "foo"}, keys)
+}
+
+func TestCache_Validate(t *testing.T) {
+	cache := testCache(t)
+	err := cache.Validate("foo", fooValidator)
+	require.EqualError(t, err, "entry does not exist")
+
+	mustWriteFile(t, filepath.Join(cache.Root, "foo", "foo.txt"), "bar")
+	require.NoError(t, cache.Validate("foo", fooValidator))
+
+	mustWriteFile(t, filepath.Join(cache.Root, "foo", "foo.txt"), "invalid")
+	require.EqualError(t, cache.Validate("foo", fooValidator), "invalid entry")
+	assertFile(t, filepath.Join(cache.Root, "foo"), "foo.txt", "invalid")
+
+	require.EqualError(t, cache.Validate("../foo", nil), "invalid key")
+}
+
 var (
 	fooValidator = fileValidator("foo.txt", "bar")
 	fooPopulator = filePopulator("foo.txt", "bar")
@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Metadata describes a cache entry. It is recorded in the cache's .meta directory when the entry is populated, and
+// LastUsed is updated whenever the entry is read.
+type Metadata struct {
+	// Dependency, System, URL and Checksum describe what the entry was created from. They are whatever the caller
+	// passed to DirWithMetadata.
+	Dependency string `json:"dependency,omitempty"`
+	System     string `json:"system,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Checksum   string `json:"checksum,omitempty"`
+
+	// ContentChecksum is a checksum of the entry's content that populate recorded to validate the entry against.
+	ContentChecksum string `json:"content_checksum,omitempty"`
+
+	// Size is the total size of the entry's files in bytes.
+	Size     int64     `json:"size"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+// Entry is a cache entry and its metadata.
+type Entry struct {
+	Key string `json:"key"`
+	Metadata
+}
+
+// timeNow is replaced in tests.
+var timeNow = time.Now
+
+// Entry returns the entry for key. Entries created before metadata was recorded get their times from the
+// directory's modification time.
+func (c *Cache) Entry(key string) (_ *Entry, errOut error) {
+	var err error
+	key, err = parseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := c.rLock(key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		errOut = errors.Join(errOut, lock.Close())
+	}()
+	err = validateDir(filepath.Join(c.Root, key), nil)
+	if err != nil {
+		return nil, err
+	}
+	meta, _, err := c.readMetadata(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{Key: key, Metadata: *meta}, nil
+}
+
+// Entries returns every entry in the cache in key order. Entries that are removed while they are listed are skipped.
+func (c *Cache) Entries() ([]Entry, error) {
+	keys, err := c.Keys()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(keys))
+	for _, key := range keys {
+		entry, err := c.Entry(key)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+func (c *Cache) metadataFile(key string) string {
+	return filepath.Join(c.Root, ".meta", key+".json")
+}
+
+// readMetadata reads the metadata for key. When there is none, it is made up from the entry's directory and found is
+// false.
+func (c *Cache) readMetadata(key string) (_ *Metadata, found bool, _ error) {
+	var meta Metadata
+	data, err := os.ReadFile(c.metadataFile(key))
+	if err == nil && json.Unmarshal(data, &meta) == nil {
+		return &meta, true, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, false, err
+	}
+	dir := filepath.Join(c.Root, key)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, false, err
+	}
+	meta.Size, err = dirSize(dir)
+	if err != nil {
+		return nil, false, err
+	}
+	meta.Created = info.ModTime()
+	meta.LastUsed = info.ModTime()
+	return &meta, false, nil
+}
+
+// writeMetadata writes meta for key. It writes to a temp file first so concurrent readers never see a partial file.
+func (c *Cache) writeMetadata(key string, meta *Metadata) error {
+	filename := c.metadataFile(key)
+	err := os.MkdirAll(filepath.Dir(filename), 0o777)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filename), key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	err = errors.Join(err, tmp.Close())
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(tmp.Name()))
+	}
+	return nil
+}
+
+// recordPopulated writes new metadata for an entry that was just populated.
+func (c *Cache) recordPopulated(key string, meta Metadata) error {
+	size, err := dirSize(filepath.Join(c.Root, key))
+	if err != nil {
+		return err
+	}
+	meta.Size = size
+	meta.Created = timeNow()
+	meta.LastUsed = meta.Created
+	return c.writeMetadata(key, &meta)
+}
+
+// recordUsed updates an entry's LastUsed. When the entry has no metadata yet, it is created with meta. This is
+// best-effort because failing to record a read shouldn't fail the read.
+func (c *Cache) recordUsed(key string, meta Metadata) {
+	existing, found, err := c.readMetadata(key)
+	if err != nil {
+		return
+	}
+	if !found {
+		meta.Size, meta.Created = existing.Size, existing.Created
+		existing = &meta
+	}
+	existing.LastUsed = timeNow()
+	//nolint:errcheck // best-effort
+	_ = c.writeMetadata(key, existing)
+}
+
+// removeMetadata removes the metadata for key if it exists.
+func (c *Cache) removeMetadata(key string) error {
+	err := os.Remove(c.metadataFile(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setTimeNow(t *testing.T, now time.Time) {
+	t.Helper()
+	orig := timeNow
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = orig })
+}
+
+func TestCache_DirWithMetadata(t *testing.T) {
+	cache := testCache(t)
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	setTimeNow(t, created)
+	meta := Metadata{Dependency: "foo", System: "linux/amd64", URL: "https://example.com/foo", Checksum: "abc"}
+	_, unlock, err := cache.DirWithMetadata("foo", &meta, fooValidator, fooPopulator)
+	require.NoError(t, err)
+	mustUnlock(t, unlock)
+
+	entry, err := cache.Entry("foo")
+	require.NoError(t, err)
+	want := Entry{Key: "foo", Metadata: meta}
+	want.Size = 3
+	want.Created = created
+	want.LastUsed = created
+	require.Equal(t, want, *entry)
+
+	used := created.Add(time.Hour)
+	setTimeNow(t, used)
+	_, unlock, err = cache.DirWithMetadata("foo", &Metadata{Dependency: "bar"}, fooValidator, fooPopulator)
+	require.NoError(t, err)
+	mustUnlock(t, unlock)
+	entry, err = cache.Entry("foo")
+	require.NoError(t, err)
+	want.LastUsed = used
+	require.Equal(t, want, *entry)
+
+	require.NoError(t, cache.Evict("foo"))
+	require.NoFileExists(t, cache.metadataFile("foo"))
+	_, err = cache.Entry("foo")
+	require.EqualError(t, err, "entry does not exist")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestCache_Entries(t *testing.T) {
+	cache := testCache(t)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	setTimeNow(t, now)
+
+	// an entry from before metadata was recorded
+	mustWriteFile(t, filepath.Join(cache.Root, "old", "foo.txt"), "bar")
+	modTime := now.Add(-time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(cache.Root, "old"), modTime, modTime))
+	_, unlock, err := cache.Dir("new", nil, filePopulator("foo.txt", "hello"))
+	require.NoError(t, err)
+	mustUnlock(t, unlock)
+
+	entries, err := cache.Entries()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, Entry{Key: "new", Metadata: Metadata{Size: 5, Created: now, LastUsed: now}}, entries[0])
+	require.Equal(t, "old", entries[1].Key)
+	require.Equal(t, int64(3), entries[1].Size)
+	require.True(t, modTime.Equal(entries[1].Created))
+
+	// reading the old entry records its metadata
+	_, unlock, err = cache.DirWithMetadata("old", &Metadata{Dependency: "foo"}, nil, nil)
+	require.NoError(t, err)
+	mustUnlock(t, unlock)
+	entry, err := cache.Entry("old")
+	require.NoError(t, err)
+	require.Equal(t, "foo", entry.Dependency)
+	require.True(t, modTime.Equal(entry.Created))
+	require.Equal(t, now, entry.LastUsed)
+}
@@ -0,0 +1,323 @@
+// Package httpclient is the http client bindown uses for all downloads.
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Options configures a Client. The zero value has no timeouts and no retries and uses proxies from the environment.
+type Options struct {
+	// ConnectTimeout limits how long it takes to connect to a server including the TLS handshake.
+	ConnectTimeout time.Duration
+
+	// ReadTimeout limits how long to wait for response headers and for each read of the response body.
+	ReadTimeout time.Duration
+
+	// RootCAFile is a file of PEM encoded certificates to trust in addition to the system's root certificates.
+	RootCAFile string
+
+	// Proxy is the url of a proxy for all requests. When it is empty, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are used.
+	Proxy string
+
+	// UserAgent is the User-Agent header for requests.
+	UserAgent string
+
+	// Retries is the number of times to retry requests that fail with a connection error or timeout or a 5xx or 429
+	// response.
+	Retries int
+
+	// RetryWait is how long to wait before the first retry. The wait doubles after each retry. Default is 1 second.
+	RetryWait time.Duration
+
+	// Offline makes every request fail with ErrOffline without sending it.
+	Offline bool
+}
+
+// Client makes http requests with the settings in its Options.
+type Client struct {
+	opts    Options
+	client  *http.Client
+	editors []RequestEditor
+}
+
+// RequestEditor changes a request before it is sent. Headers it sets are only sent to the request's host. They are
+// dropped when the request is redirected to another host.
+type RequestEditor func(req *http.Request) error
+
+// WithRequestEditor returns a copy of c that calls edit on every request before sending it.
+func (c *Client) WithRequestEditor(edit RequestEditor) *Client {
+	clone := *c
+	clone.editors = append(slices.Clip(c.editors), edit)
+	return &clone
+}
+
+// New returns a Client configured with opts.
+func New(opts Options) (*Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: opts.ConnectTimeout, KeepAlive: 30 * time.Second}
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = opts.ConnectTimeout
+	transport.ResponseHeaderTimeout = opts.ReadTimeout
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url %q: %w", opts.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if opts.RootCAFile != "" {
+		pem, err := os.ReadFile(opts.RootCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.RootCAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	if opts.RetryWait == 0 {
+		opts.RetryWait = time.Second
+	}
+	return &Client{
+		opts:   opts,
+		client: &http.Client{Transport: transport, CheckRedirect: checkRedirect},
+	}, nil
+}
+
+var defaultClient = sync.OnceValue(func() *Client {
+	client, err := New(Options{})
+	if err != nil {
+		panic(err)
+	}
+	return client
+})
+
+type contextKey struct{}
+
+// NewContext returns a context that carries client.
+func NewContext(ctx context.Context, client *Client) context.Context {
+	return context.WithValue(ctx, contextKey{}, client)
+}
+
+// FromContext returns the Client carried by ctx or a Client with default Options.
+func FromContext(ctx context.Context) *Client {
+	client, ok := ctx.Value(contextKey{}).(*Client)
+	if ok && client != nil {
+		return client
+	}
+	return defaultClient()
+}
+
+// ErrOffline is returned for requests made by a Client with Options.Offline set.
+var ErrOffline = errors.New("offline")
+
+// Offline reports whether c is in offline mode. Callers can use it to fail with a better error before making a
+// request.
+func (c *Client) Offline() bool {
+	return c.opts.Offline
+}
+
+// Get is Do for a GET request to u.
+func (c *Client) Get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends req and retries when it fails with a connection error or a 5xx or 429 response. Requests with a body
+// aren't retried. req isn't changed by the client's RequestEditors. The returned response's body must be closed.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if c.opts.Offline {
+		return nil, fmt.Errorf("%w: not cached: %s", ErrOffline, req.URL.Redacted())
+	}
+	if len(c.editors) > 0 {
+		req = req.Clone(req.Context())
+		orig := req.Header.Clone()
+		for _, edit := range c.editors {
+			err := edit(req)
+			if err != nil {
+				return nil, err
+			}
+		}
+		var edited []string
+		for name, values := range req.Header {
+			if !slices.Equal(orig[name], values) {
+				edited = append(edited, name)
+			}
+		}
+		if len(edited) > 0 {
+			req = req.WithContext(context.WithValue(req.Context(), editedHeadersKey{}, edited))
+		}
+	}
+	if c.opts.UserAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.opts.UserAgent)
+	}
+	retries := c.opts.Retries
+	if req.Body != nil && req.Body != http.NoBody {
+		retries = 0
+	}
+	wait := c.opts.RetryWait
+	for attempt := 0; ; attempt++ {
+		resp, err := c.do(req)
+		if attempt >= retries || !shouldRetry(req.Context(), resp, err) {
+			return resp, err
+		}
+		retryWait := wait
+		if resp != nil {
+			retryWait = max(retryWait, retryAfter(resp))
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+			_ = resp.Body.Close()
+		}
+		// add up to 20% jitter so concurrent clients don't retry in lockstep
+		retryWait += time.Duration(rand.Int63n(int64(retryWait)/5 + 1))
+		timer := time.NewTimer(retryWait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		wait *= 2
+	}
+}
+
+// editedHeadersKey is the context key for the names of the headers RequestEditors set on a request.
+type editedHeadersKey struct{}
+
+// checkRedirect removes the headers set by RequestEditors from redirects to a host other than the original request's.
+// http.Client only does that for Authorization and cookies, so other credentials like API key headers would be sent
+// to wherever the server redirects, like a CDN or object storage.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	// the same limit as http.Client's default
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Host == via[0].URL.Host {
+		return nil
+	}
+	edited, _ := req.Context().Value(editedHeadersKey{}).([]string)
+	for _, name := range edited {
+		req.Header.Del(name)
+	}
+	return nil
+}
+
+// do sends req once. When ReadTimeout is set, the request is canceled if a read of the response body takes longer.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.opts.ReadTimeout <= 0 {
+		return c.client.Do(req)
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	body := &timeoutBody{
+		body:    resp.Body,
+		timeout: c.opts.ReadTimeout,
+		cancel:  cancel,
+	}
+	body.timer = time.AfterFunc(c.opts.ReadTimeout, body.expire)
+	resp.Body = body
+	return resp, nil
+}
+
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return retryableError(err)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// retryableError returns true for request errors that can clear up on their own like timeouts, refused or reset
+// connections and connections closed mid-response. Errors like an unsupported scheme, an unknown host or a
+// certificate problem fail the same way every time.
+func retryableError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// retryAfter returns the wait from a response's Retry-After header in seconds or 0.
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// ErrReadTimeout is returned when a read of a response body takes longer than Options.ReadTimeout.
+var ErrReadTimeout = errors.New("timed out reading response body")
+
+// timeoutBody cancels a request when a read takes longer than timeout.
+type timeoutBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	cancel  context.CancelFunc
+	timer   *time.Timer
+
+	mu      sync.Mutex
+	expired bool
+}
+
+func (b *timeoutBody) expire() {
+	b.mu.Lock()
+	b.expired = true
+	b.mu.Unlock()
+	b.cancel()
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.mu.Lock()
+	expired := b.expired
+	b.mu.Unlock()
+	if expired {
+		return n, ErrReadTimeout
+	}
+	b.timer.Reset(b.timeout)
+	return n, err
+}
+
+func (b *timeoutBody) Close() error {
+	b.timer.Stop()
+	err := b.body.Close()
+	b.cancel()
+	return err
+}
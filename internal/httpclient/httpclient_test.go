@@ -0,0 +1,226 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, opts Options) *Client {
+	t.Helper()
+	if opts.RetryWait == 0 {
+		opts.RetryWait = time.Millisecond
+	}
+	client, err := New(opts)
+	require.NoError(t, err)
+	return client
+}
+
+// statusServer responds with statuses in order and then 200.
+func statusServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := int(requests.Add(1))
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &requests
+}
+
+func TestClient_Do(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("retries 5xx and 429", func(t *testing.T) {
+		ts, requests := statusServer(t, 503, 429, 500)
+		client := newTestClient(t, Options{Retries: 3})
+		resp, err := client.Get(ctx, ts.URL)
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, resp.Body.Close()) })
+		require.Equal(t, 200, resp.StatusCode)
+		require.Equal(t, int32(4), requests.Load())
+	})
+
+	t.Run("gives up after retries", func(t *testing.T) {
+		ts, requests := statusServer(t, 503, 503, 503)
+		client := newTestClient(t, Options{Retries: 1})
+		resp, err := client.Get(ctx, ts.URL)
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, resp.Body.Close()) })
+		require.Equal(t, 503, resp.StatusCode)
+		require.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("doesn't retry 404", func(t *testing.T) {
+		ts, requests := statusServer(t, 404)
+		client := newTestClient(t, Options{Retries: 3})
+		resp, err := client.Get(ctx, ts.URL)
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, resp.Body.Close()) })
+		require.Equal(t, 404, resp.StatusCode)
+		require.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("retries connection errors", func(t *testing.T) {
+		ts := httptest.NewServer(http.NotFoundHandler())
+		u := ts.URL
+		ts.Close()
+		client := newTestClient(t, Options{Retries: 2})
+		_, err := client.Get(ctx, u)
+		require.Error(t, err)
+	})
+
+	t.Run("doesn't retry unsupported scheme", func(t *testing.T) {
+		client := newTestClient(t, Options{Retries: 3, RetryWait: time.Hour})
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		t.Cleanup(cancel)
+		_, err := client.Get(timeoutCtx, "ftp://example.com/foo")
+		require.ErrorContains(t, err, "unsupported protocol scheme")
+	})
+
+	t.Run("canceled while waiting to retry", func(t *testing.T) {
+		ts, requests := statusServer(t, 503, 503)
+		client := newTestClient(t, Options{Retries: 3, RetryWait: time.Hour})
+		cancelCtx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(10*time.Millisecond, cancel)
+		_, err := client.Get(cancelCtx, ts.URL)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("user agent", func(t *testing.T) {
+		var gotUA string
+		ts := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+			gotUA = req.UserAgent()
+		}))
+		t.Cleanup(ts.Close)
+		client := newTestClient(t, Options{UserAgent: "bindown/1.2.3"})
+		resp, err := client.Get(ctx, ts.URL)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, "bindown/1.2.3", gotUA)
+	})
+
+	t.Run("read timeout", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			_, _ = io.WriteString(w, "partial")
+			w.(http.Flusher).Flush()
+			select {
+			case <-req.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		t.Cleanup(ts.Close)
+		client := newTestClient(t, Options{ReadTimeout: 50 * time.Millisecond})
+		resp, err := client.Get(ctx, ts.URL)
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, resp.Body.Close()) })
+		_, err = io.ReadAll(resp.Body)
+		require.ErrorIs(t, err, ErrReadTimeout)
+	})
+
+	t.Run("root CA file", func(t *testing.T) {
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = io.WriteString(w, "ok")
+		}))
+		t.Cleanup(ts.Close)
+
+		_, err := newTestClient(t, Options{Retries: 2}).Get(ctx, ts.URL)
+		require.ErrorContains(t, err, "certificate")
+
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+		require.NoError(t, os.WriteFile(caFile, certPEM, 0o600))
+		resp, err := newTestClient(t, Options{RootCAFile: caFile}).Get(ctx, ts.URL)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, 200, resp.StatusCode)
+	})
+
+	t.Run("offline", func(t *testing.T) {
+		ts, requests := statusServer(t)
+		client := newTestClient(t, Options{Offline: true})
+		require.True(t, client.Offline())
+		_, err := client.Get(ctx, ts.URL+"/foo")
+		require.ErrorIs(t, err, ErrOffline)
+		require.EqualError(t, err, "offline: not cached: "+ts.URL+"/foo")
+		require.Equal(t, int32(0), requests.Load())
+	})
+}
+
+func Test_retryableError(t *testing.T) {
+	for _, td := range []struct {
+		err  error
+		want bool
+	}{
+		{err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, want: true},
+		{err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}, want: true},
+		{err: io.ErrUnexpectedEOF, want: true},
+		{err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}, want: true},
+		{err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}},
+		{err: &url.Error{Op: "Get", URL: "ftp://example.com", Err: errors.New("unsupported protocol scheme")}},
+		{err: &tls.CertificateVerificationError{Err: errors.New("unknown authority")}},
+	} {
+		require.Equal(t, td.want, retryableError(&url.Error{Op: "Get", URL: "https://example.com", Err: td.err}), td.err.Error())
+	}
+}
+
+func TestClient_WithRequestEditor(t *testing.T) {
+	ctx := context.Background()
+	var gotHeaders []string
+	ts := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		gotHeaders = req.Header.Values("X-Test")
+	}))
+	t.Cleanup(ts.Close)
+	client := newTestClient(t, Options{})
+	edited := client.WithRequestEditor(func(req *http.Request) error {
+		req.Header.Add("X-Test", "a")
+		return nil
+	}).WithRequestEditor(func(req *http.Request) error {
+		req.Header.Add("X-Test", "b")
+		return nil
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, http.NoBody)
+	require.NoError(t, err)
+	resp, err := edited.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, []string{"a", "b"}, gotHeaders)
+	require.Empty(t, req.Header)
+
+	resp, err = client.Get(ctx, ts.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Empty(t, gotHeaders)
+
+	_, err = client.WithRequestEditor(func(*http.Request) error {
+		return errors.New("no credentials")
+	}).Get(ctx, ts.URL)
+	require.EqualError(t, err, "no credentials")
+}
+
+func TestFromContext(t *testing.T) {
+	ctx := context.Background()
+	require.Same(t, defaultClient(), FromContext(ctx))
+	client := newTestClient(t, Options{})
+	require.Same(t, client, FromContext(NewContext(ctx, client)))
+}